@@ -10,20 +10,25 @@ import (
 	_ "github.com/seveas/herd/provider/putty"
 
 	// Simple file based providers
+	_ "github.com/seveas/herd/provider/ansible"
 	_ "github.com/seveas/herd/provider/json"
+	_ "github.com/seveas/herd/provider/overlay"
 	_ "github.com/seveas/herd/provider/plain"
 
 	// Network based ones
 	_ "github.com/seveas/herd/provider/cache"
 	_ "github.com/seveas/herd/provider/consul"
+	_ "github.com/seveas/herd/provider/dns"
 	_ "github.com/seveas/herd/provider/http"
 	_ "github.com/seveas/herd/provider/prometheus"
 	_ "github.com/seveas/herd/provider/puppet"
+	_ "github.com/seveas/herd/provider/sql"
 
 	// Cloud providers
 	_ "github.com/seveas/herd/provider/aws"
 	_ "github.com/seveas/herd/provider/azure"
 	_ "github.com/seveas/herd/provider/google"
+	_ "github.com/seveas/herd/provider/kubernetes"
 	_ "github.com/seveas/herd/provider/transip"
 
 	// The sky is the limit!
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Find and show the results of past runs",
+	Long: `All commands run by herd, and their results, are stored in a history
+database. You can search it by command, host, exit status and date, and
+show the results of a past run again.`,
+	Args: cobra.NoArgs,
+}
+
+var historyListCmd = &cobra.Command{
+	Use:     "list [--command text] [--host glob] [--exit-status code] [--since date] [--until date]",
+	Aliases: []string{"search"},
+	Short:   "List past runs, newest first",
+	Example: `  herd history list --host 'web-*' --exit-status 1 --since 24h
+  herd history search --command apt-get --since 2024-03-01 --until 2024-03-08`,
+	RunE:                  historyList,
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:                   "show id",
+	Short:                 "Show the results of a past run",
+	RunE:                  historyShow,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	f := historyListCmd.Flags()
+	f.String("command", "", "Only show runs of commands containing this text")
+	f.String("host", "", "Only show runs on hosts matching this glob")
+	f.Int("exit-status", 0, "Only show runs where (matching) hosts exited with this status")
+	f.String("since", "", "Only show runs started after this date, or this long ago")
+	f.String("until", "", "Only show runs started before this date, or this long ago")
+	f.Int("limit", 20, "Show at most this many runs, 0 for no limit")
+	historyCmd.AddCommand(historyListCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	rootCmd.AddCommand(historyCmd)
+}
+
+func historyList(cmd *cobra.Command, args []string) error {
+	f := cmd.Flags()
+	q := herd.HistoryQuery{}
+	q.Command, _ = f.GetString("command")
+	q.Host, _ = f.GetString("host")
+	q.Limit, _ = f.GetInt("limit")
+	if f.Changed("exit-status") {
+		status, _ := f.GetInt("exit-status")
+		q.ExitStatus = &status
+	}
+	var err error
+	if s, _ := f.GetString("since"); s != "" {
+		if q.Since, err = parseHistoryDate(s); err != nil {
+			return err
+		}
+	}
+	if s, _ := f.GetString("until"); s != "" {
+		if q.Until, err = parseHistoryDate(s); err != nil {
+			return err
+		}
+	}
+	cmd.SilenceUsage = true
+
+	db, err := openHistoryDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	entries, err := db.Search(q)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("No matching runs found")
+	}
+	ui := herd.NewSimpleUI(colorConfig(), new(herd.HostSet))
+	defer ui.End()
+	ui.PrintHistoryEntries(entries)
+	return nil
+}
+
+func historyShow(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid history id: %s", args[0])
+	}
+	cmd.SilenceUsage = true
+
+	db, err := openHistoryDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	hi, err := db.Get(id)
+	if err != nil {
+		return err
+	}
+	ui := herd.NewSimpleUI(colorConfig(), new(herd.HostSet))
+	defer ui.End()
+	ui.SetOutputMode(viper.Get("Output").(herd.OutputMode))
+	ui.SetPagerEnabled(!viper.GetBool("NoPager"))
+	ui.PrintHistoryEntries([]herd.HistoryEntry{{Id: id, Item: hi}})
+	ui.PrintHistoryItem(hi)
+	return nil
+}
+
+// Dates can be given as a date, a date and time, or a duration ago
+func parseHistoryDate(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid date: %s", s)
+}
+
+// Save the history of this invocation both in the history database and as a
+// json file. Only failing to write the json file is considered an error.
+func saveHistory(history herd.History) error {
+	if len(history) == 0 {
+		return nil
+	}
+	if db, err := openHistoryDB(); err != nil {
+		logrus.Warn(err.Error())
+	} else {
+		for _, hi := range history {
+			if _, err := db.Add(hi); err != nil {
+				logrus.Warnf("Unable to add to history database: %s", err)
+				break
+			}
+		}
+		_ = db.Close()
+	}
+	return history.Save(historyFile(currentUser.historyDir))
+}
+
+// Open the history database, importing all existing history files when it is
+// first created
+func openHistoryDB() (*herd.HistoryDB, error) {
+	path := filepath.Join(currentUser.historyDir, "history.db")
+	_, err := os.Stat(path)
+	isNew := os.IsNotExist(err)
+	db, err := herd.OpenHistoryDB(path)
+	if err != nil || !isNew {
+		return db, err
+	}
+	importHistory(db, currentUser.historyDir)
+	return db, nil
+}
+
+func importHistory(db *herd.HistoryDB, dir string) {
+	hd, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type entry struct {
+		name string
+		num  int
+	}
+	entries := make([]entry, 0, len(hd))
+	for _, e := range hd {
+		parts := strings.Split(e.Name(), "_")
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") || len(parts) != 3 {
+			continue
+		}
+		if n, err := strconv.Atoi(parts[0]); err == nil {
+			entries = append(entries, entry{name: e.Name(), num: n})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].num < entries[j].num
+	})
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.name)) // #nosec G304 -- These are our own history files
+		if err != nil {
+			logrus.Warnf("Unable to import history file %s: %s", e.name, err)
+			continue
+		}
+		var hist herd.History
+		if err := json.Unmarshal(data, &hist); err != nil {
+			logrus.Warnf("Unable to import history file %s: %s", e.name, err)
+			continue
+		}
+		for _, hi := range hist {
+			if _, err := db.Add(hi); err != nil {
+				logrus.Warnf("Unable to import history file %s: %s", e.name, err)
+				return
+			}
+		}
+	}
+	logrus.Debugf("Imported %d history files into the history database", len(entries))
+}
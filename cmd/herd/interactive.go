@@ -4,14 +4,14 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"strings"
 
+	"github.com/seveas/herd"
 	"github.com/seveas/herd/scripting"
-	"github.com/seveas/herd/ssh"
 
 	"github.com/seveas/readline"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var interactiveCmd = &cobra.Command{
@@ -36,7 +36,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 	cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
-	executor, err := ssh.NewExecutor(viper.GetInt("SshAgentCount"), viper.GetDuration("SshAgentTimeout"), *currentUser.user, false)
+	executor, err := newExecutor(false)
 	if err != nil {
 		bail(err.Error())
 	}
@@ -54,8 +54,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 	// Enter interactive mode
 	il := &interactiveLoop{engine: engine}
 	il.run()
-	fn := historyFile(currentUser.historyDir)
-	return engine.History.Save(fn)
+	return saveHistory(engine.History)
 }
 
 type interactiveLoop struct {
@@ -88,6 +87,17 @@ func (l *interactiveLoop) run() {
 		if line == "exit" {
 			break
 		}
+		// The picker needs the terminal, so it's not part of the scripting
+		// language
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == "pick" {
+			if err := l.engine.Ui.PickHosts(fields[1:]); err == herd.ErrPickCancelled {
+				logrus.Info(err.Error())
+			} else if err != nil {
+				logrus.Error(err.Error())
+			}
+			rl.SetPrompt(l.prompt())
+			continue
+		}
 		if err := l.engine.ParseCodeLine(line + "\n"); err != nil {
 			logrus.Error(err.Error())
 			l.engine.Ui.Sync()
@@ -118,6 +128,9 @@ func (l *interactiveLoop) autoComplete() readline.AutoCompleter {
 		p("list hosts",
 			p("oneline"),
 		),
+		p("pick"),
 		p("run"),
+		p("push"),
+		p("pull"),
 	)
 }
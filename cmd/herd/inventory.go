@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/seveas/herd"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Every load of the inventory that differs from the last snapshot is saved as
+// the last snapshot, and the snapshot it replaces is kept as the previous one
+const (
+	lastSnapshot     = "last"
+	previousSnapshot = "previous"
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Track changes in your inventory",
+	Long: `Every time herd loads hosts and they changed since the last time, it saves
+a snapshot of all hosts and their attributes. You can compare the current
+inventory to the previous snapshot, or to snapshots you save yourself, to find
+hosts that were added, removed or changed.`,
+	Args: cobra.NoArgs,
+}
+
+var inventoryDiffCmd = &cobra.Command{
+	Use:   "diff [snapshot]",
+	Short: "Show how hosts changed since the previous load, or since a snapshot",
+	Example: `  herd inventory snapshot before-migration
+  herd inventory diff before-migration`,
+	RunE:                  inventoryDiff,
+	Args:                  cobra.MaximumNArgs(1),
+	DisableFlagsInUseLine: true,
+}
+
+var inventorySnapshotCmd = &cobra.Command{
+	Use:                   "snapshot name",
+	Short:                 "Save the current inventory as a named snapshot",
+	RunE:                  inventorySnapshot,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	inventoryCmd.AddCommand(inventoryDiffCmd)
+	inventoryCmd.AddCommand(inventorySnapshotCmd)
+	rootCmd.AddCommand(inventoryCmd)
+}
+
+func snapshotFile(name string) string {
+	return filepath.Join(currentUser.dataDir, "snapshots", name+".json")
+}
+
+func checkSnapshotName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("Invalid snapshot name: %s", name)
+	}
+	return nil
+}
+
+// saveInventorySnapshot is called after every successful load of the
+// inventory and keeps the last two different inventories
+func saveInventorySnapshot(registry *herd.Registry) {
+	if err := registry.SaveSnapshot(snapshotFile(lastSnapshot), snapshotFile(previousSnapshot)); err != nil {
+		logrus.Warnf("Unable to save inventory snapshot: %s", err)
+	}
+}
+
+func inventoryDiff(cmd *cobra.Command, args []string) error {
+	name := previousSnapshot
+	if len(args) == 1 {
+		name = args[0]
+	}
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	engine, err := setupScriptEngine(nil)
+	if err != nil {
+		return err
+	}
+	defer engine.End()
+	diff, err := engine.Registry.DiffSnapshot(snapshotFile(name))
+	if os.IsNotExist(err) {
+		err = fmt.Errorf("No snapshot named %s found", name)
+		if name == previousSnapshot {
+			err = fmt.Errorf("No previous inventory snapshot found, herd needs to load hosts at least twice")
+		}
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		return err
+	}
+	engine.Ui.PrintInventoryDiff(diff)
+	return nil
+}
+
+func inventorySnapshot(cmd *cobra.Command, args []string) error {
+	if err := checkSnapshotName(args[0]); err != nil {
+		return err
+	}
+	if args[0] == lastSnapshot || args[0] == previousSnapshot {
+		return fmt.Errorf("The %s snapshot is managed by herd itself, please use another name", args[0])
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	engine, err := setupScriptEngine(nil)
+	if err != nil {
+		return err
+	}
+	defer engine.End()
+	if err = engine.Registry.SaveSnapshot(snapshotFile(args[0]), ""); err != nil {
+		logrus.Errorf("Unable to save snapshot: %s", err)
+		return err
+	}
+	logrus.Infof("Inventory saved as snapshot %s", args[0])
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/seveas/herd"
 	"github.com/seveas/herd/ssh"
@@ -79,6 +80,19 @@ func runKeyScan(cmd *cobra.Command, args []string) error {
 		hosts := engine.Registry.Search("*", []herd.MatchAttribute{}, []string{}, 0)
 		engine.Hosts.AddHosts(hosts)
 	}
+	if viper.Get("Format") == herd.FormatJsonl {
+		oc := engine.Ui.OutputChannel()
+		pc := engine.Ui.ProgressChannel(time.Now().Add(engine.Runner.GetTimeout()))
+		hi, err := engine.Runner.Run("herd:keyscan", pc, oc)
+		close(oc)
+		close(pc)
+		engine.Ui.Sync()
+		if err != nil {
+			return err
+		}
+		engine.Ui.PrintHistoryItem(hi)
+		return nil
+	}
 	if _, err = engine.Runner.Run("herd:keyscan", nil, nil); err != nil {
 		return err
 	}
@@ -29,6 +29,7 @@ func init() {
 	f.String("template", "", "Template to use for showing hosts")
 	f.StringSlice("count", []string{}, "Show counts for the values of these attributes")
 	f.String("group", "", "Group hosts by the values of this attribute")
+	f.Bool("pick", false, "Pick hosts from the matching hosts in a full-screen picker before listing them")
 	f.Bool("stats", false, "Show statistics for the values of the attributes specified in --count and --group")
 	// This makes `--count my_attribute` stop working and makes it require `--count=my_attribute` instead.
 	// f.Lookup("count").NoOptDefVal = "*"
@@ -64,6 +65,12 @@ func runList(cmd *cobra.Command, args []string) error {
 		viper.SetDefault("Separator", "\n")
 	}
 	engine.Execute()
+	if viper.GetBool("Pick") {
+		if err = engine.Ui.PickHosts(viper.GetStringSlice("Attributes")); err != nil {
+			logrus.Error(err.Error())
+			return err
+		}
+	}
 	opts := herd.HostListOptions{
 		OneLine:     viper.GetBool("OneLine"),
 		Separator:   viper.GetString("Separator"),
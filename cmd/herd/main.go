@@ -17,7 +17,9 @@ import (
 	"time"
 
 	"github.com/seveas/herd"
+	"github.com/seveas/herd/local"
 	"github.com/seveas/herd/scripting"
+	"github.com/seveas/herd/ssh"
 
 	"github.com/mgutz/ansi"
 	"github.com/sirupsen/logrus"
@@ -145,7 +147,17 @@ Providers: %s
 	f.Duration("ssh-agent-timeout", time.Second, "SSH agent timeout when checking functionality")
 	f.Int("ssh-agent-count", 50, "Number of parallel connections to the ssh agent")
 	f.IntP("parallel", "p", 0, "Maximum number of hosts to run on in parallel")
-	f.StringP("output", "o", "all", "When to print command output (all at once, per host or per line)")
+	f.String("batch-size", "", "Run on hosts in batches of this many hosts, or this percentage of hosts, one batch after another")
+	f.String("max-failures", "", "Stop starting commands when more than this many, or this percentage of, hosts in a batch fail")
+	f.Int("retry-connect", 0, "Retry this many times when connecting to a host fails")
+	f.Int("retry-auth", 0, "Retry this many times when authenticating to a host fails")
+	f.Int("retry-timeout", 0, "Retry this many times when a command times out")
+	f.Duration("retry-backoff", time.Second, "Wait this long before retrying, doubling the wait for each next retry")
+	f.StringP("output", "o", "all", "When to print command output (all at once, per host, per line, grouped by identical output, or in a live dashboard)")
+	f.String("format", "pretty", "Output format: pretty for humans, or jsonl for a stream of JSON objects")
+	f.Bool("local", false, "Run commands on the local machine once per host, with host attributes in the environment, instead of on the hosts with ssh")
+	f.Bool("template-command", false, "Expand the command as a template for every host, e.g. {{.Attributes.datacenter}}")
+	f.Bool("sudo", false, "Run commands with sudo, asking for the sudo password once")
 	f.IntSlice("expect-exit-status", []int{0}, "Exit status(es) to consider as successful")
 	f.Bool("no-pager", false, "Disable the use of the pager")
 	f.Bool("no-color", false, "Disable the use of the colors in the output")
@@ -206,16 +218,28 @@ func initConfig() {
 		ansi.DisableColors(true)
 	}
 	outputModes := map[string]herd.OutputMode{
-		"all":      herd.OutputAll,
-		"inline":   herd.OutputInline,
-		"per-host": herd.OutputPerhost,
-		"tail":     herd.OutputTail,
+		"all":       herd.OutputAll,
+		"inline":    herd.OutputInline,
+		"per-host":  herd.OutputPerhost,
+		"tail":      herd.OutputTail,
+		"grouped":   herd.OutputGrouped,
+		"diff":      herd.OutputDiff,
+		"dashboard": herd.OutputDashboard,
 	}
 	om, ok := outputModes[viper.GetString("Output")]
 	if !ok {
-		bail("Unknown output mode: %s. Known modes: all, inline, per-host, tail", viper.GetString("Output"))
+		bail("Unknown output mode: %s. Known modes: all, inline, per-host, tail, grouped, diff, dashboard", viper.GetString("Output"))
 	}
 	viper.Set("Output", om)
+	outputFormats := map[string]herd.OutputFormat{
+		"pretty": herd.FormatPretty,
+		"jsonl":  herd.FormatJsonl,
+	}
+	of, ok := outputFormats[viper.GetString("Format")]
+	if !ok {
+		bail("Unknown output format: %s. Known formats: pretty, jsonl", viper.GetString("Format"))
+	}
+	viper.Set("Format", of)
 }
 
 func bail(format string, args ...any) {
@@ -223,29 +247,28 @@ func bail(format string, args ...any) {
 	os.Exit(1)
 }
 
+// newExecutor returns an ssh executor, or a local executor if commands should
+// run on the local machine
+func newExecutor(disconnect bool) (herd.Executor, error) {
+	if viper.GetBool("Local") {
+		return local.NewExecutor()
+	}
+	return ssh.NewExecutor(viper.GetInt("SshAgentCount"), viper.GetDuration("SshAgentTimeout"), *currentUser.user, disconnect)
+}
+
 func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error) {
+	if viper.GetBool("Sudo") {
+		if err := enableSudo(executor); err != nil {
+			logrus.Error(err.Error())
+			return nil, err
+		}
+	}
 	hosts := new(herd.HostSet)
 	hosts.SetSortFields(viper.GetStringSlice("Sort"))
-	colors := viper.Sub("Colors")
-	colorConfig := herd.ColorConfig{}
-	if colors != nil {
-		colorConfig.LogDebug = colors.GetString("LogDebug")
-		colorConfig.LogInfo = colors.GetString("LogInfo")
-		colorConfig.LogWarn = colors.GetString("LogWarn")
-		colorConfig.LogError = colors.GetString("LogError")
-		colorConfig.Command = colors.GetString("Command")
-		colorConfig.Summary = colors.GetString("Summary")
-		colorConfig.Provider = colors.GetString("Provider")
-		colorConfig.HostStdout = colors.GetString("HostStdout")
-		colorConfig.HostStderr = colors.GetString("HostStderr")
-		colorConfig.HostOK = colors.GetString("HostOK")
-		colorConfig.HostFail = colors.GetString("HostFail")
-		colorConfig.HostError = colors.GetString("HostError")
-		colorConfig.HostCancel = colors.GetString("HostCancel")
-	}
 
-	ui := herd.NewSimpleUI(colorConfig, hosts)
+	ui := herd.NewSimpleUI(colorConfig(), hosts)
 	ui.SetOutputMode(viper.Get("Output").(herd.OutputMode))
+	ui.SetOutputFormat(viper.Get("Format").(herd.OutputFormat))
 	ui.SetOutputTimestamp(viper.GetBool("Timestamp"))
 	ui.SetPagerEnabled(!viper.GetBool("NoPager"))
 	ui.BindLogrus()
@@ -254,6 +277,14 @@ func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error)
 	registry.AddGlobPrefix("hist:", func(glob string, hs *herd.HostSet) (*herd.HostSet, error) {
 		return historyFilter(currentUser.historyDir, glob, hs)
 	})
+	registry.AddGlobPrefix("history:", func(spec string, hs *herd.HostSet) (*herd.HostSet, error) {
+		db, err := openHistoryDB()
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		return db.FilterHosts(spec, hs)
+	})
 	conf := viper.Sub("Providers")
 	if conf != nil {
 		if err := registry.LoadProviders(conf); err != nil {
@@ -262,6 +293,19 @@ func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error)
 			return nil, err
 		}
 	}
+	var derived []struct{ Name, Value string }
+	if err := viper.UnmarshalKey("DerivedAttributes", &derived); err != nil {
+		logrus.Errorf("Error parsing derived attributes: %s", err)
+		ui.End()
+		return nil, err
+	}
+	for _, d := range derived {
+		if err := registry.AddDerivedAttribute(d.Name, d.Value); err != nil {
+			logrus.Error(err.Error())
+			ui.End()
+			return nil, err
+		}
+	}
 	if !viper.GetBool("NoMagicProviders") {
 		registry.LoadMagicProviders()
 	}
@@ -280,6 +324,10 @@ func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error)
 			ui.End()
 			return nil, err
 		}
+	} else {
+		// Partial loads would show up as lots of removed hosts, so only
+		// complete loads are snapshotted
+		saveInventorySnapshot(registry)
 	}
 	if err := registry.LoadHostKeys(ctx, ui.LoadingMessage); err != nil {
 		if viper.GetBool("StrictLoading") {
@@ -290,8 +338,28 @@ func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error)
 	ui.Sync()
 	runner := herd.NewRunner(hosts, executor)
 	handleSignals(runner)
+	// The dashboard puts the terminal in raw mode, so ctrl-c is a key press there
+	ui.OnInterrupt(runner.Interrupt)
 	runner.SetSplay(viper.GetDuration("Splay"))
 	runner.SetParallel(viper.GetInt("Parallel"))
+	if s := viper.GetString("BatchSize"); s != "" {
+		size, percentage, err := herd.ParseCountOrPercentage(s)
+		if err != nil {
+			logrus.Error(err.Error())
+			ui.End()
+			return nil, err
+		}
+		runner.SetBatchSize(size, percentage)
+	}
+	if s := viper.GetString("MaxFailures"); s != "" {
+		count, percentage, err := herd.ParseCountOrPercentage(s)
+		if err != nil {
+			logrus.Error(err.Error())
+			ui.End()
+			return nil, err
+		}
+		runner.SetMaxFailures(count, percentage)
+	}
 	// If only one of the timeouts was specified, we adjust the other based on batch size
 	if viper.IsSet("Timeout") || !viper.IsSet("HostTimeout") {
 		runner.SetTimeout(viper.GetDuration("Timeout"))
@@ -300,10 +368,36 @@ func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error)
 		runner.SetHostTimeout(viper.GetDuration("HostTimeout"))
 	}
 	runner.SetConnectTimeout(viper.GetDuration("ConnectTimeout"))
+	runner.SetRetries(herd.ConnectError, viper.GetInt("RetryConnect"))
+	runner.SetRetries(herd.AuthError, viper.GetInt("RetryAuth"))
+	runner.SetRetries(herd.SessionTimeout, viper.GetInt("RetryTimeout"))
+	runner.SetRetryBackoff(viper.GetDuration("RetryBackoff"))
+	runner.SetTemplateCommand(viper.GetBool("TemplateCommand"))
 	runner.SetExpectExitStatus(viper.GetIntSlice("ExpectExitStatus"))
 	return scripting.NewScriptEngine(hosts, ui, registry, runner), nil
 }
 
+func colorConfig() herd.ColorConfig {
+	colors := viper.Sub("Colors")
+	colorConfig := herd.ColorConfig{}
+	if colors != nil {
+		colorConfig.LogDebug = colors.GetString("LogDebug")
+		colorConfig.LogInfo = colors.GetString("LogInfo")
+		colorConfig.LogWarn = colors.GetString("LogWarn")
+		colorConfig.LogError = colors.GetString("LogError")
+		colorConfig.Command = colors.GetString("Command")
+		colorConfig.Summary = colors.GetString("Summary")
+		colorConfig.Provider = colors.GetString("Provider")
+		colorConfig.HostStdout = colors.GetString("HostStdout")
+		colorConfig.HostStderr = colors.GetString("HostStderr")
+		colorConfig.HostOK = colors.GetString("HostOK")
+		colorConfig.HostFail = colors.GetString("HostFail")
+		colorConfig.HostError = colors.GetString("HostError")
+		colorConfig.HostCancel = colors.GetString("HostCancel")
+	}
+	return colorConfig
+}
+
 func historyFile(dir string) string {
 	// Read existing history, migrate if needed
 	hist, err := os.ReadDir(dir)
@@ -10,11 +10,14 @@ import (
 	_ "github.com/seveas/herd/provider/putty"
 
 	// Simple file based providers
+	_ "github.com/seveas/herd/provider/ansible"
 	_ "github.com/seveas/herd/provider/json"
+	_ "github.com/seveas/herd/provider/overlay"
 	_ "github.com/seveas/herd/provider/plain"
 
 	// Network based ones
 	_ "github.com/seveas/herd/provider/cache"
+	_ "github.com/seveas/herd/provider/dns"
 	_ "github.com/seveas/herd/provider/http"
 
 	// The sky is the limit!
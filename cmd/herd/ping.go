@@ -56,6 +56,13 @@ func runPing(cmd *cobra.Command, args []string) error {
 	oc := engine.Ui.OutputChannel()
 	pc := engine.Ui.ProgressChannel(time.Now().Add(engine.Runner.GetTimeout()))
 	hi, err := engine.Runner.Run("", pc, oc)
+	if oc != nil {
+		close(oc)
+	}
+	if pc != nil {
+		close(pc)
+	}
+	engine.Ui.Sync()
 	if err != nil {
 		logrus.Error(err.Error())
 		return nil
@@ -2,8 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
 
-	"github.com/seveas/herd/ssh"
+	"github.com/seveas/herd"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -19,6 +20,9 @@ var runCmd = &cobra.Command{
 }
 
 func init() {
+	f := runCmd.Flags()
+	f.Bool("stdin", false, "Read data from stdin and send it to the command on every host")
+	bindFlagsAndEnv(f)
 	rootCmd.AddCommand(runCmd)
 }
 
@@ -30,7 +34,7 @@ func runCommand(cmd *cobra.Command, args []string) error {
 	cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
-	executor, err := ssh.NewExecutor(viper.GetInt("SshAgentCount"), viper.GetDuration("SshAgentTimeout"), *currentUser.user, true)
+	executor, err := newExecutor(true)
 	if err != nil {
 		bail(err.Error())
 	}
@@ -39,11 +43,19 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	defer engine.End()
+	if viper.GetBool("Stdin") {
+		stdin, err := herd.NewStdin(os.Stdin)
+		if err != nil {
+			logrus.Errorf("Unable to read stdin: %s", err)
+			return err
+		}
+		defer stdin.Close()
+		engine.Runner.SetStdin(stdin)
+	}
 	if err = engine.ParseCommandLine(args, splitAt); err != nil {
 		logrus.Error(err.Error())
 		return err
 	}
 	engine.Execute()
-	fn := historyFile(currentUser.historyDir)
-	return engine.History.Save(fn)
+	return saveHistory(engine.History)
 }
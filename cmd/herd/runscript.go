@@ -3,11 +3,8 @@ package main
 import (
 	"fmt"
 
-	"github.com/seveas/herd/ssh"
-
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var runScriptCmd = &cobra.Command{
@@ -44,7 +41,7 @@ func runScript(cmd *cobra.Command, args []string) error {
 	cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
-	executor, err := ssh.NewExecutor(viper.GetInt("SshAgentCount"), viper.GetDuration("SshAgentTimeout"), *currentUser.user, false)
+	executor, err := newExecutor(false)
 	if err != nil {
 		bail(err.Error())
 	}
@@ -62,6 +59,5 @@ func runScript(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	engine.Execute()
-	fn := historyFile(currentUser.historyDir)
-	return engine.History.Save(fn)
+	return saveHistory(engine.History)
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/seveas/herd"
+
+	"golang.org/x/term"
+)
+
+type sudoExecutor interface {
+	SetSudoPassword([]byte)
+}
+
+// Ask for the sudo password once, and let the executor use it for all hosts
+func enableSudo(executor herd.Executor) error {
+	se, ok := executor.(sudoExecutor)
+	if !ok {
+		return errors.New("This executor does not support sudo")
+	}
+	// Stdin may be data for the commands, so we prefer asking on the terminal
+	tty := os.Stdin
+	if f, err := os.Open("/dev/tty"); err == nil {
+		defer f.Close()
+		tty = f
+	}
+	fd := int(tty.Fd()) // #nosec G115 -- File descriptors fit in an int
+	if !term.IsTerminal(fd) {
+		return errors.New("Can't ask for the sudo password: no terminal available")
+	}
+	fmt.Fprintf(os.Stderr, "Sudo password for %s: ", currentUser.user.Username)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return fmt.Errorf("Unable to read sudo password: %w", err)
+	}
+	se.SetSudoPassword(password)
+	return nil
+}
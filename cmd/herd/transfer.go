@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/seveas/herd/ssh"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var pushCmd = &cobra.Command{
+	Use:                   "push glob [filters] [<+|-> glob [filters]...] -- local-file remote-path",
+	Short:                 "Copy a file to a set of hosts",
+	Example:               "  herd push *.site1.example.com os=Debian -- motd /etc/motd",
+	RunE:                  transferCommand,
+	DisableFlagsInUseLine: true,
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull glob [filters] [<+|-> glob [filters]...] -- remote-file local-directory",
+	Short: "Copy a file from a set of hosts",
+	Long: `Copy a file from a set of hosts. Each host's copy is stored in a
+subdirectory of the local directory, named after the host.`,
+	Example:               "  herd pull *.site1.example.com -- /var/log/syslog logs",
+	RunE:                  transferCommand,
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+	rootCmd.AddCommand(pullCmd)
+}
+
+func transferCommand(cmd *cobra.Command, args []string) error {
+	splitAt := cmd.ArgsLenAtDash()
+	if splitAt == -1 || len(args)-splitAt != 2 {
+		return fmt.Errorf("A source and destination are mandatory")
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	executor, err := ssh.NewExecutor(viper.GetInt("SshAgentCount"), viper.GetDuration("SshAgentTimeout"), *currentUser.user, true)
+	if err != nil {
+		bail(err.Error())
+	}
+	engine, err := setupScriptEngine(executor)
+	if err != nil {
+		return err
+	}
+	defer engine.End()
+	if err = engine.ParseCommandLine(args[:splitAt], -1); err != nil {
+		logrus.Error(err.Error())
+		return err
+	}
+	if cmd.Name() == "push" {
+		engine.QueuePush(args[splitAt], args[splitAt+1])
+	} else {
+		engine.QueuePull(args[splitAt], args[splitAt+1])
+	}
+	engine.Execute()
+	return saveHistory(engine.History)
+}
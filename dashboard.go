@@ -0,0 +1,402 @@
+package herd
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mgutz/ansi"
+	"github.com/sirupsen/logrus"
+)
+
+// How many lines of output the dashboard shows for every host in the host list
+const dashboardTailLines = 2
+
+var dashboardEscapes = regexp.MustCompile("\033\\[[0-9;?]*[ -/]*[@-~]")
+
+type dashboardLine struct {
+	text   string
+	stderr bool
+}
+
+type dashboardHost struct {
+	host    *Host
+	state   ProgressState
+	start   time.Time
+	attempt int
+	result  *Result
+	lines   []dashboardLine
+}
+
+// A dashboard is the state of the live dashboard: every host with its state
+// and output so far, and which host is selected or focused. Like the host
+// picker, it knows nothing about terminals.
+type dashboard struct {
+	hosts     []*dashboardHost
+	index     map[*Host]*dashboardHost
+	formatter formatter
+	colors    ColorConfig
+	start     time.Time
+	deadline  time.Time
+	nameLen   int
+	cursor    int
+	offset    int
+	// When focused on a single host, scroll is how many lines we are
+	// scrolled back from the end of its output. 0 follows the output.
+	focus  *dashboardHost
+	scroll int
+}
+
+func newDashboard(hosts []*Host, deadline time.Time, f formatter, colors ColorConfig) *dashboard {
+	d := &dashboard{
+		hosts:     make([]*dashboardHost, len(hosts)),
+		index:     make(map[*Host]*dashboardHost, len(hosts)),
+		formatter: f,
+		colors:    colors,
+		start:     time.Now(),
+		deadline:  deadline,
+		nameLen:   maxNameLength(hosts),
+	}
+	for i, host := range hosts {
+		d.hosts[i] = &dashboardHost{host: host, state: Queued}
+		d.index[host] = d.hosts[i]
+	}
+	return d
+}
+
+func (d *dashboard) get(host *Host) *dashboardHost {
+	h, ok := d.index[host]
+	if !ok {
+		h = &dashboardHost{host: host, state: Queued}
+		d.hosts = append(d.hosts, h)
+		d.index[host] = h
+		d.nameLen = max(d.nameLen, len(host.Name))
+	}
+	return h
+}
+
+func (d *dashboard) progress(msg ProgressMessage) {
+	h := d.get(msg.Host)
+	h.state = msg.State
+	switch msg.State {
+	case Running:
+		if h.attempt == 0 {
+			h.start = time.Now()
+		}
+		h.attempt++
+	case Retrying, Finished, Skipped:
+		h.result = msg.Result
+	}
+}
+
+// output adds a line of output to a host. Colors and other escape sequences
+// are removed, and only the text after the last carriage return is kept, so
+// progress bars don't mess up the screen.
+func (d *dashboard) output(line OutputLine) {
+	h := d.get(line.Host)
+	data := bytes.TrimRight(line.Data, "\r\n")
+	if idx := bytes.LastIndexByte(data, '\r'); idx != -1 {
+		data = data[idx+1:]
+	}
+	text := dashboardEscapes.ReplaceAllString(string(data), "")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	text = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, text)
+	h.lines = append(h.lines, dashboardLine{text: text, stderr: line.Stderr})
+	// Keep the focused view in place when scrolled back
+	if h == d.focus && d.scroll > 0 {
+		d.scroll++
+	}
+}
+
+// The status and help lines take up the top of the screen, the rest is for
+// hosts or the output of the focused host
+func (d *dashboard) pageSize(height int) int {
+	if d.focus != nil {
+		return max(height-2, 1)
+	}
+	return max((height-2)/(dashboardTailLines+1), 1)
+}
+
+// handleKey processes a single key press, and returns whether the user wants
+// to interrupt the run
+func (d *dashboard) handleKey(k keyPress, height int) bool {
+	page := d.pageSize(height)
+	if k.key == keyInterrupt {
+		return true
+	}
+	if d.focus != nil {
+		maxScroll := max(len(d.focus.lines)-page, 0)
+		switch k.key {
+		case keyUp:
+			d.scroll = min(d.scroll+1, maxScroll)
+		case keyDown:
+			d.scroll = max(d.scroll-1, 0)
+		case keyPageUp:
+			d.scroll = min(d.scroll+page, maxScroll)
+		case keyPageDown:
+			d.scroll = max(d.scroll-page, 0)
+		case keyHome:
+			d.scroll = maxScroll
+		case keyEnd:
+			d.scroll = 0
+		case keyCancel, keyBackspace:
+			d.focus = nil
+		}
+		return false
+	}
+	switch k.key {
+	case keyUp:
+		d.cursor = max(d.cursor-1, 0)
+	case keyDown:
+		d.cursor = max(min(d.cursor+1, len(d.hosts)-1), 0)
+	case keyPageUp:
+		d.cursor = max(d.cursor-page, 0)
+	case keyPageDown:
+		d.cursor = max(min(d.cursor+page, len(d.hosts)-1), 0)
+	case keyHome:
+		d.cursor = 0
+	case keyEnd:
+		d.cursor = max(len(d.hosts)-1, 0)
+	case keyAccept:
+		if len(d.hosts) > 0 {
+			d.focus = d.hosts[d.cursor]
+			d.scroll = 0
+		}
+	}
+	return false
+}
+
+// describe returns a short description of the state of a host, and the color
+// to show it in
+func (d *dashboard) describe(h *dashboardHost, now time.Time) (string, string) {
+	switch h.state {
+	case Queued:
+		return "queued", d.colors.Summary
+	case Waiting:
+		return "waiting", d.colors.Summary
+	case Running:
+		msg := "running for " + now.Sub(h.start).Truncate(time.Second).String()
+		if h.attempt > 1 {
+			msg += fmt.Sprintf(", attempt %d", h.attempt)
+		}
+		return msg, d.colors.HostStdout
+	case Retrying:
+		return "retrying after " + h.result.Err.Error(), d.colors.HostFail
+	}
+	msg, color, timed := d.formatter.status(h.result)
+	if timed {
+		msg += " after " + h.result.EndTime.Sub(h.result.StartTime).Truncate(time.Second).String()
+	}
+	return msg, color
+}
+
+// status summarizes the progress of all hosts, like the progress line of the
+// other output modes
+func (d *dashboard) status(now time.Time) string {
+	total, done, queued, waiting, running, retrying := len(d.hosts), 0, 0, 0, 0, 0
+	nok, nfail, nerr, nskip := 0, 0, 0, 0
+	for _, h := range d.hosts {
+		switch h.state {
+		case Queued:
+			queued++
+		case Waiting:
+			waiting++
+		case Running:
+			running++
+		case Retrying:
+			retrying++
+		case Skipped:
+			done++
+			nskip++
+		case Finished:
+			done++
+			switch {
+			case h.result.ExitStatus == -1:
+				nerr++
+			case h.result.ExitSuccess:
+				nok++
+			default:
+				nfail++
+			}
+		}
+	}
+	since := (now.Sub(d.start) + time.Second/2).Truncate(time.Second)
+	if done == total {
+		msg := fmt.Sprintf("%d done, %d ok, %d fail, %d error", total, nok, nfail, nerr)
+		if nskip > 0 {
+			msg += fmt.Sprintf(", %d skipped", nskip)
+		}
+		return fmt.Sprintf("%s in %s", msg, since)
+	}
+	togo := (d.deadline.Sub(now) + time.Second/2).Truncate(time.Second)
+	msg := fmt.Sprintf("Waiting (%s/%s)... %d/%d done", since, togo, done, total)
+	if queued > 0 {
+		msg += fmt.Sprintf(", %d queued", queued)
+	}
+	if waiting > 0 {
+		msg += fmt.Sprintf(", %d waiting", waiting)
+	}
+	msg += fmt.Sprintf(", %d in progress", running)
+	if retrying > 0 {
+		msg += fmt.Sprintf(", %d retrying", retrying)
+	}
+	return msg + fmt.Sprintf(", %d ok, %d fail, %d error", nok, nfail, nerr)
+}
+
+func (d *dashboard) formatLine(line dashboardLine, width int) string {
+	text := truncate("    "+line.text, width)
+	if line.stderr {
+		return ansi.Color(text, d.colors.HostStderr)
+	}
+	return text
+}
+
+// render draws the dashboard on a screen of the given size: either the list of
+// hosts with the last lines of their output, or all output of the focused host
+func (d *dashboard) render(width, height int, now time.Time) string {
+	page := d.pageSize(height)
+	lines := []string{ansi.Color(truncate(d.status(now), width), d.colors.Summary)}
+	if d.focus != nil {
+		msg, color := d.describe(d.focus, now)
+		header := ansi.Color(truncate(d.focus.host.Name+"  "+msg, width), color)
+		help := "  (up/down/pgup/pgdn: scroll, end: follow output, esc: back to all hosts)"
+		lines = append(lines, header+ansi.Color(truncate(help, width-len(d.focus.host.Name)-len(msg)-2), d.colors.Summary))
+		d.scroll = min(d.scroll, max(len(d.focus.lines)-page, 0))
+		end := len(d.focus.lines) - d.scroll
+		for _, line := range d.focus.lines[max(end-page, 0):end] {
+			lines = append(lines, d.formatLine(line, width))
+		}
+	} else {
+		lines = append(lines, ansi.Color(truncate("  (up/down/pgup/pgdn: select host, enter: show all output, ctrl-c: interrupt)", width), d.colors.Summary))
+		if d.cursor < d.offset {
+			d.offset = d.cursor
+		} else if d.cursor >= d.offset+page {
+			d.offset = d.cursor - page + 1
+		}
+		d.offset = max(min(d.offset, len(d.hosts)-page), 0)
+		nameLen := min(d.nameLen, width/2)
+		for n := 0; n < page && d.offset+n < len(d.hosts); n++ {
+			h := d.hosts[d.offset+n]
+			name := fmt.Sprintf("%-*s", nameLen, truncate(h.host.Name, nameLen))
+			if d.offset+n == d.cursor {
+				name = "\033[7m" + name + "\033[0m"
+			}
+			msg, color := d.describe(h, now)
+			lines = append(lines, name+"  "+ansi.Color(truncate(msg, width-nameLen-2), color))
+			tail := h.lines[max(len(h.lines)-dashboardTailLines, 0):]
+			for i := range dashboardTailLines {
+				if i < len(tail) {
+					lines = append(lines, d.formatLine(tail[i], width))
+				} else {
+					lines = append(lines, "")
+				}
+			}
+		}
+	}
+	return "\033[H" + strings.Join(lines, "\033[K\r\n") + "\033[K\033[J"
+}
+
+// dashboardProgressChannel shows a live, full-screen overview of all hosts
+// while a command runs. The output channel, if any, was created first so
+// output and progress can be handled by a single goroutine. Without a
+// terminal, we fall back to grouped output for this run only.
+func (ui *SimpleUI) dashboardProgressChannel(deadline time.Time) chan ProgressMessage {
+	oc := ui.pendingOutput
+	ui.pendingOutput = nil
+
+	// Make sure nothing is printed on top of the dashboard
+	ui.pchan <- outputMessage{outputMessageHold, ""}
+	ui.Sync()
+	t, err := openTerminal(nil, nil)
+	if err != nil {
+		ui.pchan <- outputMessage{outputMessageRelease, ""}
+		logrus.Warnf("Can't show the dashboard: %s, showing grouped output instead", err)
+		if oc != nil {
+			ui.consumers.Add(1)
+			go func() {
+				defer ui.consumers.Done()
+				for range oc {
+				}
+			}()
+		}
+		return ui.progressChannel(deadline, OutputGrouped)
+	}
+
+	pc := make(chan ProgressMessage)
+	d := newDashboard(ui.hosts.hosts, deadline, ui.formatter, ui.colors)
+	ui.consumers.Add(1)
+	go func() {
+		defer ui.consumers.Done()
+		keys := make(chan []byte)
+		done := make(chan struct{})
+		go func() {
+			buf := make([]byte, 256)
+			for {
+				n, err := t.in.Read(buf)
+				if err != nil {
+					return
+				}
+				select {
+				case keys <- bytes.Clone(buf[:n]):
+				case <-done:
+					return
+				}
+			}
+		}()
+		ticker := time.NewTicker(time.Second / 4)
+		defer ticker.Stop()
+		redraw := func() {
+			width, height := t.size(ui.width, ui.height)
+			_, _ = t.out.WriteString(d.render(width, height, time.Now()))
+		}
+		// Hide the cursor while the dashboard is shown
+		_, _ = t.out.WriteString("\033[?25l")
+		redraw()
+
+		pc := pc
+		for pc != nil || oc != nil {
+			select {
+			case line, ok := <-oc:
+				if !ok {
+					oc = nil
+					continue
+				}
+				d.output(line)
+			case msg, ok := <-pc:
+				if !ok {
+					pc = nil
+					continue
+				}
+				d.progress(msg)
+			case input := <-keys:
+				_, height := t.size(ui.width, ui.height)
+				for _, k := range parseKeys(input) {
+					if d.handleKey(k, height) && ui.interrupt != nil {
+						logrus.Errorf("Interrupted, canceling with unfinished tasks")
+						ui.interrupt()
+					}
+				}
+				redraw()
+			case <-ticker.C:
+				redraw()
+			}
+		}
+
+		close(done)
+		_, _ = t.out.WriteString("\033[?25h")
+		t.Close()
+		ui.pchan <- outputMessage{outputMessageRelease, ""}
+		if logrus.IsLevelEnabled(logrus.InfoLevel) {
+			ui.pchan <- outputMessage{outputMessageProgress, d.status(time.Now()) + "\n"}
+			ui.pchan <- outputMessage{outputMessageProgress, ""}
+		}
+	}()
+	return pc
+}
@@ -0,0 +1,130 @@
+package herd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	hosts := []*Host{}
+	for _, name := range []string{"web-01", "web-02", "web-03", "web-04", "web-05"} {
+		hosts = append(hosts, NewHost(name, "", HostAttributes{}))
+	}
+	d := newDashboard(hosts, time.Now().Add(time.Minute), newPrettyFormatter(ColorConfig{}), ColorConfig{})
+	now := time.Now()
+	end := now.Add(3 * time.Second)
+
+	d.progress(ProgressMessage{Host: hosts[0], State: Running})
+	d.progress(ProgressMessage{Host: hosts[0], State: Finished, Result: &Result{Host: "web-01", StartTime: now, EndTime: end, ExitSuccess: true}})
+	d.progress(ProgressMessage{Host: hosts[1], State: Running})
+	d.progress(ProgressMessage{Host: hosts[1], State: Retrying, Result: &Result{Host: "web-02", ExitStatus: -1, Err: errors.New("connection refused")}})
+	d.progress(ProgressMessage{Host: hosts[1], State: Running})
+	d.progress(ProgressMessage{Host: hosts[2], State: Running})
+	for _, line := range []string{"one\n", "two\n", "\033[32mthree\033[0m\r\n", "10%\r50%\r100%\n"} {
+		d.output(OutputLine{Host: hosts[2], Data: []byte(line)})
+	}
+	d.output(OutputLine{Host: hosts[2], Data: []byte("oops\n"), Stderr: true})
+
+	status := d.status(now)
+	if !strings.Contains(status, "1/5 done, 2 queued, 2 in progress, 1 ok, 0 fail, 0 error") {
+		t.Errorf("Unexpected status: %s", status)
+	}
+
+	// With a height of 8, two hosts with two lines of output fit on the screen
+	screen := d.render(80, 8, now)
+	for _, expected := range []string{"\033[7mweb-01\033[0m  completed successfully after 3s", "web-02  running for", ", attempt 2"} {
+		if !strings.Contains(screen, expected) {
+			t.Errorf("%q should be visible: %q", expected, screen)
+		}
+	}
+	if strings.Contains(screen, "web-03") {
+		t.Errorf("web-03 should not be visible: %q", screen)
+	}
+
+	// Scrolling down shows the last lines of output, without colors and
+	// progress bars
+	d.handleKey(keyPress{key: keyDown}, 8)
+	d.handleKey(keyPress{key: keyDown}, 8)
+	screen = d.render(80, 8, now)
+	if !strings.Contains(screen, "\033[7mweb-03\033[0m") || !strings.Contains(screen, "    100%\033[K\r\n    oops") {
+		t.Errorf("Expected the tail of web-03's output: %q", screen)
+	}
+	if strings.Contains(screen, "two") || strings.Contains(screen, "web-01") {
+		t.Errorf("Only the last two lines should be visible: %q", screen)
+	}
+
+	// Focusing shows all output, and follows it unless scrolled back
+	d.handleKey(keyPress{key: keyAccept}, 8)
+	screen = d.render(80, 8, now)
+	if !strings.Contains(screen, "    one\033[K\r\n    two\033[K\r\n    three\033[K\r\n    100%\033[K\r\n    oops") {
+		t.Errorf("Expected all of web-03's output: %q", screen)
+	}
+	for _, line := range []string{"four\n", "five\n", "six\n", "seven\n"} {
+		d.output(OutputLine{Host: hosts[2], Data: []byte(line)})
+	}
+	if screen = d.render(80, 8, now); strings.Contains(screen, "    one") || !strings.Contains(screen, "seven") {
+		t.Errorf("The focused view should follow the output: %q", screen)
+	}
+	d.handleKey(keyPress{key: keyHome}, 8)
+	d.output(OutputLine{Host: hosts[2], Data: []byte("eight\n")})
+	if screen = d.render(80, 8, now); !strings.Contains(screen, "    one") || strings.Contains(screen, "seven") {
+		t.Errorf("The focused view should stay at the top: %q", screen)
+	}
+	d.handleKey(keyPress{key: keyCancel}, 8)
+	if d.focus != nil {
+		t.Errorf("Escape should go back to the host list")
+	}
+
+	if d.handleKey(keyPress{key: keyUp}, 8) || !d.handleKey(keyPress{key: keyInterrupt}, 8) {
+		t.Errorf("Only ctrl-c should interrupt")
+	}
+
+	for _, host := range hosts[1:] {
+		d.progress(ProgressMessage{Host: host, State: Finished, Result: &Result{Host: host.Name, ExitStatus: 1}})
+	}
+	if status = d.status(d.start.Add(time.Minute)); status != "5 done, 1 ok, 4 fail, 0 error in 1m0s" {
+		t.Errorf("Unexpected status: %s", status)
+	}
+}
+
+func TestDashboardFallback(t *testing.T) {
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		tty.Close()
+		t.Skip("A terminal is available, the dashboard would be shown")
+	}
+	out, err := os.Create(filepath.Join(t.TempDir(), "output"))
+	if err != nil {
+		t.Fatalf("Unable to create output file: %s", err)
+	}
+	defer out.Close()
+	hosts := NewHostSet()
+	hosts.AddHost(NewHost("web-01", "", HostAttributes{}))
+	ui := &SimpleUI{
+		hosts:      hosts,
+		output:     out,
+		outputMode: OutputDashboard,
+		formatter:  newPrettyFormatter(ColorConfig{}),
+		pchan:      make(chan outputMessage, 100),
+		syncCond:   &sync.Cond{L: new(sync.Mutex)},
+	}
+	go ui.printer()
+	for i := 0; i < 2; i++ {
+		oc := ui.OutputChannel()
+		pc := ui.ProgressChannel(time.Now().Add(time.Minute))
+		oc <- OutputLine{Host: hosts.Get(0), Data: []byte("hello\n")}
+		close(oc)
+		if pc != nil {
+			close(pc)
+		}
+		ui.Sync()
+		if ui.outputMode != OutputDashboard {
+			t.Fatalf("Output mode changed to %s after falling back", outputModeString[ui.outputMode])
+		}
+	}
+	ui.End()
+}
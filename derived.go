@@ -0,0 +1,76 @@
+package herd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// A derivedAttribute is an attribute that is computed from other attributes
+// once all hosts are loaded. Its value is either a regex(attribute, "pattern")
+// expression, which uses the first capture group of the pattern, or a
+// template that is executed for each host.
+type derivedAttribute struct {
+	name      string
+	attribute string
+	regex     *regexp.Regexp
+	template  *template.Template
+}
+
+var derivedRegex = regexp.MustCompile(`^regex\(\s*([^,\s]+)\s*,\s*"((?:[^"\\]|\\.)*)"\s*\)$`)
+
+func newDerivedAttribute(name, value string) (*derivedAttribute, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Derived attributes need a name")
+	}
+	d := &derivedAttribute{name: name}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "regex(") {
+		m := derivedRegex.FindStringSubmatch(value)
+		if m == nil {
+			return nil, fmt.Errorf("Invalid value for derived attribute %s, expected regex(attribute, \"pattern\"): %s", name, value)
+		}
+		// Backslashes are regex escapes, only quotes need unescaping
+		re, err := regexp.Compile(strings.ReplaceAll(m[2], `\"`, `"`))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regexp for derived attribute %s: %s", name, err)
+		}
+		d.attribute, d.regex = m[1], re
+		return d, nil
+	}
+	// Missing attributes are an error, so hosts that don't have them don't
+	// get the derived attribute either
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template for derived attribute %s: %s", name, err)
+	}
+	d.template = tmpl
+	return d, nil
+}
+
+// apply sets the attribute on the host, unless the host is missing the
+// attributes it is derived from, or they don't match the regex
+func (d *derivedAttribute) apply(h *Host) {
+	if d.regex != nil {
+		value, ok := h.GetAttribute(d.attribute)
+		if !ok {
+			return
+		}
+		m := d.regex.FindStringSubmatch(fmt.Sprintf("%v", value))
+		if m == nil {
+			return
+		}
+		if len(m) > 1 {
+			h.Attributes[d.name] = m[1]
+		} else {
+			h.Attributes[d.name] = m[0]
+		}
+		return
+	}
+	var sb strings.Builder
+	if err := d.template.Execute(&sb, h); err != nil || sb.Len() == 0 {
+		return
+	}
+	h.Attributes[d.name] = sb.String()
+}
@@ -0,0 +1,39 @@
+package herd
+
+import (
+	"testing"
+)
+
+func TestDerivedAttributes(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected any
+		err      string
+	}{
+		{`regex(name, "^\w+\.(\w+)\.")`, "ams1", ""},
+		{`regex(name, "^web")`, "web", ""},
+		{`regex(name, "^db")`, nil, ""},
+		{`regex(os.release, "^(\d+)\.")`, "12", ""},
+		{`regex(missing, ".*")`, nil, ""},
+		{`regex(role, "\"(\w+)\"")`, "web", ""},
+		{`{{ .Attributes.role }}-{{ index .Attributes.os "release" }}`, `"web"-12.5`, ""},
+		{`{{ .Attributes.missing }}`, nil, ""},
+		{`regex(name, "(")`, nil, "Invalid regexp for derived attribute derived: error parsing regexp: missing closing ): `(`"},
+		{`regex(name)`, nil, `Invalid value for derived attribute derived, expected regex(attribute, "pattern"): regex(name)`},
+		{`{{ .Name `, nil, "Invalid template for derived attribute derived: template: derived:1: unclosed action"},
+	}
+	for _, test := range tests {
+		host := NewHost("web01.ams1.example.com", "", HostAttributes{"role": `"web"`, "os": map[string]any{"release": "12.5"}})
+		d, err := newDerivedAttribute("derived", test.value)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("Unexpected error for %s: %v, expected %s", test.value, err, test.err)
+		}
+		if err != nil {
+			continue
+		}
+		d.apply(host)
+		if value, ok := host.Attributes["derived"]; value != test.expected || ok != (test.expected != nil) {
+			t.Errorf("Unexpected value for %s: %v, expected %v", test.value, value, test.expected)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package herd
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -24,3 +25,42 @@ func (m *MultiError) Add(e error) {
 func (m *MultiError) HasErrors() bool {
 	return len(m.messages) > 0
 }
+
+// ErrorClass says what kind of failure prevented a command from running to
+// completion, so the runner can decide whether to retry it
+type ErrorClass string
+
+const (
+	// Failure to connect, including connect timeouts
+	ConnectError ErrorClass = "connect"
+	// Failure to authenticate
+	AuthError ErrorClass = "auth"
+	// The host timeout expired while the command was running
+	SessionTimeout ErrorClass = "timeout"
+)
+
+var ErrorClasses = []ErrorClass{ConnectError, AuthError, SessionTimeout}
+
+// ClassifiedError is an error annotated with its class by an executor
+type ClassifiedError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorClassOf returns the class of an error, or an empty string if the error
+// was not classified
+func ErrorClassOf(err error) ErrorClass {
+	var ce ClassifiedError
+	if errors.As(err, &ce) {
+		return ce.Class
+	}
+	return ""
+}
@@ -12,10 +12,14 @@ import (
 
 type formatter interface {
 	formatCommand(c string) string
-	formatSummary(ok, fail, err int) string
+	formatSummary(ok, fail, err, skipped int) string
 	formatResult(r *Result, l int) string
 	formatStatus(r *Result, l int) string
 	formatOutput(r *Result, l int) string
+	formatRetry(r *Result, l int) string
+	formatGroup(g resultGroup) string
+	formatGroupDiff(g, base resultGroup) string
+	status(r *Result) (string, string, bool)
 	Format(e *logrus.Entry) ([]byte, error)
 }
 
@@ -43,8 +47,12 @@ func (f prettyFormatter) formatCommand(command string) string {
 	return ansi.Color(command, f.colors.Command) + "\n"
 }
 
-func (f prettyFormatter) formatSummary(ok, fail, err int) string {
-	return ansi.Color(fmt.Sprintf("%d ok, %d fail, %d error", ok, fail, err), f.colors.Summary) + "\n"
+func (f prettyFormatter) formatSummary(ok, fail, err, skipped int) string {
+	summary := fmt.Sprintf("%d ok, %d fail, %d error", ok, fail, err)
+	if skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+	return ansi.Color(summary, f.colors.Summary) + "\n"
 }
 
 func (f prettyFormatter) formatResult(r *Result, l int) string {
@@ -68,7 +76,7 @@ func (f prettyFormatter) formatOutput(r *Result, l int) string {
 			prefix = ansi.Color(prefix, f.colors.HostOK)
 		} else if r.ExitStatus != -1 {
 			prefix = ansi.Color(prefix, f.colors.HostFail)
-		} else if r.Err.Error() == context.Canceled.Error() {
+		} else if r.Err.Error() == context.Canceled.Error() || r.skipped() {
 			prefix = ansi.Color(prefix, f.colors.HostCancel)
 		} else {
 			prefix = ansi.Color(prefix, f.colors.HostError)
@@ -85,19 +93,112 @@ func (f prettyFormatter) formatOutput(r *Result, l int) string {
 }
 
 func (f prettyFormatter) formatStatus(r *Result, l int) string {
+	msg, color, timed := f.status(r)
+	if timed {
+		msg += " after " + r.EndTime.Sub(r.StartTime).Truncate(time.Second).String()
+		if r.Attempts > 1 {
+			msg += fmt.Sprintf(" and %d attempts", r.Attempts)
+		}
+	}
+	return ansi.Color(fmt.Sprintf("%-*s  %s", l, r.Host, msg), color) + "\n"
+}
+
+// status describes the outcome of a command, and whether the time it took is
+// relevant
+func (f prettyFormatter) status(r *Result) (string, string, bool) {
 	if r.ExitSuccess {
 		if r.ExitStatus == 0 {
-			return ansi.Color(fmt.Sprintf("%-*s  completed successfully after %s", l, r.Host, r.EndTime.Sub(r.StartTime).Truncate(time.Second)), f.colors.HostOK) + "\n"
+			return "completed successfully", f.colors.HostOK, true
 		} else {
-			return ansi.Color(fmt.Sprintf("%-*s  completed successfully with status %d after %s", l, r.Host, r.ExitStatus, r.EndTime.Sub(r.StartTime).Truncate(time.Second)), f.colors.HostOK) + "\n"
+			return fmt.Sprintf("completed successfully with status %d", r.ExitStatus), f.colors.HostOK, true
 		}
 	} else if r.ExitStatus != -1 {
-		return ansi.Color(fmt.Sprintf("%-*s  exited with status %d after %s", l, r.Host, r.ExitStatus, r.EndTime.Sub(r.StartTime).Truncate(time.Second)), f.colors.HostFail) + "\n"
+		return fmt.Sprintf("exited with status %d", r.ExitStatus), f.colors.HostFail, true
 	} else if r.Err.Error() == context.Canceled.Error() {
-		return ansi.Color(fmt.Sprintf("%-*s  skipped due to global timeout", l, r.Host), f.colors.HostCancel) + "\n"
+		return "skipped due to global timeout", f.colors.HostCancel, false
+	} else if r.skipped() {
+		return "skipped because too many hosts failed", f.colors.HostCancel, false
 	} else {
-		return ansi.Color(fmt.Sprintf("%-*s  %s after %s", l, r.Host, r.Err, r.EndTime.Sub(r.StartTime).Truncate(time.Second)), f.colors.HostError) + "\n"
+		return r.Err.Error(), f.colors.HostError, true
+	}
+}
+
+func (f prettyFormatter) formatRetry(r *Result, l int) string {
+	return ansi.Color(fmt.Sprintf("%-*s  %s after %s, retrying", l, r.Host, r.Err, r.EndTime.Sub(r.StartTime).Truncate(time.Second)), f.colors.HostCancel) + "\n"
+}
+
+func (f prettyFormatter) formatGroup(g resultGroup) string {
+	r := g[0]
+	msg, color, _ := f.status(r)
+	out := ansi.Color(g.hostList()+"  "+msg, color) + "\n"
+	if len(r.Stdout) > 0 {
+		out += f.indent(string(r.Stdout), "    ", "    ")
 	}
+	if len(r.Stderr) != 0 {
+		out += ansi.Color("----", f.colors.Summary) + "\n" + f.indent(string(r.Stderr), "    ", "    ")
+	}
+	return out
+}
+
+// formatGroupDiff shows how the output of a group differs from the output of
+// the base group, showing only changed lines and a bit of context
+func (f prettyFormatter) formatGroupDiff(g, base resultGroup) string {
+	r, b := g[0], base[0]
+	msg, color, _ := f.status(r)
+	out := ansi.Color(g.hostList()+"  "+msg, color) + "\n"
+	stdout := f.formatDiff(string(b.Stdout), string(r.Stdout))
+	stderr := f.formatDiff(string(b.Stderr), string(r.Stderr))
+	out += stdout
+	if stderr != "" {
+		out += ansi.Color("----", f.colors.Summary) + "\n" + stderr
+	}
+	return out
+}
+
+const diffContext = 2
+
+func (f prettyFormatter) formatDiff(a, b string) string {
+	if a == b {
+		return ""
+	}
+	diff := diffLines(a, b)
+	if diff == nil {
+		return f.indent(b, "    ", "    ")
+	}
+	// Only show lines that are within diffContext lines of a change
+	show := make([]bool, len(diff))
+	for i, d := range diff {
+		if d.op == diffSame {
+			continue
+		}
+		for j := max(0, i-diffContext); j <= min(len(diff)-1, i+diffContext); j++ {
+			show[j] = true
+		}
+	}
+	out := ""
+	skipped := false
+	for i, d := range diff {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			out += ansi.Color("  ...", f.colors.Summary) + "\n"
+			skipped = false
+		}
+		switch d.op {
+		case diffSame:
+			out += "    " + d.text + "\n"
+		case diffRemoved:
+			out += ansi.Color("  - "+d.text, f.colors.HostError) + "\n"
+		case diffAdded:
+			out += ansi.Color("  + "+d.text, f.colors.HostOK) + "\n"
+		}
+	}
+	if skipped {
+		out += ansi.Color("  ...", f.colors.Summary) + "\n"
+	}
+	return out
 }
 
 func (f prettyFormatter) indent(msg, prefix, indent string) string {
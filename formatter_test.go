@@ -158,6 +158,24 @@ func TestPrettyFormatterFormatResult(t *testing.T) {
 	}
 }
 
+func TestPrettyFormatterFormatGroup(t *testing.T) {
+	groups := groupResults([]*Result{
+		{Host: "web-1", ExitSuccess: true, Stdout: []byte("a\nb\nc\nd\ne\nf\n")},
+		{Host: "web-2", ExitSuccess: true, Stdout: []byte("a\nb\nc\nd\ne\nf\n")},
+		{Host: "web-3", ExitStatus: 1, Stdout: []byte("a\nB\nc\nd\ne\nf\n"), Stderr: []byte("oops\n")},
+	})
+	expected := "\033[0;32mweb-[1-2] (2 hosts)  completed successfully\033[0m\n    a\n    b\n    c\n    d\n    e\n    f\n"
+	if s := testformatter.formatGroup(groups[0]); s != expected {
+		t.Errorf("Expected group %s, got %s", strconv.Quote(expected), strconv.Quote(s))
+	}
+	expected = "\033[0;33mweb-3  exited with status 1\033[0m\n" +
+		"    a\n\033[0;31m  - b\033[0m\n\033[0;32m  + B\033[0m\n    c\n    d\n\033[0;90m  ...\033[0m\n" +
+		"\033[0;90m----\033[0m\n\033[0;32m  + oops\033[0m\n"
+	if s := testformatter.formatGroupDiff(groups[1], groups[0]); s != expected {
+		t.Errorf("Expected diff %s, got %s", strconv.Quote(expected), strconv.Quote(s))
+	}
+}
+
 func TestIndent(t *testing.T) {
 	t.Skip("Not yet implemented")
 }
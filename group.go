@@ -0,0 +1,200 @@
+package herd
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A resultGroup is a set of results with identical exit status, output and
+// error
+type resultGroup []*Result
+
+func (g resultGroup) hostList() string {
+	names := make([]string, len(g))
+	for i, r := range g {
+		names[i] = r.Host
+	}
+	list := compactHostList(names)
+	if len(g) > 1 {
+		list += fmt.Sprintf(" (%d hosts)", len(g))
+	}
+	return list
+}
+
+// groupResults groups results with identical exit status, output and error,
+// most common first. Groups of the same size are kept in the order in which
+// their first result appears.
+func groupResults(results []*Result) []resultGroup {
+	type key struct {
+		success bool
+		status  int
+		stdout  string
+		stderr  string
+		err     string
+	}
+	index := make(map[key]int)
+	groups := []resultGroup{}
+	for _, r := range results {
+		k := key{success: r.ExitSuccess, status: r.ExitStatus, stdout: string(r.Stdout), stderr: string(r.Stderr)}
+		if r.Err != nil && r.ExitStatus == -1 {
+			k.err = r.Err.Error()
+		}
+		if i, ok := index[k]; ok {
+			groups[i] = append(groups[i], r)
+		} else {
+			index[k] = len(groups)
+			groups = append(groups, resultGroup{r})
+		}
+	}
+	slices.SortStableFunc(groups, func(a, b resultGroup) int {
+		return len(b) - len(a)
+	})
+	return groups
+}
+
+var hostNumberRx = regexp.MustCompile(`^(\D*)(\d+)(.*)$`)
+
+// compactHostList turns a list of host names into a short description, by
+// collapsing names that only differ in their first number into ranges, e.g.
+// web-[01-03,07].example.com
+func compactHostList(names []string) string {
+	type series struct {
+		prefix  string
+		suffix  string
+		width   int
+		numbers []int
+	}
+	var order []string
+	all := make(map[string]*series)
+	for _, name := range names {
+		m := hostNumberRx.FindStringSubmatch(name)
+		if m == nil {
+			order = append(order, name)
+			all[name] = nil
+			continue
+		}
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			order = append(order, name)
+			all[name] = nil
+			continue
+		}
+		// Zero-padded numbers only form a range with numbers of the same width
+		width := 0
+		if len(m[2]) > 1 && m[2][0] == '0' {
+			width = len(m[2])
+		}
+		k := fmt.Sprintf("%s\x00%s\x00%d", m[1], m[3], width)
+		s, ok := all[k]
+		if !ok {
+			s = &series{prefix: m[1], suffix: m[3], width: width}
+			all[k] = s
+			order = append(order, k)
+		}
+		s.numbers = append(s.numbers, n)
+	}
+
+	parts := make([]string, 0, len(order))
+	for _, k := range order {
+		s := all[k]
+		if s == nil {
+			parts = append(parts, k)
+			continue
+		}
+		if len(s.numbers) == 1 {
+			parts = append(parts, fmt.Sprintf("%s%0*d%s", s.prefix, s.width, s.numbers[0], s.suffix))
+			continue
+		}
+		slices.Sort(s.numbers)
+		s.numbers = slices.Compact(s.numbers)
+		ranges := []string{}
+		for i := 0; i < len(s.numbers); i++ {
+			j := i
+			for j+1 < len(s.numbers) && s.numbers[j+1] == s.numbers[j]+1 {
+				j++
+			}
+			if j == i {
+				ranges = append(ranges, fmt.Sprintf("%0*d", s.width, s.numbers[i]))
+			} else {
+				ranges = append(ranges, fmt.Sprintf("%0*d-%0*d", s.width, s.numbers[i], s.width, s.numbers[j]))
+			}
+			i = j
+		}
+		parts = append(parts, fmt.Sprintf("%s[%s]%s", s.prefix, strings.Join(ranges, ","), s.suffix))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type diffOp int
+
+const (
+	diffSame diffOp = iota
+	diffRemoved
+	diffAdded
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// Outputs larger than this many lines, multiplied, are not diffed
+const maxDiffSize = 4_000_000
+
+// diffLines makes a line-based diff between two texts, using the longest
+// common subsequence of lines. It returns nil if the texts are too large to
+// diff.
+func diffLines(a, b string) []diffLine {
+	al := splitLines(a)
+	bl := splitLines(b)
+	if len(al)*len(bl) > maxDiffSize {
+		return nil
+	}
+	// lcs[i][j] is the length of the longest common subsequence of al[i:] and bl[j:]
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	diff := make([]diffLine, 0, len(al)+len(bl))
+	i, j := 0, 0
+	for i < len(al) && j < len(bl) {
+		switch {
+		case al[i] == bl[j]:
+			diff = append(diff, diffLine{diffSame, al[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, diffLine{diffRemoved, al[i]})
+			i++
+		default:
+			diff = append(diff, diffLine{diffAdded, bl[j]})
+			j++
+		}
+	}
+	for ; i < len(al); i++ {
+		diff = append(diff, diffLine{diffRemoved, al[i]})
+	}
+	for ; j < len(bl); j++ {
+		diff = append(diff, diffLine{diffAdded, bl[j]})
+	}
+	return diff
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
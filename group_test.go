@@ -0,0 +1,63 @@
+package herd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGroupResults(t *testing.T) {
+	rs := []*Result{
+		{Host: "a", ExitSuccess: true, Stdout: []byte("ok\n")},
+		{Host: "b", ExitStatus: 1, Stdout: []byte("ok\n")},
+		{Host: "c", ExitSuccess: true, Stdout: []byte("ok\n")},
+		{Host: "d", ExitStatus: -1, Err: errors.New("Timed out while connecting to server")},
+		{Host: "e", ExitStatus: -1, Err: errors.New("ssh: handshake failed")},
+		{Host: "f", ExitStatus: 1, Stdout: []byte("ok\n")},
+		{Host: "g", ExitSuccess: true, Stdout: []byte("ok\n"), Stderr: []byte("warning\n")},
+	}
+	groups := groupResults(rs)
+	got := []string{}
+	for _, g := range groups {
+		hosts := ""
+		for _, r := range g {
+			hosts += r.Host
+		}
+		got = append(got, hosts)
+	}
+	if strings.Join(got, " ") != "ac bf d e g" {
+		t.Errorf("Unexpected groups: %v", got)
+	}
+}
+
+func TestCompactHostList(t *testing.T) {
+	tests := []struct {
+		names    []string
+		expected string
+	}{
+		{[]string{"web-1.example.com"}, "web-1.example.com"},
+		{[]string{"web-1.example.com", "web-2.example.com", "web-3.example.com", "web-7.example.com"}, "web-[1-3,7].example.com"},
+		{[]string{"web-01", "web-02", "web-10", "db-1", "web-9"}, "web-[01-02], web-[9-10], db-1"},
+		{[]string{"localhost", "web-2.example.com", "web-1.example.com"}, "localhost, web-[1-2].example.com"},
+		{[]string{"node1.rack2.example.com", "node2.rack2.example.com"}, "node[1-2].rack2.example.com"},
+	}
+	for _, test := range tests {
+		if got := compactHostList(test.names); got != test.expected {
+			t.Errorf("Expected %q for %v, got %q", test.expected, test.names, got)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	diff := diffLines("a\nb\nc\nd\n", "a\nc\nd\ne\n")
+	got := ""
+	for _, d := range diff {
+		got += []string{" ", "-", "+"}[d.op] + d.text + "\n"
+	}
+	if got != " a\n-b\n c\n d\n+e\n" {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+	if diff := diffLines("", "a\n"); len(diff) != 1 || diff[0].op != diffAdded {
+		t.Errorf("Unexpected diff: %v", diff)
+	}
+}
@@ -2,6 +2,7 @@ package herd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,9 +17,10 @@ type HistoryItem struct {
 	Command string
 	Results []*Result
 	Summary struct {
-		Ok   int
-		Fail int
-		Err  int
+		Ok      int
+		Fail    int
+		Err     int
+		Skipped int
 	}
 	StartTime         time.Time
 	EndTime           time.Time
@@ -36,12 +38,24 @@ type Result struct {
 	StartTime   time.Time
 	EndTime     time.Time
 	ElapsedTime float64
+	Transfers   []Transfer
+	Attempts    int
 	index       int
 }
 
+// Transfer records a single file copied to or from a host, with the sha256
+// checksum of its contents
+type Transfer struct {
+	Source      string
+	Destination string
+	Size        int64
+	Sha256      string
+}
+
 type resultx struct {
 	Host        string
 	ExitStatus  int
+	ExitSuccess *bool `json:",omitempty"`
 	Stdout      string
 	Stderr      string
 	Err         any
@@ -49,6 +63,8 @@ type resultx struct {
 	StartTime   time.Time
 	EndTime     time.Time
 	ElapsedTime float64
+	Transfers   []Transfer `json:",omitempty"`
+	Attempts    int        `json:",omitempty"`
 }
 
 func newHistoryItem(command string, nhosts int) *HistoryItem {
@@ -63,6 +79,7 @@ func (h *HistoryItem) MarshalJSON() ([]byte, error) {
 	r := map[string]any{
 		"Command":     h.Command,
 		"Results":     h.Results,
+		"Summary":     h.Summary,
 		"StartTime":   h.StartTime,
 		"EndTime":     h.EndTime,
 		"ElapsedTime": h.ElapsedTime,
@@ -79,6 +96,7 @@ func (r Result) MarshalJSON() ([]byte, error) {
 	r_ := resultx{
 		Host:        r.Host,
 		ExitStatus:  r.ExitStatus,
+		ExitSuccess: &r.ExitSuccess,
 		Stdout:      string(r.Stdout),
 		Stderr:      string(r.Stderr),
 		Err:         r.Err,
@@ -86,6 +104,8 @@ func (r Result) MarshalJSON() ([]byte, error) {
 		StartTime:   r.StartTime,
 		EndTime:     r.EndTime,
 		ElapsedTime: r.ElapsedTime,
+		Transfers:   r.Transfers,
+		Attempts:    r.Attempts,
 	}
 	if r.Err != nil {
 		r_.ErrString = r.Err.Error()
@@ -100,14 +120,32 @@ func (r *Result) UnmarshalJSON(data []byte) error {
 	}
 	r.Host = r_.Host
 	r.ExitStatus = r_.ExitStatus
+	// Older history files did not record this
+	if r_.ExitSuccess != nil {
+		r.ExitSuccess = *r_.ExitSuccess
+	} else {
+		r.ExitSuccess = r.ExitStatus == 0
+	}
+	if r_.ErrString == (SkippedError{}).Error() {
+		r.Err = SkippedError{}
+	} else if r_.ErrString != "" {
+		r.Err = errors.New(r_.ErrString)
+	}
 	r.Stdout = []byte(r_.Stdout)
 	r.Stderr = []byte(r_.Stderr)
 	r.StartTime = r_.StartTime
 	r.EndTime = r_.EndTime
 	r.ElapsedTime = r_.ElapsedTime
+	r.Transfers = r_.Transfers
+	r.Attempts = r_.Attempts
 	return nil
 }
 
+func (r *Result) skipped() bool {
+	_, ok := r.Err.(SkippedError)
+	return ok
+}
+
 func (r Result) String() string {
 	return fmt.Sprintf("[%s] (Err: %s)]\n%s\n---\n%s\n", r.Host, r.Err, string(r.Stdout), string(r.Stderr))
 }
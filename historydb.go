@@ -0,0 +1,274 @@
+package herd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	historyItemsBucket = []byte("items")
+	historyHostsBucket = []byte("hosts")
+	historyTimeBucket  = []byte("time")
+)
+
+// HistoryDB is a local database of all commands run, and their results. Runs
+// are indexed by host and by start time, so they can be found quickly.
+type HistoryDB struct {
+	db *bbolt.DB
+}
+
+// HistoryEntry is a HistoryItem as stored in the database, with its id
+type HistoryEntry struct {
+	Id   uint64
+	Item *HistoryItem
+}
+
+// HistoryQuery describes which runs to find in the database. Zero values
+// match everything.
+type HistoryQuery struct {
+	// Substring of the command
+	Command string
+	// Glob of host names, only runs that included matching hosts are found
+	Host string
+	// Only runs where (matching) hosts exited with this status are found
+	ExitStatus *int
+	Since      time.Time
+	Until      time.Time
+	// Maximum number of runs to return, newest first
+	Limit int
+}
+
+func OpenHistoryDB(path string) (*HistoryDB, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open history database %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{historyItemsBucket, historyHostsBucket, historyTimeBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &HistoryDB{db: db}, nil
+}
+
+func (d *HistoryDB) Close() error {
+	return d.db.Close()
+}
+
+// Add stores a history item, returning its id
+func (d *HistoryDB) Add(hi *HistoryItem) (uint64, error) {
+	var id uint64
+	data, err := json.Marshal(hi)
+	if err != nil {
+		return 0, err
+	}
+	err = d.db.Update(func(tx *bbolt.Tx) error {
+		items := tx.Bucket(historyItemsBucket)
+		id, _ = items.NextSequence()
+		key := itob(id)
+		if err := items.Put(key, data); err != nil {
+			return err
+		}
+		hosts := tx.Bucket(historyHostsBucket)
+		for _, r := range hi.Results {
+			if err := hosts.Put(append([]byte(r.Host+"\x00"), key...), nil); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(historyTimeBucket).Put(append(itob(uint64(hi.StartTime.UnixNano())), key...), nil) // #nosec G115 -- We don't store runs from before 1970
+	})
+	return id, err
+}
+
+func (d *HistoryDB) Get(id uint64) (*HistoryItem, error) {
+	var hi *HistoryItem
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(historyItemsBucket).Get(itob(id))
+		if data == nil {
+			return fmt.Errorf("No history item with id %d", id)
+		}
+		var err error
+		hi, err = decodeHistoryItem(data)
+		return err
+	})
+	return hi, err
+}
+
+// Search finds all runs matching the query, newest first
+func (d *HistoryDB) Search(q HistoryQuery) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		var hostIds map[uint64]bool
+		if q.Host != "" {
+			hostIds = make(map[uint64]bool)
+			c := tx.Bucket(historyHostsBucket).Cursor()
+			// Without glob characters, we can seek to the right host
+			prefix := []byte{}
+			if !strings.ContainsAny(q.Host, "*?[\\") {
+				prefix = []byte(q.Host + "\x00")
+			}
+			for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+				host := string(k[:len(k)-9])
+				if ok, _ := filepath.Match(q.Host, host); ok {
+					hostIds[binary.BigEndian.Uint64(k[len(k)-8:])] = true
+				}
+			}
+		}
+
+		items := tx.Bucket(historyItemsBucket)
+		c := tx.Bucket(historyTimeBucket).Cursor()
+		var k []byte
+		if q.Until.IsZero() {
+			k, _ = c.Last()
+		} else if k, _ = c.Seek(itob(uint64(q.Until.UnixNano()))); k == nil { // #nosec G115 -- We don't store runs from before 1970
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+		for ; k != nil; k, _ = c.Prev() {
+			if !q.Since.IsZero() && binary.BigEndian.Uint64(k[:8]) < uint64(q.Since.UnixNano()) { // #nosec G115 -- We don't store runs from before 1970
+				break
+			}
+			id := binary.BigEndian.Uint64(k[8:])
+			if hostIds != nil && !hostIds[id] {
+				continue
+			}
+			hi, err := decodeHistoryItem(items.Get(k[8:]))
+			if err != nil {
+				return err
+			}
+			if !q.matches(hi) {
+				continue
+			}
+			entries = append(entries, HistoryEntry{Id: id, Item: hi})
+			if q.Limit > 0 && len(entries) == q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// FilterHosts selects the hosts that were part of a past run, and sets their
+// LastResult to the result of that run. The spec is the run, either its id,
+// "last" or "last-N" for the run N runs before the last, optionally followed
+// by a colon and which hosts to select: all (the default), ok, failed, error
+// or skipped. Failed hosts include hosts with errors and skipped hosts.
+func (d *HistoryDB) FilterHosts(spec string, hs *HostSet) (*HostSet, error) {
+	run, which, _ := strings.Cut(spec, ":")
+	var hi *HistoryItem
+	if run == "last" || strings.HasPrefix(run, "last-") {
+		n := 0
+		if run != "last" {
+			var err error
+			if n, err = strconv.Atoi(run[5:]); err != nil || n < 0 {
+				return nil, fmt.Errorf("Invalid history run: %s", run)
+			}
+		}
+		entries, err := d.Search(HistoryQuery{Limit: n + 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) <= n {
+			return nil, fmt.Errorf("Fewer than %d runs in the history", n+1)
+		}
+		hi = entries[n].Item
+	} else {
+		id, err := strconv.ParseUint(run, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid history run: %s", run)
+		}
+		if hi, err = d.Get(id); err != nil {
+			return nil, err
+		}
+	}
+
+	selectors := map[string]func(*Result) bool{
+		"":        func(*Result) bool { return true },
+		"all":     func(*Result) bool { return true },
+		"ok":      func(r *Result) bool { return r.ExitSuccess },
+		"failed":  func(r *Result) bool { return !r.ExitSuccess },
+		"error":   func(r *Result) bool { return r.ExitStatus == -1 && !r.skipped() },
+		"skipped": func(r *Result) bool { return r.skipped() },
+	}
+	selector, ok := selectors[which]
+	if !ok {
+		return nil, fmt.Errorf("Unknown selection: %s. Known selections: all, ok, failed, error, skipped", which)
+	}
+
+	selected := make(map[string]*Result)
+	for _, r := range hi.Results {
+		if selector(r) {
+			selected[r.Host] = r
+		}
+	}
+	return hs.Filter(func(h *Host) bool {
+		r, ok := selected[h.Name]
+		if ok {
+			h.LastResult = r
+		}
+		return ok
+	}), nil
+}
+
+func (q HistoryQuery) matches(hi *HistoryItem) bool {
+	if q.Command != "" && !strings.Contains(hi.Command, q.Command) {
+		return false
+	}
+	if q.ExitStatus == nil {
+		return true
+	}
+	for _, r := range hi.Results {
+		if ok, _ := filepath.Match(q.Host, r.Host); (q.Host == "" || ok) && r.ExitStatus == *q.ExitStatus {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeHistoryItem(data []byte) (*HistoryItem, error) {
+	hi := &HistoryItem{}
+	if err := json.Unmarshal(data, hi); err != nil {
+		return nil, err
+	}
+	// Older history files did not record the summary
+	recount := hi.Summary.Ok+hi.Summary.Fail+hi.Summary.Err+hi.Summary.Skipped == 0
+	for _, r := range hi.Results {
+		hi.maxHostNameLength = max(hi.maxHostNameLength, len(r.Host))
+		if !recount {
+			continue
+		}
+		switch {
+		case r.skipped():
+			hi.Summary.Skipped++
+		case r.ExitStatus == -1:
+			hi.Summary.Err++
+		case r.ExitSuccess:
+			hi.Summary.Ok++
+		default:
+			hi.Summary.Fail++
+		}
+	}
+	return hi, nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
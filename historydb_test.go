@@ -0,0 +1,162 @@
+package herd
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryDB(t *testing.T) {
+	db, err := OpenHistoryDB(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Unable to open database: %s", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	items := []*HistoryItem{
+		{Command: "uptime", StartTime: start, Results: []*Result{
+			{Host: "web-1.example.com", ExitSuccess: true},
+			{Host: "db-1.example.com", ExitSuccess: true},
+		}},
+		{Command: "dpkg -l bash", StartTime: start.Add(time.Hour), Results: []*Result{
+			{Host: "web-1.example.com", ExitStatus: 1, Err: errors.New("Process exited with status 1")},
+		}},
+		{Command: "uptime --since", StartTime: start.Add(24 * time.Hour), Results: []*Result{
+			{Host: "db-1.example.com", ExitSuccess: true},
+			{Host: "db-2.example.com", ExitStatus: -1, Err: SkippedError{}},
+		}},
+	}
+	for i, hi := range items {
+		id, err := db.Add(hi)
+		if err != nil {
+			t.Fatalf("Unable to add history item: %s", err)
+		}
+		if id != uint64(i+1) {
+			t.Errorf("Expected id %d, got %d", i+1, id)
+		}
+	}
+
+	one := 1
+	tests := []struct {
+		query HistoryQuery
+		ids   []uint64
+	}{
+		{HistoryQuery{}, []uint64{3, 2, 1}},
+		{HistoryQuery{Limit: 2}, []uint64{3, 2}},
+		{HistoryQuery{Command: "uptime"}, []uint64{3, 1}},
+		{HistoryQuery{Host: "web-1.example.com"}, []uint64{2, 1}},
+		{HistoryQuery{Host: "db-*"}, []uint64{3, 1}},
+		{HistoryQuery{Host: "db-2*", Command: "dpkg"}, []uint64{}},
+		{HistoryQuery{ExitStatus: &one}, []uint64{2}},
+		{HistoryQuery{Host: "db-*", ExitStatus: &one}, []uint64{}},
+		{HistoryQuery{Since: start.Add(time.Minute)}, []uint64{3, 2}},
+		{HistoryQuery{Until: start.Add(2 * time.Hour)}, []uint64{2, 1}},
+		{HistoryQuery{Since: start.Add(time.Minute), Until: start.Add(2 * time.Hour)}, []uint64{2}},
+	}
+	for _, test := range tests {
+		entries, err := db.Search(test.query)
+		if err != nil {
+			t.Errorf("Unexpected error for %+v: %s", test.query, err)
+			continue
+		}
+		ids := make([]uint64, len(entries))
+		for i, e := range entries {
+			ids[i] = e.Id
+		}
+		if len(ids) != len(test.ids) {
+			t.Errorf("Expected %v for %+v, got %v", test.ids, test.query, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != test.ids[i] {
+				t.Errorf("Expected %v for %+v, got %v", test.ids, test.query, ids)
+				break
+			}
+		}
+	}
+
+	hi, err := db.Get(3)
+	if err != nil {
+		t.Fatalf("Unable to get history item: %s", err)
+	}
+	if hi.Command != "uptime --since" || len(hi.Results) != 2 || hi.maxHostNameLength != 16 {
+		t.Errorf("Unexpected history item: %+v", hi)
+	}
+	if !hi.Results[0].ExitSuccess || !hi.Results[1].skipped() {
+		t.Errorf("Results not restored correctly: %+v %+v", hi.Results[0], hi.Results[1])
+	}
+	if _, err := db.Get(4); err == nil {
+		t.Errorf("Expected an error for a nonexistent item")
+	}
+}
+
+func TestHistoryDBFilterHosts(t *testing.T) {
+	db, err := OpenHistoryDB(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Unable to open database: %s", err)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	for i, results := range [][]*Result{
+		{
+			{Host: "host-1", ExitSuccess: true},
+			{Host: "host-2", ExitStatus: 1},
+		},
+		{
+			{Host: "host-1", ExitStatus: 2},
+			{Host: "host-2", ExitStatus: -1, Err: errors.New("Timed out while connecting to server")},
+			{Host: "host-3", ExitStatus: -1, Err: SkippedError{}},
+			{Host: "host-4", ExitSuccess: true},
+		},
+	} {
+		if _, err := db.Add(&HistoryItem{Command: "true", StartTime: start.Add(time.Duration(i) * time.Minute), Results: results}); err != nil {
+			t.Fatalf("Unable to add history item: %s", err)
+		}
+	}
+
+	tests := []struct {
+		spec  string
+		hosts []string
+		err   bool
+	}{
+		{"last", []string{"host-1", "host-2", "host-3", "host-4"}, false},
+		{"last:failed", []string{"host-1", "host-2", "host-3"}, false},
+		{"last:error", []string{"host-2"}, false},
+		{"last:skipped", []string{"host-3"}, false},
+		{"last-1:ok", []string{"host-1"}, false},
+		{"1:failed", []string{"host-2"}, false},
+		{"2:all", []string{"host-1", "host-2", "host-3", "host-4"}, false},
+		{"last-2", nil, true},
+		{"3", nil, true},
+		{"yesterday", nil, true},
+		{"last:broken", nil, true},
+	}
+	for _, test := range tests {
+		hosts := NewHostSet()
+		for _, name := range []string{"host-1", "host-2", "host-3", "host-4", "host-5"} {
+			hosts.AddHost(NewHost(name, "", HostAttributes{}))
+		}
+		hs, err := db.FilterHosts(test.spec, hosts)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error status: %v", test.spec, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		names := []string{}
+		for _, h := range hs.hosts {
+			names = append(names, h.Name)
+			if h.LastResult == nil || h.LastResult.Host != h.Name {
+				t.Errorf("%s: LastResult not set for %s", test.spec, h.Name)
+			}
+		}
+		if strings.Join(names, ",") != strings.Join(test.hosts, ",") {
+			t.Errorf("%s: expected %v, got %v", test.spec, test.hosts, names)
+		}
+	}
+}
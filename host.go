@@ -8,7 +8,9 @@ import (
 	"hash/crc32"
 	"io"
 	"path/filepath"
+	"reflect"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -28,6 +30,39 @@ func (h HostAttributes) prefix(prefix string) HostAttributes {
 	return ret
 }
 
+// NormalizeValue turns values decoded from yaml or json into the types
+// providers use for attributes: maps with string keys, and int64 or float64
+// numbers. Maps with string keys and slices are changed in place.
+func NormalizeValue(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprintf("%v", k)] = NormalizeValue(e)
+		}
+		return m
+	case map[string]any:
+		for k, e := range v {
+			v[k] = NormalizeValue(e)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = NormalizeValue(e)
+		}
+		return v
+	case int:
+		return int64(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
 // Host represents a remote host. It can be instantiated manually, but is
 // usually fetched from one or more Providers, which can all contribute to the
 // hosts attributes.
@@ -38,9 +73,24 @@ type Host struct {
 	Connection io.Closer `yaml:"-" json:"-"`
 	LastResult *Result   `yaml:",omitempty" json:",omitempty"`
 	publicKeys []ssh.PublicKey
+	sshfp      []SSHFP
 	csum       uint32
 }
 
+// SSHFP is the fingerprint of a host key, as published in SSHFP records in
+// DNS. Unlike public keys, fingerprints cannot be used to negotiate host key
+// algorithms, but the SSH client accepts keys that match them if
+// VerifyHostKeyDNS is enabled.
+type SSHFP struct {
+	Algorithm   uint8
+	Type        uint8
+	Fingerprint string
+}
+
+func (f SSHFP) String() string {
+	return fmt.Sprintf("%d %d %s", f.Algorithm, f.Type, f.Fingerprint)
+}
+
 type host Host
 
 func (h *Host) UnmarshalJSON(data []byte) error {
@@ -51,19 +101,15 @@ func (h *Host) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	for k, v := range h2.Attributes {
-		if n, ok := v.(json.Number); ok {
-			if i, err := n.Int64(); err == nil {
-				h2.Attributes[k] = i
-			} else {
-				h2.Attributes[k], _ = n.Float64()
-			}
-		}
+		h2.Attributes[k] = NormalizeValue(v)
 	}
 	*h = Host(h2)
 	h.init()
 	return nil
 }
 
+// Public keys and fingerprints are not attributes, but are serialized as the
+// __publicKeys and __sshfp attributes so they survive caches and plugins
 func (h *Host) MarshalJSON() ([]byte, error) {
 	if len(h.publicKeys) > 0 {
 		keys := make([][]byte, len(h.publicKeys))
@@ -72,8 +118,16 @@ func (h *Host) MarshalJSON() ([]byte, error) {
 		}
 		h.Attributes["__publicKeys"] = keys
 	}
+	if len(h.sshfp) > 0 {
+		fps := make([]string, len(h.sshfp))
+		for i, fp := range h.sshfp {
+			fps[i] = fp.String()
+		}
+		h.Attributes["__sshfp"] = fps
+	}
 	data, err := json.Marshal(host(*h))
 	delete(h.Attributes, "__publicKeys")
+	delete(h.Attributes, "__sshfp")
 	return data, err
 }
 
@@ -119,6 +173,17 @@ func (h *Host) init() {
 		}
 		delete(h.Attributes, "__publicKeys")
 	}
+	if fps, ok := h.Attributes["__sshfp"]; ok {
+		for _, f := range fps.([]any) {
+			var fp SSHFP
+			if _, err := fmt.Sscanf(f.(string), "%d %d %s", &fp.Algorithm, &fp.Type, &fp.Fingerprint); err != nil {
+				logrus.Errorf("Unable to parse sshfp record for %s: %s", h.Name, err)
+				continue
+			}
+			h.AddSSHFP(fp)
+		}
+		delete(h.Attributes, "__sshfp")
+	}
 }
 
 func (h Host) String() string {
@@ -131,6 +196,19 @@ func (h *Host) AddPublicKey(k ssh.PublicKey) {
 	h.publicKeys = append(h.publicKeys, k)
 }
 
+// AddSSHFP adds a host key fingerprint to a host. If VerifyHostKeyDNS is
+// enabled, the SSH client accepts host keys that match it and adds them as
+// public keys of the host.
+func (h *Host) AddSSHFP(fp SSHFP) {
+	if !slices.Contains(h.sshfp, fp) {
+		h.sshfp = append(h.sshfp, fp)
+	}
+}
+
+func (h *Host) SSHFPs() []SSHFP {
+	return h.sshfp
+}
+
 func (h *Host) PublicKeys(keyTypes ...string) []ssh.PublicKey {
 	if len(keyTypes) == 0 {
 		return h.publicKeys
@@ -151,31 +229,19 @@ func (h *Host) Match(hostnameGlob string, attributes MatchAttributes) bool {
 			return false
 		}
 	}
+	return attributes.MatchHost(h)
+}
 
-	for _, attribute := range attributes {
-		name := attribute.Name
-		value, ok := h.GetAttribute(name)
-		if !ok && !attribute.Negate && !attribute.Reference {
-			return false
-		}
-		if attribute.Reference {
-			refValue, refOk := h.GetAttribute(attribute.Attribute)
-			if ok != refOk && !attribute.Negate {
-				return false
-			}
-			if !ok && !refOk {
-				return false
-			}
-			attribute.Value = refValue
-		}
-		if ok && !attribute.Match(value) {
-			return false
-		}
+// GetAttribute returns the value of an attribute. Besides attribute names,
+// keys can be paths into maps and lists, like os.release.major or tags[0].
+func (h *Host) GetAttribute(key string) (any, bool) {
+	if value, ok := h.getAttribute(key); ok {
+		return value, ok
 	}
-	return true
+	return h.getAttributePath(key)
 }
 
-func (h *Host) GetAttribute(key string) (any, bool) {
+func (h *Host) getAttribute(key string) (any, bool) {
 	value, ok := h.Attributes[key]
 	if ok {
 		return value, ok
@@ -203,6 +269,97 @@ func (h *Host) GetAttribute(key string) (any, bool) {
 	return nil, false
 }
 
+// getAttributePath looks up a path like os.release.major. Attribute names can
+// contain dots themselves, so the longest attribute name that the path starts
+// with wins. Providers that flatten maps into attributes with colons in their
+// names, like os:release:major, can be queried with dots as well.
+func (h *Host) getAttributePath(key string) (any, bool) {
+	for i := len(key); i > 0; i-- {
+		if i < len(key) && key[i] != '.' && key[i] != '[' {
+			continue
+		}
+		name, path := key[:i], key[i:]
+		value, ok := h.getAttribute(name)
+		if !ok {
+			if !strings.Contains(name, ".") {
+				continue
+			}
+			if value, ok = h.getAttribute(strings.ReplaceAll(name, ".", ":")); !ok {
+				continue
+			}
+		}
+		return walkAttributePath(value, path)
+	}
+	return nil, false
+}
+
+// walkAttributePath follows a path of .key and [index] elements into maps
+// and lists. Indexes can be negative to count from the end of a list, keys in
+// brackets can be quoted to contain dots.
+func walkAttributePath(value any, path string) (any, bool) {
+	for path != "" {
+		var elt string
+		switch path[0] {
+		case '.':
+			end := strings.IndexAny(path[1:], ".[")
+			if end == -1 {
+				end = len(path) - 1
+			}
+			elt, path = path[1:end+1], path[end+1:]
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if q, err := strconv.QuotedPrefix(path[1:]); err == nil && strings.HasPrefix(path[len(q)+1:], "]") {
+				end = len(q) + 1
+			}
+			if end == -1 {
+				return nil, false
+			}
+			elt, path = path[1:end], path[end+1:]
+			if u, err := strconv.Unquote(elt); err == nil {
+				elt = u
+			}
+		default:
+			return nil, false
+		}
+		var ok bool
+		if value, ok = attributeElement(value, elt); !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func attributeElement(value any, elt string) (any, bool) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		e := v.MapIndex(reflect.ValueOf(elt).Convert(v.Type().Key()))
+		if !e.IsValid() {
+			return nil, false
+		}
+		return e.Interface(), true
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(elt)
+		if err != nil {
+			return nil, false
+		}
+		if i < 0 {
+			i += v.Len()
+		}
+		if i < 0 || i >= v.Len() {
+			return nil, false
+		}
+		return v.Index(i).Interface(), true
+	}
+	return nil, false
+}
+
 func (h *Host) Amend(h2 *Host) {
 	if h.Address == "" {
 		h.Address = h2.Address
@@ -222,6 +379,9 @@ func (h *Host) Amend(h2 *Host) {
 	for _, k := range h2.publicKeys {
 		h.AddPublicKey(k)
 	}
+	for _, fp := range h2.sshfp {
+		h.AddSSHFP(fp)
+	}
 }
 
 func (h *Host) less(h2 *Host, attributes []string) bool {
@@ -2,6 +2,7 @@ package herd
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -12,6 +13,7 @@ func TestHostDeserialization(t *testing.T) {
 			"color":  "puce",
 			"number": 32,
 			"float":  1.1,
+			"nested": map[string]any{"list": []any{1, 2.5}},
 		},
 	}
 	bdata, _ := json.Marshal(data)
@@ -35,6 +37,30 @@ func TestHostDeserialization(t *testing.T) {
 	if flt, ok := host.Attributes["float"]; !ok || flt != 1.1 {
 		t.Errorf("float attribute did not survive the json trip: %v", host.Attributes)
 	}
+	if l, _ := host.GetAttribute("nested.list"); !reflect.DeepEqual(l, []any{int64(1), 2.5}) {
+		t.Errorf("nested numbers did not survive the json trip: %#v", l)
+	}
+}
+
+func TestSSHFPSerialization(t *testing.T) {
+	fp := SSHFP{Algorithm: 4, Type: 2, Fingerprint: "0d7e1ab7f0c5b9d2c1b8f3cd9a0c7a7e4a3c4f1f8f6a2b5c6d7e8f9a0b1c2d3e"}
+	h := NewHost("test-host.herd.ci", "", HostAttributes{})
+	h.AddSSHFP(fp)
+	h.AddSSHFP(fp)
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatalf("Unable to serialize host: %s", err)
+	}
+	if _, ok := h.Attributes["__sshfp"]; ok {
+		t.Errorf("Serializing a host leaves internal attributes behind")
+	}
+	var h2 Host
+	if err = json.Unmarshal(data, &h2); err != nil {
+		t.Fatalf("Unable to deserialize host: %s", err)
+	}
+	if fps := h2.SSHFPs(); len(fps) != 1 || fps[0] != fp {
+		t.Errorf("sshfp records did not survive the json trip: %v", fps)
+	}
 }
 
 func TestAmendWithoutProvider(t *testing.T) {
@@ -42,3 +68,40 @@ func TestAmendWithoutProvider(t *testing.T) {
 	h2 := NewHost("test-host.herd.ci", "127.0.0.1", HostAttributes{})
 	h.Amend(h2)
 }
+
+func TestGetAttributePath(t *testing.T) {
+	host := NewHost("db-01.example.com", "", HostAttributes{
+		"os":              map[string]any{"release": map[string]any{"major": 12, "full": "12.5"}},
+		"tags":            []string{"db", "primary"},
+		"labels":          map[string]string{"app.kubernetes.io/name": "postgres"},
+		"disks":           []any{map[string]any{"size": 100}},
+		"service.port":    5432,
+		"dmi:bios:vendor": "SeaBIOS",
+	})
+	tests := []struct {
+		key   string
+		value any
+		ok    bool
+	}{
+		{"os.release.major", 12, true},
+		{"os[release][full]", "12.5", true},
+		{"os.release.minor", nil, false},
+		{"tags[0]", "db", true},
+		{"tags.1", "primary", true},
+		{"tags[-1]", "primary", true},
+		{"tags[2]", nil, false},
+		{"tags.first", nil, false},
+		{`labels["app.kubernetes.io/name"]`, "postgres", true},
+		{"disks[0].size", 100, true},
+		{"service.port", 5432, true},
+		{"dmi.bios.vendor", "SeaBIOS", true},
+		{"name.first", nil, false},
+		{"tags[0", nil, false},
+	}
+	for _, test := range tests {
+		value, ok := host.GetAttribute(test.key)
+		if ok != test.ok || value != test.value {
+			t.Errorf("GetAttribute(%q) returned %v, %t, expected %v, %t", test.key, value, ok, test.value, test.ok)
+		}
+	}
+}
@@ -127,7 +127,7 @@ host:
 	for _, host := range s.hosts {
 		bucket := ""
 		for _, attr := range attributes {
-			value, ok := host.Attributes[attr]
+			value, ok := host.GetAttribute(attr)
 			if !ok {
 				continue host
 			}
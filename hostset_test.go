@@ -62,3 +62,21 @@ func eq(a, b []*Host) bool {
 	}
 	return true
 }
+
+func TestHostSetNestedAttributes(t *testing.T) {
+	h1 := NewHost("host-a.example.com", "", HostAttributes{"location": map[string]any{"site": "site2"}})
+	h2 := NewHost("host-b.example.com", "", HostAttributes{"location": map[string]any{"site": "site1"}})
+	h3 := NewHost("host-c.example.com", "", HostAttributes{"location": map[string]any{"site": "site1"}})
+	hosts := HostSet{hosts: []*Host{h1, h2, h3}}
+
+	hosts.SetSortFields([]string{"location.site"})
+	hosts.Sort()
+	if !eq(hosts.hosts, []*Host{h2, h3, h1}) {
+		t.Errorf("Sorting by location.site is failing, got %v", hosts)
+	}
+
+	hosts.Sample([]string{"location.site"}, 1)
+	if hosts.Len() != 2 {
+		t.Errorf("Sampling by location.site is failing, got %v", hosts)
+	}
+}
@@ -0,0 +1,195 @@
+package herd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mgutz/ansi"
+)
+
+// An InventoryDiff describes how hosts changed between two loads of the
+// inventory: which hosts were added, which were removed and which attributes
+// of the remaining hosts changed.
+type InventoryDiff struct {
+	Added   []*Host
+	Removed []*Host
+	Changed []HostChanges
+}
+
+type HostChanges struct {
+	Host    *Host
+	Changes []AttributeChange
+}
+
+// An AttributeChange is a changed attribute value. Attributes that were added
+// have no Old value, attributes that were removed have no New value.
+type AttributeChange struct {
+	Name   string
+	Old    any
+	New    any
+	HasOld bool
+	HasNew bool
+}
+
+func (d *InventoryDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// SaveSnapshot saves all loaded hosts, so later loads can be compared to
+// them. If previous is not empty, the snapshot this one replaces is moved
+// there. Nothing is written when the hosts did not change since the last
+// snapshot, so loading hosts from caches does not replace the previous
+// snapshot with an identical one.
+func (r *Registry) SaveSnapshot(path, previous string) error {
+	if r.hosts == nil {
+		return fmt.Errorf("Hosts have not been loaded yet")
+	}
+	data, err := json.Marshal(r.hosts)
+	if err != nil {
+		return err
+	}
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) { // #nosec G304 -- Snapshots are our own files
+		return nil
+	}
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so an interrupted write doesn't leave
+	// a truncated snapshot behind, and concurrent runs of herd don't write
+	// to the same file
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && previous != "" {
+		if err = os.Rename(path, previous); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// DiffSnapshot compares the loaded hosts to a snapshot saved earlier
+func (r *Registry) DiffSnapshot(path string) (*InventoryDiff, error) {
+	if r.hosts == nil {
+		return nil, fmt.Errorf("Hosts have not been loaded yet")
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- Snapshots are our own files
+	if err != nil {
+		return nil, err
+	}
+	snapshot := NewHostSet()
+	if err = json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("Unable to parse snapshot %s: %w", path, err)
+	}
+	return DiffHostSets(snapshot, r.hosts), nil
+}
+
+// DiffHostSets compares two sets of hosts by name. Attribute values are
+// compared by their JSON representation, so hosts loaded from a snapshot
+// compare equal to the hosts they were saved from.
+func DiffHostSets(old, new *HostSet) *InventoryDiff {
+	d := &InventoryDiff{Added: []*Host{}, Removed: []*Host{}, Changed: []HostChanges{}}
+	oldHosts := make(map[string]*Host, len(old.hosts))
+	for _, h := range old.hosts {
+		oldHosts[h.Name] = h
+	}
+	seen := make(map[string]bool, len(new.hosts))
+	for _, h := range new.hosts {
+		seen[h.Name] = true
+		oh, ok := oldHosts[h.Name]
+		if !ok {
+			d.Added = append(d.Added, h)
+			continue
+		}
+		if changes := diffHosts(oh, h); len(changes) > 0 {
+			d.Changed = append(d.Changed, HostChanges{Host: h, Changes: changes})
+		}
+	}
+	for _, h := range old.hosts {
+		if !seen[h.Name] {
+			d.Removed = append(d.Removed, h)
+		}
+	}
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].Name < d.Added[j].Name })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].Name < d.Removed[j].Name })
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Host.Name < d.Changed[j].Host.Name })
+	return d
+}
+
+func diffHosts(old, new *Host) []AttributeChange {
+	changes := []AttributeChange{}
+	if old.Address != new.Address {
+		changes = append(changes, AttributeChange{Name: "address", Old: old.Address, New: new.Address, HasOld: old.Address != "", HasNew: new.Address != ""})
+	}
+	names := make([]string, 0, len(old.Attributes)+len(new.Attributes))
+	for k := range old.Attributes {
+		names = append(names, k)
+	}
+	for k := range new.Attributes {
+		if _, ok := old.Attributes[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ov, hasOld := old.Attributes[name]
+		nv, hasNew := new.Attributes[name]
+		if hasOld && hasNew && jsonEqual(ov, nv) {
+			continue
+		}
+		changes = append(changes, AttributeChange{Name: name, Old: ov, New: nv, HasOld: hasOld, HasNew: hasNew})
+	}
+	return changes
+}
+
+func jsonEqual(a, b any) bool {
+	ja, erra := json.Marshal(a)
+	jb, errb := json.Marshal(b)
+	return erra == nil && errb == nil && string(ja) == string(jb)
+}
+
+func (ui *SimpleUI) PrintInventoryDiff(d *InventoryDiff) {
+	if d.Empty() {
+		ui.pchan <- outputMessage{outputMessageHostlist, ansi.Color("No changes", ui.colors.Summary) + "\n"}
+		return
+	}
+	var sb strings.Builder
+	for _, h := range d.Added {
+		sb.WriteString(ansi.Color("+ "+h.Name, ui.colors.HostOK) + "\n")
+	}
+	for _, h := range d.Removed {
+		sb.WriteString(ansi.Color("- "+h.Name, ui.colors.HostError) + "\n")
+	}
+	for _, c := range d.Changed {
+		sb.WriteString(ansi.Color("~ "+c.Host.Name, ui.colors.HostFail) + "\n")
+		for _, a := range c.Changes {
+			switch {
+			case !a.HasOld:
+				sb.WriteString(ansi.Color(fmt.Sprintf("    + %s: %v", a.Name, a.New), ui.colors.HostOK) + "\n")
+			case !a.HasNew:
+				sb.WriteString(ansi.Color(fmt.Sprintf("    - %s: %v", a.Name, a.Old), ui.colors.HostError) + "\n")
+			default:
+				fmt.Fprintf(&sb, "    %s: %v -> %v\n", a.Name, a.Old, a.New)
+			}
+		}
+	}
+	sb.WriteString(ansi.Color(fmt.Sprintf("%d added, %d removed, %d changed", len(d.Added), len(d.Removed), len(d.Changed)), ui.colors.Summary) + "\n")
+	ui.pchan <- outputMessage{outputMessageHostlist, sb.String()}
+}
@@ -0,0 +1,118 @@
+package herd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestInventoryDiff(t *testing.T) {
+	old := NewHostSet()
+	old.AddHost(NewHost("db-01.example.com", "10.0.0.1", HostAttributes{"role": "db", "cpus": 8, "tags": []string{"a", "b"}}))
+	old.AddHost(NewHost("db-02.example.com", "10.0.0.2", HostAttributes{"role": "db", "legacy": true}))
+	old.AddHost(NewHost("web-01.example.com", "", HostAttributes{"role": "web"}))
+
+	r := NewRegistry("", "")
+	r.hosts = old
+	path := filepath.Join(t.TempDir(), "snapshots", "test.json")
+	if err := r.SaveSnapshot(path, ""); err != nil {
+		t.Fatalf("Unable to save snapshot: %s", err)
+	}
+
+	// Values that went through json compare equal to the originals
+	d, err := r.DiffSnapshot(path)
+	if err != nil {
+		t.Fatalf("Unable to diff snapshot: %s", err)
+	}
+	if !d.Empty() {
+		t.Errorf("Expected no changes, got %v", d)
+	}
+
+	r.hosts = NewHostSet()
+	r.hosts.AddHost(NewHost("db-01.example.com", "10.0.0.1", HostAttributes{"role": "db", "cpus": 16, "tags": []string{"a", "b"}}))
+	r.hosts.AddHost(NewHost("db-02.example.com", "10.0.0.3", HostAttributes{"role": "db", "owner": "dba"}))
+	r.hosts.AddHost(NewHost("web-02.example.com", "", HostAttributes{"role": "web"}))
+	d, err = r.DiffSnapshot(path)
+	if err != nil {
+		t.Fatalf("Unable to diff snapshot: %s", err)
+	}
+	if len(d.Added) != 1 || d.Added[0].Name != "web-02.example.com" {
+		t.Errorf("Expected web-02 to be added, got %v", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Name != "web-01.example.com" {
+		t.Errorf("Expected web-01 to be removed, got %v", d.Removed)
+	}
+	if len(d.Changed) != 2 {
+		t.Fatalf("Expected 2 changed hosts, got %v", d.Changed)
+	}
+	if c := d.Changed[0].Changes; len(c) != 1 || c[0].Name != "cpus" || c[0].Old != int64(8) || c[0].New != 16 {
+		t.Errorf("Unexpected changes for db-01: %v", c)
+	}
+	expected := []AttributeChange{
+		{Name: "address", Old: "10.0.0.2", New: "10.0.0.3", HasOld: true, HasNew: true},
+		{Name: "legacy", Old: true, HasOld: true},
+		{Name: "owner", New: "dba", HasNew: true},
+	}
+	c := d.Changed[1].Changes
+	if len(c) != len(expected) {
+		t.Fatalf("Unexpected changes for db-02: %v", c)
+	}
+	for i, e := range expected {
+		if c[i] != e {
+			t.Errorf("Unexpected change for db-02: %v, expected %v", c[i], e)
+		}
+	}
+}
+
+func TestSaveSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	last, previous := filepath.Join(dir, "last.json"), filepath.Join(dir, "previous.json")
+	r := NewRegistry("", "")
+	save := func(names ...string) {
+		t.Helper()
+		r.hosts = NewHostSet()
+		for _, name := range names {
+			r.hosts.AddHost(NewHost(name, "", HostAttributes{}))
+		}
+		if err := r.SaveSnapshot(last, previous); err != nil {
+			t.Fatalf("Unable to save snapshot: %s", err)
+		}
+	}
+	hosts := func(path string) []string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Unable to read snapshot: %s", err)
+		}
+		hs := NewHostSet()
+		if err = json.Unmarshal(data, hs); err != nil {
+			t.Fatalf("Unable to parse snapshot: %s", err)
+		}
+		names := []string{}
+		for _, h := range hs.hosts {
+			names = append(names, h.Name)
+		}
+		return names
+	}
+
+	save("web-01")
+	if _, err := os.Stat(previous); !os.IsNotExist(err) {
+		t.Errorf("Did not expect a previous snapshot after the first save: %v", err)
+	}
+	save("web-01", "web-02")
+	// Saving the same hosts again, like when loading from a cache, does not
+	// rotate the snapshots
+	save("web-01", "web-02")
+	if h := hosts(previous); !slices.Equal(h, []string{"web-01"}) {
+		t.Errorf("Unexpected hosts in the previous snapshot: %v", h)
+	}
+	if h := hosts(last); !slices.Equal(h, []string{"web-01", "web-02"}) {
+		t.Errorf("Unexpected hosts in the last snapshot: %v", h)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("Temporary files were left behind: %v", entries)
+	}
+}
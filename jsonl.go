@@ -0,0 +1,86 @@
+package herd
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// In jsonl format, every event in a run is written as a single line of JSON,
+// so other programs can follow a run as it happens. Every event has an Event
+// and a Time field, other fields depend on the type of event:
+//
+//	start:   Host
+//	output:  Host, Stderr, Data
+//	retry:   Host, Result
+//	finish:  Host, Result
+//	summary: Command, Summary, StartTime, EndTime, ElapsedTime
+func jsonlEvent(event string, fields map[string]any) string {
+	fields["Event"] = event
+	fields["Time"] = time.Now()
+	data, err := json.Marshal(fields)
+	if err != nil {
+		logrus.Errorf("Unable to encode %s event: %s", event, err)
+		return ""
+	}
+	return string(data) + "\n"
+}
+
+func jsonlSummary(hi *HistoryItem) string {
+	return jsonlEvent("summary", map[string]any{
+		"Command":     hi.Command,
+		"Summary":     hi.Summary,
+		"StartTime":   hi.StartTime,
+		"EndTime":     hi.EndTime,
+		"ElapsedTime": hi.ElapsedTime,
+	})
+}
+
+// In jsonl mode, output lines and progress messages are handled by a single
+// goroutine, so output of a host can't overtake its start event.
+func (ui *SimpleUI) jsonlProgressChannel() chan ProgressMessage {
+	pc := make(chan ProgressMessage)
+	oc := ui.pendingOutput
+	ui.pendingOutput = nil
+	ui.consumers.Add(1)
+	go func() {
+		defer ui.consumers.Done()
+		pc := pc
+		for pc != nil || oc != nil {
+			select {
+			case line, ok := <-oc:
+				if !ok {
+					oc = nil
+					continue
+				}
+				ui.pchan <- outputMessage{outputMessageCommandOutput, jsonlEvent("output", map[string]any{
+					"Host":   line.Host.Name,
+					"Stderr": line.Stderr,
+					"Data":   string(line.Data),
+				})}
+			case msg, ok := <-pc:
+				if !ok {
+					pc = nil
+					continue
+				}
+				var event string
+				fields := map[string]any{"Host": msg.Host.Name}
+				switch msg.State {
+				case Running:
+					event = "start"
+				case Retrying:
+					event = "retry"
+					fields["Result"] = msg.Result
+				case Finished, Skipped:
+					event = "finish"
+					fields["Result"] = msg.Result
+				default:
+					continue
+				}
+				ui.pchan <- outputMessage{outputMessageResult, jsonlEvent(event, fields)}
+			}
+		}
+	}()
+	return pc
+}
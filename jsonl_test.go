@@ -0,0 +1,126 @@
+package herd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// echoExecutor sends the command as output, once on stdout and once on stderr
+type echoExecutor struct {
+	fakeExecutor
+}
+
+func (e *echoExecutor) Run(ctx context.Context, host *Host, cmd string, oc chan OutputLine) *Result {
+	r := e.fakeExecutor.Run(ctx, host, cmd, oc)
+	r.Stdout = []byte(cmd + "\n")
+	r.Stderr = []byte(cmd + "\n")
+	oc <- OutputLine{Host: host, Data: r.Stdout}
+	oc <- OutputLine{Host: host, Data: r.Stderr, Stderr: true}
+	return r
+}
+
+func TestJsonlOutput(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "output"))
+	if err != nil {
+		t.Fatalf("Unable to create output file: %s", err)
+	}
+	defer out.Close()
+
+	hosts := NewHostSet()
+	for _, name := range []string{"host-1", "host-2", "fail-1"} {
+		hosts.AddHost(NewHost(name, "", HostAttributes{}))
+	}
+	ui := &SimpleUI{
+		hosts:    hosts,
+		output:   out,
+		pchan:    make(chan outputMessage, 100),
+		syncCond: &sync.Cond{L: new(sync.Mutex)},
+	}
+	ui.SetOutputFormat(FormatJsonl)
+	go ui.printer()
+
+	runner := NewRunner(hosts, &echoExecutor{})
+	runner.SetTimeout(time.Minute)
+	runner.SetHostTimeout(time.Minute)
+	oc := ui.OutputChannel()
+	pc := ui.ProgressChannel(time.Now().Add(time.Minute))
+	hi, err := runner.Run("hello", pc, oc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	close(oc)
+	close(pc)
+	ui.Sync()
+	ui.PrintHistoryItem(hi)
+	ui.End()
+
+	if _, err = out.Seek(0, 0); err != nil {
+		t.Fatalf("Unable to read output: %s", err)
+	}
+	type event struct {
+		Event   string
+		Time    time.Time
+		Host    string
+		Stderr  bool
+		Data    string
+		Result  *Result
+		Command string
+		Summary struct{ Ok, Fail, Err, Skipped int }
+	}
+	events := []event{}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var e event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid JSON line %q: %s", scanner.Text(), err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("No timestamp in %q", scanner.Text())
+		}
+		events = append(events, e)
+	}
+
+	counts := make(map[string]map[string]int)
+	for _, e := range events[:len(events)-1] {
+		if counts[e.Host] == nil {
+			counts[e.Host] = make(map[string]int)
+		}
+		counts[e.Host][e.Event]++
+		switch e.Event {
+		case "start":
+			if counts[e.Host]["output"] != 0 || counts[e.Host]["finish"] != 0 {
+				t.Errorf("Start event for %s after other events", e.Host)
+			}
+		case "output":
+			if e.Data != "hello\n" {
+				t.Errorf("Unexpected output for %s: %q", e.Host, e.Data)
+			}
+			if e.Stderr {
+				counts[e.Host]["stderr"]++
+			}
+		case "finish":
+			if e.Result == nil || e.Result.Host != e.Host || string(e.Result.Stdout) != "hello\n" {
+				t.Errorf("Unexpected result for %s: %+v", e.Host, e.Result)
+			}
+		default:
+			t.Errorf("Unexpected %s event", e.Event)
+		}
+	}
+	for _, name := range []string{"host-1", "host-2", "fail-1"} {
+		c := counts[name]
+		if c["start"] != 1 || c["output"] != 2 || c["stderr"] != 1 || c["finish"] != 1 {
+			t.Errorf("Unexpected events for %s: %v", name, c)
+		}
+	}
+
+	summary := events[len(events)-1]
+	if summary.Event != "summary" || summary.Command != "hello" || summary.Summary.Ok != 2 || summary.Summary.Fail != 1 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+}
@@ -0,0 +1,51 @@
+package herd
+
+import (
+	"bytes"
+)
+
+// LineWriterBuffer collects the output of a command, and sends every complete
+// line to an output channel as well. Executors use it to stream output while
+// still returning all of it in the result.
+type LineWriterBuffer struct {
+	oc      chan OutputLine
+	host    *Host
+	stderr  bool
+	buf     bytes.Buffer
+	lineBuf []byte
+	redact  func([]byte) []byte
+}
+
+// NewLineWriterBuffer creates a LineWriterBuffer for the stdout or stderr of a
+// host. If redact is not nil, it is called for every line before it is sent.
+// The collected output is not redacted.
+func NewLineWriterBuffer(host *Host, stderr bool, oc chan OutputLine, redact func([]byte) []byte) *LineWriterBuffer {
+	return &LineWriterBuffer{
+		host:   host,
+		oc:     oc,
+		stderr: stderr,
+		redact: redact,
+	}
+}
+
+func (buf *LineWriterBuffer) Write(p []byte) (int, error) {
+	n, err := buf.buf.Write(p)
+	buf.lineBuf = append(buf.lineBuf, p...)
+	for {
+		idx := bytes.IndexByte(buf.lineBuf, '\n')
+		if idx == -1 {
+			break
+		}
+		line := buf.lineBuf[:idx+1]
+		if buf.redact != nil {
+			line = buf.redact(line)
+		}
+		buf.oc <- OutputLine{Host: buf.host, Data: line, Stderr: buf.stderr}
+		buf.lineBuf = buf.lineBuf[idx+1:]
+	}
+	return n, err
+}
+
+func (buf *LineWriterBuffer) Bytes() []byte {
+	return buf.buf.Bytes()
+}
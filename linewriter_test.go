@@ -0,0 +1,33 @@
+package herd
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestLineWriterBuffer(t *testing.T) {
+	oc := make(chan OutputLine, 10)
+	host := NewHost("test-host", "", HostAttributes{})
+	upper := func(line []byte) []byte { return bytes.ToUpper(line) }
+	w := NewLineWriterBuffer(host, true, oc, upper)
+	for _, data := range []string{"one\ntw", "o\n", "three\nfour"} {
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	close(oc)
+	lines := []string{}
+	for l := range oc {
+		if l.Host != host || !l.Stderr {
+			t.Errorf("Unexpected host or stream for %q", l.Data)
+		}
+		lines = append(lines, string(l.Data))
+	}
+	if !slices.Equal(lines, []string{"ONE\n", "TWO\n", "THREE\n"}) {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+	if string(w.Bytes()) != "one\ntwo\nthree\nfour" {
+		t.Errorf("Unexpected output: %q", w.Bytes())
+	}
+}
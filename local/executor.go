@@ -0,0 +1,126 @@
+// Package local implements an executor that runs commands on the local
+// machine instead of on the hosts themselves, once for every host. This makes
+// it possible to use herd's host selection, parallelism, timeouts and history
+// for targets that aren't reachable with ssh, with commands such as kubectl
+// exec, docker exec or curl.
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"github.com/sirupsen/logrus"
+)
+
+type byteWriter interface {
+	io.Writer
+	Bytes() []byte
+}
+
+type Executor struct{}
+
+func NewExecutor() (herd.Executor, error) {
+	return &Executor{}, nil
+}
+
+// There is nothing to connect to, so there is no connect timeout either
+func (e *Executor) SetConnectTimeout(t time.Duration) {
+}
+
+func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	return e.RunWithStdin(ctx, host, command, nil, oc)
+}
+
+func (e *Executor) RunWithStdin(ctx context.Context, host *herd.Host, command string, stdin io.Reader, oc chan herd.OutputLine) *herd.Result {
+	now := time.Now()
+	r := &herd.Result{Host: host.Name, StartTime: now, EndTime: now, ElapsedTime: 0, ExitStatus: -1}
+	defer func() {
+		r.EndTime = time.Now()
+		r.ElapsedTime = r.EndTime.Sub(r.StartTime).Seconds()
+	}()
+
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+		return r
+	}
+
+	var stdout, stderr byteWriter
+	if oc != nil {
+		stdout = herd.NewLineWriterBuffer(host, false, oc, nil)
+		stderr = herd.NewLineWriterBuffer(host, true, oc, nil)
+	} else {
+		stdout = bytes.NewBuffer([]byte{})
+		stderr = bytes.NewBuffer([]byte{})
+	}
+
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), hostEnvironment(host)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Background processes may keep stdout open after the command has been
+	// killed, we don't wait for them
+	cmd.WaitDelay = time.Second
+	logrus.Debugf("Running %s locally for %s", command, host.Name)
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		r.ExitStatus = 0
+	case ctx.Err() != nil:
+		r.Err = herd.ClassifiedError{Class: herd.SessionTimeout, Err: herd.TimeoutError{Message: "Timed out while executing command"}}
+	case errors.As(err, &exitErr):
+		r.Err = err
+		r.ExitStatus = exitErr.ExitCode()
+	default:
+		r.Err = err
+	}
+	r.Stdout = stdout.Bytes()
+	r.Stderr = stderr.Bytes()
+	return r
+}
+
+var envUnsafe = regexp.MustCompile("[^A-Za-z0-9_]")
+
+// hostEnvironment exports the host's name, address and attributes as
+// environment variables. Characters that can't be used in variable names are
+// replaced with underscores, lists and maps are encoded as JSON.
+func hostEnvironment(host *herd.Host) []string {
+	env := []string{"HERD_HOST=" + host.Name}
+	if host.Address != "" {
+		env = append(env, "HERD_ADDRESS="+host.Address)
+	}
+	for key, value := range host.Attributes {
+		var s string
+		switch value.(type) {
+		case nil:
+		case []any, []string, map[string]any, herd.HostAttributes:
+			data, err := json.Marshal(value)
+			if err != nil {
+				logrus.Warnf("Unable to export attribute %s of %s: %s", key, host.Name, err)
+				continue
+			}
+			s = string(data)
+		default:
+			s = fmt.Sprintf("%v", value)
+		}
+		env = append(env, "HERD_ATTR_"+envUnsafe.ReplaceAllString(key, "_")+"="+s)
+	}
+	return env
+}
+
+var (
+	_ herd.Executor    = &Executor{}
+	_ herd.StdinRunner = &Executor{}
+)
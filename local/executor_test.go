@@ -0,0 +1,76 @@
+//go:build !windows
+
+package local
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seveas/herd"
+)
+
+func TestExecutor(t *testing.T) {
+	host := herd.NewHost("web-1.example.com", "192.0.2.1", herd.HostAttributes{
+		"os":         "Debian",
+		"cpus":       4,
+		"tags":       []any{"web", "live"},
+		"ec2:region": "eu-west-1",
+	})
+	e := &Executor{}
+
+	tests := []struct {
+		command string
+		status  int
+		stdout  string
+		stderr  string
+	}{
+		{`echo "$HERD_HOST $HERD_ADDRESS"`, 0, "web-1.example.com 192.0.2.1\n", ""},
+		{`echo "$HERD_ATTR_os $HERD_ATTR_cpus $HERD_ATTR_tags $HERD_ATTR_ec2_region"`, 0, "Debian 4 [\"web\",\"live\"] eu-west-1\n", ""},
+		{`echo oops >&2; exit 3`, 3, "", "oops\n"},
+	}
+	for _, test := range tests {
+		r := e.Run(context.Background(), host, test.command, nil)
+		if r.ExitStatus != test.status || string(r.Stdout) != test.stdout || string(r.Stderr) != test.stderr {
+			t.Errorf("%s: unexpected result %d %q %q", test.command, r.ExitStatus, r.Stdout, r.Stderr)
+		}
+	}
+
+	r := e.RunWithStdin(context.Background(), host, "tr a-z A-Z", strings.NewReader("hello\n"), nil)
+	if r.Err != nil || string(r.Stdout) != "HELLO\n" {
+		t.Errorf("Unexpected result with stdin: %v %q", r.Err, r.Stdout)
+	}
+
+	oc := make(chan herd.OutputLine, 10)
+	e.Run(context.Background(), host, "echo one; echo two >&2", oc)
+	close(oc)
+	lines := []string{}
+	for line := range oc {
+		lines = append(lines, string(line.Data))
+		if line.Stderr != (string(line.Data) == "two\n") {
+			t.Errorf("Wrong stderr flag for %q", line.Data)
+		}
+	}
+	// Stdout and stderr are read separately, so their order isn't fixed
+	slices.Sort(lines)
+	if strings.Join(lines, "") != "one\ntwo\n" {
+		t.Errorf("Unexpected output lines: %q", lines)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	r = e.Run(ctx, host, "sleep 10 & sleep 10", nil)
+	if herd.ErrorClassOf(r.Err) != herd.SessionTimeout || r.ExitStatus != -1 {
+		t.Errorf("Expected a timeout, got %v", r.Err)
+	}
+	if !errors.As(r.Err, &herd.TimeoutError{}) {
+		t.Errorf("Expected a timeout error, got %T", r.Err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Killing a timed out command took %s", time.Since(start))
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package local
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// Commands run in their own process group, so that when they time out, we
+// kill not just the shell but everything it started as well.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command) // #nosec G204 -- Running the user's command is the whole point
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd
+}
@@ -0,0 +1,10 @@
+package local
+
+import (
+	"context"
+	"os/exec"
+)
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd.exe", "/c", command) // #nosec G204 -- Running the user's command is the whole point
+}
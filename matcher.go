@@ -2,11 +2,39 @@ package herd
 
 import (
 	"fmt"
+	"net/netip"
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// MatchOperator is how an attribute is compared to the value of a
+// MatchAttribute. Regex and Negate apply on top of it.
+type MatchOperator int
+
+const (
+	MatchEqual MatchOperator = iota
+	MatchLess
+	MatchLessOrEqual
+	MatchGreater
+	MatchGreaterOrEqual
+	// The value is a list of values to match against. A netip.Prefix in this
+	// list matches addresses in that network.
+	MatchIn
+	// Only checks whether a host has the attribute at all
+	MatchExists
+)
+
+var matchOperatorString = map[MatchOperator]string{
+	MatchLess:           "<",
+	MatchLessOrEqual:    "<=",
+	MatchGreater:        ">",
+	MatchGreaterOrEqual: ">=",
+	MatchIn:             "in",
+}
+
 type MatchAttribute struct {
 	Name        string
 	FuzzyTyping bool
@@ -15,9 +43,40 @@ type MatchAttribute struct {
 	Value       any
 	Reference   bool
 	Attribute   string
+	Operator    MatchOperator
+	// If Any is set, this matches a host if any of the alternatives matches
+	// it, and the other fields except Negate are ignored. This is how or and
+	// parentheses in filters are represented.
+	Any []MatchAttributes
 }
 
 func (m MatchAttribute) String() string {
+	if m.Any != nil {
+		alternatives := make([]string, len(m.Any))
+		for i, a := range m.Any {
+			alternatives[i] = a.String()
+		}
+		s := "(" + strings.Join(alternatives, " or ") + ")"
+		if m.Negate {
+			s = "not " + s
+		}
+		return s
+	}
+	if m.Operator != MatchEqual {
+		var s string
+		switch m.Operator {
+		case MatchExists:
+			s = fmt.Sprintf("exists(%s)", m.Name)
+		case MatchIn:
+			s = fmt.Sprintf("%s in %v", m.Name, m.Value)
+		default:
+			s = fmt.Sprintf("%s %s %v", m.Name, matchOperatorString[m.Operator], m.Value)
+		}
+		if m.Negate {
+			s = "not " + s
+		}
+		return s
+	}
 	c1, c2 := '=', '='
 	f := ""
 	if m.FuzzyTyping {
@@ -40,7 +99,8 @@ func (m MatchAttribute) Match(value any) (matches bool) {
 	}()
 	if svalue := reflect.ValueOf(value); svalue.Kind() == reflect.Slice {
 		// Here we ignore Negate to make sure we filter for any/none matching
-		mx := MatchAttribute{Name: m.Name, Value: m.Value, FuzzyTyping: m.FuzzyTyping, Regex: m.Regex}
+		mx := m
+		mx.Negate = false
 		for i := 0; i < svalue.Len(); i++ {
 			if mx.Match(svalue.Index(i).Interface()) {
 				return true
@@ -48,6 +108,14 @@ func (m MatchAttribute) Match(value any) (matches bool) {
 		}
 		return false
 	}
+	switch m.Operator {
+	case MatchExists:
+		return true
+	case MatchIn:
+		return m.matchIn(value)
+	case MatchLess, MatchLessOrEqual, MatchGreater, MatchGreaterOrEqual:
+		return m.compare(value)
+	}
 	if m.Value == value {
 		return true
 	}
@@ -91,4 +159,128 @@ func (m MatchAttribute) Match(value any) (matches bool) {
 	return false
 }
 
+func (m MatchAttribute) matchIn(value any) bool {
+	values, _ := m.Value.([]any)
+	for _, v := range values {
+		if prefix, ok := v.(netip.Prefix); ok {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if addr, err := netip.ParseAddr(s); err == nil && prefix.Contains(addr.Unmap()) {
+				return true
+			}
+			continue
+		}
+		mx := MatchAttribute{Name: m.Name, Value: v, FuzzyTyping: m.FuzzyTyping}
+		if re, ok := v.(*regexp.Regexp); ok {
+			mx = MatchAttribute{Name: m.Name, Value: re, Regex: true}
+		}
+		if mx.Match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare compares numbers and durations, durations count as their number of
+// seconds. Values that are neither never match.
+func (m MatchAttribute) compare(value any) bool {
+	v1, ok1 := NumericValue(value)
+	v2, ok2 := NumericValue(m.Value)
+	if !ok1 || !ok2 {
+		return false
+	}
+	switch m.Operator {
+	case MatchLess:
+		return v1 < v2
+	case MatchLessOrEqual:
+		return v1 <= v2
+	case MatchGreater:
+		return v1 > v2
+	default:
+		return v1 >= v2
+	}
+}
+
+// NumericValue returns the value of numbers, durations and strings holding
+// either as a float64 that can be compared. Durations are their number of
+// seconds.
+func NumericValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.Seconds(), true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+		if i, err := strconv.ParseInt(v, 0, 64); err == nil {
+			return float64(i), true
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return d.Seconds(), true
+		}
+		return 0, false
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// MatchHost matches an attribute of a host, or in case of alternatives, the
+// host itself. Hosts without the attribute only match negated filters.
+func (m MatchAttribute) MatchHost(h *Host) bool {
+	if m.Any != nil {
+		for _, a := range m.Any {
+			if a.MatchHost(h) {
+				return !m.Negate
+			}
+		}
+		return m.Negate
+	}
+	value, ok := h.GetAttribute(m.Name)
+	if m.Operator == MatchExists {
+		return ok != m.Negate
+	}
+	if !ok && !m.Negate && !m.Reference {
+		return false
+	}
+	if m.Reference {
+		refValue, refOk := h.GetAttribute(m.Attribute)
+		if ok != refOk && !m.Negate {
+			return false
+		}
+		if !ok && !refOk {
+			return false
+		}
+		m.Value = refValue
+	}
+	return !ok || m.Match(value)
+}
+
+// MatchAttributes match a host if all of them match
 type MatchAttributes []MatchAttribute
+
+func (m MatchAttributes) MatchHost(h *Host) bool {
+	for _, a := range m {
+		if !a.MatchHost(h) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m MatchAttributes) String() string {
+	s := make([]string, len(m))
+	for i, a := range m {
+		s[i] = a.String()
+	}
+	return strings.Join(s, " and ")
+}
@@ -1,8 +1,10 @@
 package herd
 
 import (
+	"net/netip"
 	"regexp"
 	"testing"
+	"time"
 )
 
 type testcase struct {
@@ -43,6 +45,23 @@ func TestMatchAttribute(t *testing.T) {
 		{a: MatchAttribute{Value: 1}, v: []int{2, 3, 4}, m: false},
 		{a: MatchAttribute{Value: 1}, v: []int{1}, m: true},
 		{a: MatchAttribute{Value: 1}, v: []int{}, m: false},
+		// Comparisons, with numbers, durations and strings that look like them
+		{a: MatchAttribute{Value: int64(16), Operator: MatchGreaterOrEqual}, v: 16, m: true},
+		{a: MatchAttribute{Value: int64(16), Operator: MatchGreater}, v: 16, m: false},
+		{a: MatchAttribute{Value: "16", Operator: MatchLess, FuzzyTyping: true}, v: 8.5, m: true},
+		{a: MatchAttribute{Value: "16", Operator: MatchLessOrEqual, FuzzyTyping: true}, v: "32", m: false},
+		{a: MatchAttribute{Value: time.Hour, Operator: MatchGreater}, v: "2h30m", m: true},
+		{a: MatchAttribute{Value: "1h", Operator: MatchGreater}, v: 1800, m: false},
+		{a: MatchAttribute{Value: int64(16), Operator: MatchLess}, v: "many", m: false},
+		{a: MatchAttribute{Value: int64(3), Operator: MatchLess}, v: []int{5, 2}, m: true},
+		// Lists and networks
+		{a: MatchAttribute{Value: []any{"db", "cache"}, Operator: MatchIn}, v: "db", m: true},
+		{a: MatchAttribute{Value: []any{"db", "cache"}, Operator: MatchIn}, v: "web", m: false},
+		{a: MatchAttribute{Value: []any{"1", "2"}, Operator: MatchIn, FuzzyTyping: true}, v: 2, m: true},
+		{a: MatchAttribute{Value: []any{netip.MustParsePrefix("10.0.0.0/8")}, Operator: MatchIn}, v: "10.1.2.3", m: true},
+		{a: MatchAttribute{Value: []any{netip.MustParsePrefix("10.0.0.0/8")}, Operator: MatchIn}, v: "192.0.2.1", m: false},
+		{a: MatchAttribute{Value: []any{netip.MustParsePrefix("2001:db8::/32")}, Operator: MatchIn}, v: "2001:db8::1", m: true},
+		{a: MatchAttribute{Value: []any{netip.MustParsePrefix("10.0.0.0/8")}, Operator: MatchIn}, v: "web-01", m: false},
 	}
 
 	for i, c := range testcases {
@@ -55,7 +74,8 @@ func TestMatchAttribute(t *testing.T) {
 			}
 		}
 		// Test the negation as well
-		a := MatchAttribute{Name: "v", FuzzyTyping: c.a.FuzzyTyping, Value: c.a.Value, Regex: c.a.Regex, Negate: !c.a.Negate}
+		a := c.a
+		a.Negate = !a.Negate
 		if m := a.Match(c.v); m != !c.m {
 			if !c.m {
 				t.Errorf("(%d) expected %v (%T) to match %v (%T), but they did not match", i, a, a.Value, c.v, c.v)
@@ -65,3 +85,28 @@ func TestMatchAttribute(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchHost(t *testing.T) {
+	host := NewHost("db-01.example.com", "10.1.2.3", HostAttributes{"role": "db", "cpu_count": 16})
+	role := func(r string) MatchAttribute { return MatchAttribute{Name: "role", Value: r} }
+	cpus := MatchAttribute{Name: "cpu_count", Value: int64(16), Operator: MatchGreaterOrEqual}
+	testcases := []struct {
+		a MatchAttributes
+		m bool
+	}{
+		{MatchAttributes{{Any: []MatchAttributes{{role("db")}, {role("cache")}}}, cpus}, true},
+		{MatchAttributes{{Any: []MatchAttributes{{role("web")}, {role("cache")}}}, cpus}, false},
+		{MatchAttributes{{Any: []MatchAttributes{{role("db"), cpus}}, Negate: true}}, false},
+		{MatchAttributes{{Name: "cpu_count", Operator: MatchExists}}, true},
+		{MatchAttributes{{Name: "retired", Operator: MatchExists}}, false},
+		{MatchAttributes{{Name: "retired", Operator: MatchExists, Negate: true}}, true},
+		{MatchAttributes{{Name: "memory", Value: int64(16), Operator: MatchGreater}}, false},
+		{MatchAttributes{{Name: "memory", Value: int64(16), Operator: MatchGreater, Negate: true}}, true},
+		{MatchAttributes{{Name: "address", Value: []any{netip.MustParsePrefix("10.0.0.0/8")}, Operator: MatchIn}}, true},
+	}
+	for i, c := range testcases {
+		if m := c.a.MatchHost(host); m != c.m {
+			t.Errorf("(%d) expected %s to return %t, got %t", i, c.a, c.m, m)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package herd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mgutz/ansi"
+)
+
+var ErrPickCancelled = errors.New("Host selection cancelled")
+
+// The longest an attribute column in the picker can get
+const pickerMaxColumnWidth = 40
+
+// A hostPicker is the state of the full-screen host picker: the hosts and
+// their rows of text, the filter, which hosts match it and which hosts have
+// been selected. It knows nothing about terminals, PickHosts takes care of
+// that.
+type hostPicker struct {
+	hosts    []*Host
+	header   string
+	rows     []string
+	filter   []rune
+	matches  []int
+	selected map[int]bool
+	cursor   int
+	offset   int
+}
+
+func newHostPicker(hosts []*Host, attributes []string) *hostPicker {
+	p := &hostPicker{hosts: hosts, rows: make([]string, len(hosts)), selected: make(map[int]bool)}
+	cells := make([][]string, len(hosts))
+	widths := make([]int, len(attributes)+1)
+	widths[0] = maxNameLength(hosts)
+	for i, attr := range attributes {
+		widths[i+1] = min(utf8.RuneCountInString(attr), pickerMaxColumnWidth)
+	}
+	for i, host := range hosts {
+		cells[i] = make([]string, len(attributes)+1)
+		cells[i][0] = host.Name
+		for j, attr := range attributes {
+			value := attributeValue(host, attr)
+			if utf8.RuneCountInString(value) > pickerMaxColumnWidth {
+				value = truncate(value, pickerMaxColumnWidth-3) + "..."
+			}
+			cells[i][j+1] = value
+			widths[j+1] = max(widths[j+1], utf8.RuneCountInString(value))
+		}
+	}
+	format := func(cells []string) string {
+		parts := make([]string, len(cells))
+		for i, c := range cells {
+			parts[i] = fmt.Sprintf("%-*s", widths[i], c)
+		}
+		return strings.TrimRight(strings.Join(parts, "   "), " ")
+	}
+	if len(attributes) > 0 {
+		p.header = format(append([]string{"name"}, attributes...))
+	}
+	for i := range hosts {
+		p.rows[i] = format(cells[i])
+	}
+	p.update()
+	return p
+}
+
+// fuzzyMatch returns whether all runes of the pattern appear in the text in
+// order, ignoring case
+func fuzzyMatch(pattern, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(text, r)
+		if i == -1 {
+			return false
+		}
+		text = text[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// update recalculates which hosts match the filter. A filter can consist of
+// multiple words, separated by spaces, which all have to match.
+func (p *hostPicker) update() {
+	terms := strings.Fields(string(p.filter))
+	p.matches = p.matches[:0]
+	for i, row := range p.rows {
+		match := true
+		for _, t := range terms {
+			if !fuzzyMatch(t, row) {
+				match = false
+				break
+			}
+		}
+		if match {
+			p.matches = append(p.matches, i)
+		}
+	}
+	p.cursor = max(min(p.cursor, len(p.matches)-1), 0)
+}
+
+// handleKey processes a single key press. It returns whether the picker is
+// done, and if so, whether the selection was accepted.
+func (p *hostPicker) handleKey(k keyPress, pageSize int) (done, accepted bool) {
+	switch k.key {
+	case keyRune:
+		p.filter = append(p.filter, k.r)
+		p.update()
+	case keyBackspace:
+		if len(p.filter) > 0 {
+			p.filter = p.filter[:len(p.filter)-1]
+			p.update()
+		}
+	case keyClear:
+		p.filter = p.filter[:0]
+		p.update()
+	case keyUp:
+		p.cursor = max(p.cursor-1, 0)
+	case keyDown:
+		p.cursor = max(min(p.cursor+1, len(p.matches)-1), 0)
+	case keyPageUp:
+		p.cursor = max(p.cursor-pageSize, 0)
+	case keyPageDown:
+		p.cursor = max(min(p.cursor+pageSize, len(p.matches)-1), 0)
+	case keyHome:
+		p.cursor = 0
+	case keyEnd:
+		p.cursor = max(len(p.matches)-1, 0)
+	case keyToggle:
+		if len(p.matches) > 0 {
+			i := p.matches[p.cursor]
+			if p.selected[i] {
+				delete(p.selected, i)
+			} else {
+				p.selected[i] = true
+			}
+			p.cursor = min(p.cursor+1, len(p.matches)-1)
+		}
+	case keyToggleAll:
+		// Select all matching hosts, unless they are all selected already
+		all := true
+		for _, i := range p.matches {
+			all = all && p.selected[i]
+		}
+		for _, i := range p.matches {
+			if all {
+				delete(p.selected, i)
+			} else {
+				p.selected[i] = true
+			}
+		}
+	case keyAccept:
+		// Accepting without selecting anything picks the host under the
+		// cursor. If there is none, there's nothing to accept.
+		if len(p.selected) == 0 && len(p.matches) > 0 {
+			p.selected[p.matches[p.cursor]] = true
+		}
+		return len(p.selected) > 0, len(p.selected) > 0
+	case keyCancel, keyInterrupt:
+		return true, false
+	}
+	return false, false
+}
+
+// selection returns the selected hosts, in their original order
+func (p *hostPicker) selection() []*Host {
+	hosts := make([]*Host, 0, len(p.selected))
+	for i, host := range p.hosts {
+		if p.selected[i] {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// The filter, the status line and the optional header take up the top of the
+// screen, the rest is for hosts
+func (p *hostPicker) pageSize(height int) int {
+	if p.header != "" {
+		height--
+	}
+	return max(height-2, 1)
+}
+
+// render draws the picker on a screen of the given size, and leaves the
+// cursor at the end of the filter
+func (p *hostPicker) render(width, height int, colors ColorConfig) string {
+	page := p.pageSize(height)
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	} else if p.cursor >= p.offset+page {
+		p.offset = p.cursor - page + 1
+	}
+	p.offset = max(min(p.offset, len(p.matches)-page), 0)
+
+	var sb strings.Builder
+	sb.WriteString("\033[H")
+	sb.WriteString("> " + truncate(string(p.filter), width-2) + "\033[K\r\n")
+	status := fmt.Sprintf("  %d/%d hosts, %d selected  (tab: select, ctrl-a: select all, enter: accept, esc: cancel)", len(p.matches), len(p.hosts), len(p.selected))
+	sb.WriteString(ansi.Color(truncate(status, width), colors.Summary) + "\033[K\r\n")
+	if p.header != "" {
+		sb.WriteString(ansi.Color(truncate("  "+p.header, width), colors.Command) + "\033[K\r\n")
+	}
+	for n := 0; n < page && p.offset+n < len(p.matches); n++ {
+		idx := p.offset + n
+		i := p.matches[idx]
+		marker := "  "
+		if p.selected[i] {
+			marker = ansi.Color("* ", colors.HostOK)
+		}
+		row := truncate(p.rows[i], width-2)
+		if idx == p.cursor {
+			row = "\033[7m" + row + "\033[0m"
+		}
+		sb.WriteString(marker + row + "\033[K")
+		if n < page-1 {
+			sb.WriteString("\r\n")
+		}
+	}
+	sb.WriteString("\033[J")
+	fmt.Fprintf(&sb, "\033[1;%dH", min(len(p.filter)+3, width))
+	return sb.String()
+}
+
+// PickHosts opens a full-screen picker on the terminal that shows the current
+// hosts with the given attributes. Hosts can be filtered with a fuzzy search
+// and selected with tab. The selected hosts replace the current hosts, unless
+// the picker is cancelled.
+func (ui *SimpleUI) PickHosts(attributes []string) error {
+	if len(ui.hosts.hosts) == 0 {
+		return errors.New("No hosts to pick from")
+	}
+	ui.Sync()
+	t, err := openTerminal(os.Stdin, ui.output)
+	if err != nil {
+		return fmt.Errorf("Can't pick hosts: %w", err)
+	}
+	defer t.Close()
+
+	p := newHostPicker(ui.hosts.hosts, expandAttributes(ui.hosts.hosts, attributes))
+	buf := make([]byte, 256)
+	for {
+		width, height := t.size(ui.width, ui.height)
+		_, _ = t.out.WriteString(p.render(width, height, ui.colors))
+		n, err := t.in.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			done, accepted := p.handleKey(k, p.pageSize(height))
+			if !done {
+				continue
+			}
+			if !accepted {
+				return ErrPickCancelled
+			}
+			ui.hosts.hosts = p.selection()
+			ui.hosts.maxNameLength = maxNameLength(ui.hosts.hosts)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package herd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		match   bool
+	}{
+		{"", "web-01.example.com", true},
+		{"web01", "web-01.example.com", true},
+		{"W1EX", "web-01.example.com", true},
+		{"10", "web-01.example.com", false},
+		{"dbex", "web-01.example.com", false},
+		{"zürich", "zurich-1", false},
+		{"zür", "web-1  zürich", true},
+	}
+	for _, test := range tests {
+		if fuzzyMatch(test.pattern, test.text) != test.match {
+			t.Errorf("fuzzyMatch(%q, %q) should be %t", test.pattern, test.text, test.match)
+		}
+	}
+}
+
+func TestHostPicker(t *testing.T) {
+	hosts := []*Host{
+		NewHost("web-01.example.com", "", HostAttributes{"site": "ams1"}),
+		NewHost("web-02.example.com", "", HostAttributes{"site": "fra2"}),
+		NewHost("db-01.example.com", "", HostAttributes{"site": "ams1"}),
+		NewHost("db-02.example.com", "", HostAttributes{"site": "fra2"}),
+	}
+	names := func(hosts []*Host) string {
+		n := make([]string, len(hosts))
+		for i, h := range hosts {
+			n[i] = h.Name
+		}
+		return strings.Join(n, ",")
+	}
+	press := func(p *hostPicker, input string) (bool, bool) {
+		for _, k := range parseKeys([]byte(input)) {
+			if done, accepted := p.handleKey(k, 10); done {
+				return done, accepted
+			}
+		}
+		return false, false
+	}
+
+	// Filters match the site column too, and all words must match
+	p := newHostPicker(hosts, []string{"site"})
+	press(p, "ams")
+	if len(p.matches) != 2 {
+		t.Errorf("Expected 2 matches for ams, got %d", len(p.matches))
+	}
+	press(p, " db")
+	if len(p.matches) != 1 || p.matches[0] != 2 {
+		t.Errorf("Expected only db-01 to match, got %v", p.matches)
+	}
+	press(p, "\x15")
+	if len(p.matches) != 4 {
+		t.Errorf("Clearing the filter should match all hosts, got %v", p.matches)
+	}
+
+	// Tab selects and moves down, selection survives filtering
+	press(p, "\t\033[B\t")
+	press(p, "fra")
+	if done, accepted := press(p, "\r"); !done || !accepted {
+		t.Errorf("Enter should accept the selection")
+	}
+	if names(p.selection()) != "web-01.example.com,db-01.example.com" {
+		t.Errorf("Unexpected selection: %s", names(p.selection()))
+	}
+
+	// Select all matching hosts, and toggle them back off again
+	p = newHostPicker(hosts, nil)
+	press(p, "db\x01")
+	if names(p.selection()) != "db-01.example.com,db-02.example.com" {
+		t.Errorf("Unexpected selection: %s", names(p.selection()))
+	}
+	press(p, "\x01")
+	if len(p.selected) != 0 {
+		t.Errorf("Expected nothing to be selected, got %s", names(p.selection()))
+	}
+
+	// Without selecting, the host under the cursor is picked
+	p = newHostPicker(hosts, nil)
+	press(p, "\033[F")
+	if _, accepted := press(p, "\r"); !accepted || names(p.selection()) != "db-02.example.com" {
+		t.Errorf("Unexpected selection: %s", names(p.selection()))
+	}
+
+	// Nothing to pick, or cancelling, accepts nothing
+	p = newHostPicker(hosts, nil)
+	if _, accepted := press(p, "xyz\r"); accepted {
+		t.Errorf("Nothing should be accepted when nothing matches")
+	}
+	p = newHostPicker(hosts, nil)
+	if done, accepted := press(p, "\t\033"); !done || accepted {
+		t.Errorf("Escape should cancel the picker")
+	}
+}
+
+func TestHostPickerColumns(t *testing.T) {
+	hosts := []*Host{
+		NewHost("web-01", "", HostAttributes{"owner": "Zoë", "notes": strings.Repeat("é", 50)}),
+		NewHost("web-02", "", HostAttributes{"owner": "bob", "notes": "-"}),
+	}
+	p := newHostPicker(hosts, []string{"owner", "notes"})
+	notes := strings.Repeat("é", pickerMaxColumnWidth-3) + "..."
+	if p.rows[0] != "web-01   Zoë     "+notes {
+		t.Errorf("Unexpected first row: %q", p.rows[0])
+	}
+	if p.rows[1] != "web-02   bob     -" {
+		t.Errorf("Unexpected second row: %q", p.rows[1])
+	}
+	if p.header != "name     owner   notes" {
+		t.Errorf("Unexpected header: %q", p.header)
+	}
+}
+
+func TestHostPickerRender(t *testing.T) {
+	hosts := []*Host{}
+	for _, name := range []string{"web-01", "web-02", "web-03", "web-04", "web-05", "web-06"} {
+		hosts = append(hosts, NewHost(name, "", HostAttributes{"site": "ams1"}))
+	}
+	p := newHostPicker(hosts, []string{"site"})
+	if p.header != "name     site" || p.rows[0] != "web-01   ams1" {
+		t.Errorf("Unexpected alignment: %q %q", p.header, p.rows[0])
+	}
+	// With a height of 6, 3 hosts fit on the screen
+	for range 4 {
+		p.handleKey(keyPress{key: keyDown}, p.pageSize(6))
+	}
+	screen := p.render(80, 6, ColorConfig{})
+	for _, name := range []string{"web-03", "web-04", "web-05"} {
+		if !strings.Contains(screen, name) {
+			t.Errorf("%s should be visible: %q", name, screen)
+		}
+	}
+	for _, name := range []string{"web-02", "web-06"} {
+		if strings.Contains(screen, name) {
+			t.Errorf("%s should not be visible: %q", name, screen)
+		}
+	}
+	if !strings.Contains(screen, "\033[7mweb-05   ams1\033[0m") {
+		t.Errorf("The cursor should be on web-05: %q", screen)
+	}
+}
@@ -0,0 +1,624 @@
+package ansible
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/seveas/herd"
+
+	"gopkg.in/yaml.v2"
+)
+
+// An inventory is the combination of all hosts and groups found in inventory
+// files, inventory scripts and host_vars and group_vars directories. Like in
+// ansible itself, every host is a member of the all group, and hosts that are
+// in no other group are also a member of the ungrouped group.
+type inventory struct {
+	groups map[string]*group
+	hosts  map[string]*host
+}
+
+type group struct {
+	name     string
+	vars     map[string]any
+	children []string
+	parents  []string
+}
+
+type host struct {
+	name   string
+	vars   map[string]any
+	groups []string
+}
+
+func newInventory() *inventory {
+	inv := &inventory{groups: make(map[string]*group), hosts: make(map[string]*host)}
+	inv.group("all")
+	inv.group("ungrouped")
+	inv.addChild("all", "ungrouped")
+	return inv
+}
+
+func (inv *inventory) group(name string) *group {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &group{name: name, vars: make(map[string]any)}
+		inv.groups[name] = g
+		if name != "all" {
+			g.parents = []string{"all"}
+			inv.groups["all"].children = append(inv.groups["all"].children, name)
+		}
+	}
+	return g
+}
+
+func (inv *inventory) host(name, groupName string) *host {
+	h, ok := inv.hosts[name]
+	if !ok {
+		h = &host{name: name, vars: make(map[string]any)}
+		inv.hosts[name] = h
+	}
+	inv.group(groupName)
+	if !slices.Contains(h.groups, groupName) {
+		h.groups = append(h.groups, groupName)
+	}
+	return h
+}
+
+func (inv *inventory) addChild(parent, child string) {
+	p, c := inv.group(parent), inv.group(child)
+	if !slices.Contains(p.children, child) {
+		p.children = append(p.children, child)
+	}
+	if !slices.Contains(c.parents, parent) {
+		c.parents = append(c.parents, parent)
+	}
+}
+
+// groupsOf returns all groups a host is a member of, directly or through
+// children, ordered by their depth and name. This is the order in which
+// ansible applies group variables: variables of deeper groups win.
+func (inv *inventory) groupsOf(h *host) []*group {
+	seen := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, p := range inv.groups[name].parents {
+			visit(p)
+		}
+	}
+	for _, g := range h.groups {
+		// Hosts that are in any other group are not ungrouped
+		if g != "ungrouped" || !slices.ContainsFunc(h.groups, func(g string) bool { return g != "all" && g != "ungrouped" }) {
+			visit(g)
+		}
+	}
+	if !slices.ContainsFunc(h.groups, func(g string) bool { return g != "all" }) {
+		visit("ungrouped")
+	}
+	groups := make([]*group, 0, len(seen))
+	depths := make(map[string]int, len(seen))
+	for name := range seen {
+		groups = append(groups, inv.groups[name])
+		depths[name] = inv.depth(name, make(map[string]bool))
+	}
+	slices.SortFunc(groups, func(a, b *group) int {
+		if da, db := depths[a.name], depths[b.name]; da != db {
+			return da - db
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return groups
+}
+
+// depth is the length of the longest path from the all group to a group
+func (inv *inventory) depth(name string, seen map[string]bool) int {
+	if seen[name] {
+		return 0
+	}
+	seen[name] = true
+	defer delete(seen, name)
+	d := 0
+	for _, p := range inv.groups[name].parents {
+		d = max(d, inv.depth(p, seen)+1)
+	}
+	return d
+}
+
+// loadFile loads an inventory file. Executable files are inventory scripts,
+// files ending in .yml, .yaml or .json are yaml inventories and all other
+// files are ini inventories.
+func (inv *inventory) loadFile(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&0o111 != 0 {
+		return inv.loadScript(ctx, path)
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- Inventory files come from configuration
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml", ".json":
+		err = inv.parseYaml(data)
+	default:
+		err = inv.parseIni(data)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Files in inventory directories with these extensions are not inventories.
+var ignoredExtensions = []string{"~", ".orig", ".bak", ".cfg", ".retry", ".pyc", ".pyo", ".swp", ".md", ".txt", ".rst"}
+
+// loadDir loads all inventory files in a directory, in alphabetical order
+func (inv *inventory) loadDir(ctx context.Context, path string) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || slices.ContainsFunc(ignoredExtensions, func(ext string) bool { return strings.HasSuffix(name, ext) }) {
+			continue
+		}
+		if err = inv.loadFile(ctx, filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseIni parses ini inventories: a list of hosts, optionally with
+// variables, per group, and [group:vars] and [group:children] sections
+func (inv *inventory) parseIni(data []byte) error {
+	section, kind := "ungrouped", "hosts"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end == -1 {
+				return fmt.Errorf("line %d: invalid section header: %s", lineno, line)
+			}
+			section, kind = line[1:end], "hosts"
+			if i := strings.LastIndexByte(section, ':'); i != -1 {
+				section, kind = section[:i], section[i+1:]
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return fmt.Errorf("line %d: invalid section type: %s", lineno, kind)
+			}
+			inv.group(section)
+			continue
+		}
+		switch kind {
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return fmt.Errorf("line %d: expected key=value, got %s", lineno, line)
+			}
+			inv.group(section).vars[strings.TrimSpace(k)] = parseValue(unquote(strings.TrimSpace(v)))
+		case "children":
+			inv.addChild(section, strings.Fields(line)[0])
+		case "hosts":
+			fields, err := splitFields(line)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineno, err)
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			vars := make(map[string]any)
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok {
+					return fmt.Errorf("line %d: expected key=value, got %s", lineno, f)
+				}
+				vars[k] = parseValue(v)
+			}
+			if err = inv.addHosts(fields[0], section, vars); err != nil {
+				return fmt.Errorf("line %d: %w", lineno, err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// addHosts adds all hosts matching a host pattern, which can contain ranges
+// and a port, to a group
+func (inv *inventory) addHosts(pattern, groupName string, vars map[string]any) error {
+	pattern, port := splitPort(pattern)
+	names, err := expandRanges(pattern)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		h := inv.host(name, groupName)
+		if port != 0 {
+			h.vars["ansible_port"] = port
+		}
+		for k, v := range vars {
+			h.vars[k] = v
+		}
+	}
+	return nil
+}
+
+type yamlGroup struct {
+	Hosts    map[string]map[string]any
+	Vars     map[string]any
+	Children map[string]*yamlGroup
+}
+
+// parseYaml parses yaml inventories, which are nested mappings of groups with
+// hosts, vars and children
+func (inv *inventory) parseYaml(data []byte) error {
+	var groups map[string]*yamlGroup
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return err
+	}
+	for name, g := range groups {
+		if err := inv.addYamlGroup(name, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (inv *inventory) addYamlGroup(name string, yg *yamlGroup) error {
+	g := inv.group(name)
+	if yg == nil {
+		return nil
+	}
+	for k, v := range yg.Vars {
+		g.vars[k] = herd.NormalizeValue(v)
+	}
+	for pattern, vars := range yg.Hosts {
+		for k, v := range vars {
+			vars[k] = herd.NormalizeValue(v)
+		}
+		if err := inv.addHosts(pattern, name, vars); err != nil {
+			return err
+		}
+	}
+	for child, cg := range yg.Children {
+		inv.addChild(name, child)
+		if err := inv.addYamlGroup(child, cg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadScript runs a dynamic inventory script with --list. Scripts that do not
+// return hostvars in their _meta section are asked for the variables of each
+// host with --host.
+func (inv *inventory) loadScript(ctx context.Context, path string) error {
+	data, err := runScript(ctx, path, "--list")
+	if err != nil {
+		return err
+	}
+	var groups map[string]json.RawMessage
+	if err = json.Unmarshal(data, &groups); err != nil {
+		return fmt.Errorf("Unable to parse output of %s: %w", path, err)
+	}
+	var meta struct {
+		Hostvars map[string]map[string]any
+	}
+	metaFound := false
+	hosts := make(map[string]*host)
+	if m, ok := groups["_meta"]; ok {
+		if err = decodeJson(m, &meta); err != nil {
+			return fmt.Errorf("Unable to parse output of %s: %w", path, err)
+		}
+		metaFound = meta.Hostvars != nil
+		delete(groups, "_meta")
+	}
+	for name, raw := range groups {
+		var sg struct {
+			Hosts    []string
+			Vars     map[string]any
+			Children []string
+		}
+		// Groups can also be just a list of hosts
+		if err = json.Unmarshal(raw, &sg.Hosts); err != nil {
+			if err = decodeJson(raw, &sg); err != nil {
+				return fmt.Errorf("Unable to parse group %s in output of %s: %w", name, path, err)
+			}
+		}
+		g := inv.group(name)
+		for k, v := range sg.Vars {
+			g.vars[k] = herd.NormalizeValue(v)
+		}
+		for _, h := range sg.Hosts {
+			hosts[h] = inv.host(h, name)
+		}
+		for _, c := range sg.Children {
+			inv.addChild(name, c)
+		}
+	}
+	for name, h := range hosts {
+		vars, ok := meta.Hostvars[name]
+		if !ok && !metaFound {
+			if data, err = runScript(ctx, path, "--host", name); err != nil {
+				return err
+			}
+			if err = decodeJson(data, &vars); err != nil {
+				return fmt.Errorf("Unable to parse output of %s --host %s: %w", path, name, err)
+			}
+		}
+		for k, v := range vars {
+			h.vars[k] = herd.NormalizeValue(v)
+		}
+	}
+	return nil
+}
+
+func runScript(ctx context.Context, path string, args ...string) ([]byte, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...) // #nosec G204 -- Inventory scripts come from configuration
+	cmd.Dir = filepath.Dir(path)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Inventory script %s failed: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func decodeJson(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// loadVars loads variables from the host_vars and group_vars directories next
+// to an inventory. Variables can be in a file named after the host or group,
+// optionally with a .yml, .yaml or .json extension, or in all files in a
+// directory named after the host or group.
+func (inv *inventory) loadVars(dir string) error {
+	for name, g := range inv.groups {
+		if err := loadVarsFor(filepath.Join(dir, "group_vars"), name, g.vars); err != nil {
+			return err
+		}
+	}
+	for name, h := range inv.hosts {
+		if err := loadVarsFor(filepath.Join(dir, "host_vars"), name, h.vars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadVarsFor(dir, name string, vars map[string]any) error {
+	files := []string{}
+	for _, ext := range []string{"", ".yml", ".yaml", ".json"} {
+		path := filepath.Join(dir, name+ext)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file) // #nosec G304 -- Variable files next to the inventory
+		if err != nil {
+			return err
+		}
+		// Encrypted files can't be read without the vault password
+		if bytes.HasPrefix(data, []byte("$ANSIBLE_VAULT")) {
+			continue
+		}
+		var v map[string]any
+		if err = yaml.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("Unable to parse %s: %w", file, err)
+		}
+		for k, val := range v {
+			vars[k] = herd.NormalizeValue(val)
+		}
+	}
+	return nil
+}
+
+// splitFields splits a line of an ini inventory the way a shell would, and
+// strips comments
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	var quote rune
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				field.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inField = c, true
+		case c == '#':
+			if inField {
+				fields = append(fields, field.String())
+			}
+			return fields, nil
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(c)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %s", line)
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parseValue interprets values in ini inventories the way ansible does for
+// the most common types: numbers and python booleans
+func parseValue(s string) any {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	switch s {
+	case "True":
+		return true
+	case "False":
+		return false
+	}
+	return s
+}
+
+// splitPort splits host:port patterns, leaving ipv6 addresses alone. Ranges
+// contain colons too, so only colons outside square brackets are counted.
+func splitPort(pattern string) (string, int64) {
+	colons, last, depth := 0, -1, 0
+	for i, c := range pattern {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				colons++
+				last = i
+			}
+		}
+	}
+	if colons != 1 {
+		return pattern, 0
+	}
+	port, err := strconv.ParseInt(pattern[last+1:], 10, 64)
+	if err != nil {
+		return pattern, 0
+	}
+	return pattern[:last], port
+}
+
+// expandRanges expands numeric and alphabetic ranges in host patterns, such
+// as web[01:20].example.com or db-[a:f]. Ranges can have a step, as in
+// [1:9:2], and numbers with leading zeroes are padded to the same length.
+func expandRanges(pattern string) ([]string, error) {
+	start := strings.IndexByte(pattern, '[')
+	if start == -1 {
+		return []string{pattern}, nil
+	}
+	end := strings.IndexByte(pattern[start:], ']')
+	if end == -1 {
+		return nil, fmt.Errorf("invalid range in %s", pattern)
+	}
+	end += start
+	head, rng, tail := pattern[:start], pattern[start+1:end], pattern[end+1:]
+	parts := strings.Split(rng, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		// Not a range, for example an ipv6 address in brackets
+		return []string{pattern}, nil
+	}
+	step := 1
+	if len(parts) == 3 {
+		s, err := strconv.Atoi(parts[2])
+		if err != nil || s < 1 {
+			return nil, fmt.Errorf("invalid range step in %s", pattern)
+		}
+		step = s
+	}
+	var values []string
+	if len(parts[0]) == 1 && len(parts[1]) == 1 && isLetter(parts[0][0]) && isLetter(parts[1][0]) {
+		if parts[0][0] > parts[1][0] {
+			return nil, fmt.Errorf("invalid range in %s: start is after end", pattern)
+		}
+		for c := int(parts[0][0]); c <= int(parts[1][0]); c += step {
+			values = append(values, string(rune(c)))
+		}
+	} else {
+		if parts[0] == "" {
+			parts[0] = "0"
+		}
+		from, err1 := strconv.Atoi(parts[0])
+		to, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid range in %s", pattern)
+		}
+		if from > to {
+			return nil, fmt.Errorf("invalid range in %s: start is after end", pattern)
+		}
+		width := 0
+		if len(parts[0]) > 1 && parts[0][0] == '0' {
+			width = len(parts[0])
+		}
+		for i := from; i <= to; i += step {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+	}
+	tails, err := expandRanges(tail)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values)*len(tails))
+	for _, v := range values {
+		for _, t := range tails {
+			names = append(names, head+v+t)
+		}
+	}
+	return names, nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,102 @@
+package ansible
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/seveas/herd"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("ansible", newProvider, nil)
+}
+
+// The ansible provider reads ansible inventories: ini and yaml files,
+// inventory scripts and directories containing any of those. Group membership
+// is available as the group attribute, and all variables of a host, including
+// those from host_vars and group_vars, become host attributes.
+type ansibleProvider struct {
+	name   string
+	config struct {
+		File   string
+		Prefix string
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	return &ansibleProvider{name: name}
+}
+
+func (p *ansibleProvider) Name() string {
+	return p.name
+}
+
+func (p *ansibleProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *ansibleProvider) Equivalent(o herd.HostProvider) bool {
+	return p.config.File == o.(*ansibleProvider).config.File
+}
+
+func (p *ansibleProvider) SetDataDir(dir string) error {
+	if !filepath.IsAbs(p.config.File) {
+		p.config.File = filepath.Join(dir, p.config.File)
+		_, err := os.Stat(p.config.File)
+		return err
+	}
+	return nil
+}
+
+func (p *ansibleProvider) ParseViper(v *viper.Viper) error {
+	return v.Unmarshal(&p.config)
+}
+
+func (p *ansibleProvider) Load(ctx context.Context, lm herd.LoadingMessage) (*herd.HostSet, error) {
+	info, err := os.Stat(p.config.File)
+	if err != nil {
+		return nil, err
+	}
+	inv := newInventory()
+	dir := filepath.Dir(p.config.File)
+	if info.IsDir() {
+		dir = p.config.File
+		err = inv.loadDir(ctx, p.config.File)
+	} else {
+		err = inv.loadFile(ctx, p.config.File)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = inv.loadVars(dir); err != nil {
+		return nil, err
+	}
+
+	hosts := herd.NewHostSet()
+	for _, h := range inv.hosts {
+		attrs := make(herd.HostAttributes)
+		groups := []string{}
+		for _, g := range inv.groupsOf(h) {
+			for k, v := range g.vars {
+				attrs[k] = v
+			}
+			if g.name != "all" && g.name != "ungrouped" {
+				groups = append(groups, g.name)
+			}
+		}
+		for k, v := range h.vars {
+			attrs[k] = v
+		}
+		slices.Sort(groups)
+		attrs["group"] = groups
+		address, _ := attrs["ansible_host"].(string)
+		hosts.AddHost(herd.NewHost(h.name, address, attrs))
+	}
+	return hosts, nil
+}
+
+var _ herd.DataLoader = &ansibleProvider{}
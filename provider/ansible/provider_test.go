@@ -0,0 +1,143 @@
+package ansible
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seveas/herd"
+)
+
+func TestExpandRanges(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"web01.example.com", []string{"web01.example.com"}},
+		{"web[01:03].example.com", []string{"web01.example.com", "web02.example.com", "web03.example.com"}},
+		{"web[8:10]", []string{"web8", "web9", "web10"}},
+		{"web[1:7:3]", []string{"web1", "web4", "web7"}},
+		{"db-[a:c]", []string{"db-a", "db-b", "db-c"}},
+		{"rack[1:2]-[a:b]", []string{"rack1-a", "rack1-b", "rack2-a", "rack2-b"}},
+		{"[2001:db8::1]", []string{"[2001:db8::1]"}},
+	}
+	for _, test := range tests {
+		names, err := expandRanges(test.pattern)
+		if err != nil {
+			t.Errorf("Unable to expand %s: %s", test.pattern, err)
+		} else if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s expanded to %v, expected %v", test.pattern, names, test.expected)
+		}
+	}
+	for _, pattern := range []string{"web[3:1]", "web[1:3", "web[a:3]", "web[1:3:0]"} {
+		if _, err := expandRanges(pattern); err == nil {
+			t.Errorf("Expected an error expanding %s", pattern)
+		}
+	}
+}
+
+func TestSplitPort(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		port    int64
+	}{
+		{"web01.example.com", "web01.example.com", 0},
+		{"web01.example.com:2222", "web01.example.com", 2222},
+		{"web[01:20].example.com", "web[01:20].example.com", 0},
+		{"web[01:20]:2222", "web[01:20]", 2222},
+		{"web[1:9:2].example.com:22", "web[1:9:2].example.com", 22},
+		{"2001:db8::1", "2001:db8::1", 0},
+		{"[2001:db8::1]:22", "[2001:db8::1]", 22},
+		{"web01:ssh", "web01:ssh", 0},
+	}
+	for _, test := range tests {
+		if name, port := splitPort(test.pattern); name != test.name || port != test.port {
+			t.Errorf("Expected %s to be split into %s and %d, got %s and %d", test.pattern, test.name, test.port, name, port)
+		}
+	}
+}
+
+func load(t *testing.T, file string) map[string]*herd.Host {
+	t.Helper()
+	p := newProvider("ansible").(*ansibleProvider)
+	p.config.File = file
+	if err := p.SetDataDir("testdata"); err != nil {
+		t.Fatalf("Unable to find %s: %s", file, err)
+	}
+	hosts, err := p.Load(t.Context(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Unable to load %s: %s", file, err)
+	}
+	ret := make(map[string]*herd.Host)
+	for i := 0; i < hosts.Len(); i++ {
+		ret[hosts.Get(i).Name] = hosts.Get(i)
+	}
+	return ret
+}
+
+func checkAttributes(t *testing.T, h *herd.Host, expected herd.HostAttributes) {
+	t.Helper()
+	if h == nil {
+		t.Errorf("Host not found")
+		return
+	}
+	for k, v := range expected {
+		if !reflect.DeepEqual(h.Attributes[k], v) {
+			t.Errorf("%s: expected %s to be %#v, got %#v", h.Name, k, v, h.Attributes[k])
+		}
+	}
+}
+
+func TestIniInventory(t *testing.T) {
+	hosts := load(t, "ini/hosts")
+	if len(hosts) != 8 {
+		t.Errorf("Expected 8 hosts, got %d", len(hosts))
+	}
+	checkAttributes(t, hosts["mail.example.com"], herd.HostAttributes{"group": []string{}, "ntp_server": "ntp.example.com", "timezone": "UTC"})
+	// Host vars from host_vars win over inline vars, group vars of deeper
+	// groups win over those of their parents
+	checkAttributes(t, hosts["web01.example.com"], herd.HostAttributes{
+		"group":      []string{"ams1", "datacenters", "webservers"},
+		"http_port":  int64(8443),
+		"ntp_server": "ntp.ams1.example.com",
+		"owner":      "frontend-team",
+		"timezone":   "UTC",
+	})
+	checkAttributes(t, hosts["web02.example.com"], herd.HostAttributes{"group": []string{"webservers"}, "http_port": int64(8080), "ntp_server": "ntp.web.example.com"})
+	checkAttributes(t, hosts["web04.example.com"], herd.HostAttributes{
+		"ansible_port": int64(2222),
+		"http_port":    int64(80),
+		"maintenance":  true,
+		"comment":      "Replacement due",
+	})
+	if h := hosts["web04.example.com"]; h != nil && h.Address != "192.0.2.4" {
+		t.Errorf("ansible_host not used as address")
+	}
+	checkAttributes(t, hosts["db-c.example.com"], herd.HostAttributes{"group": []string{"dbservers"}})
+	if m := (herd.MatchAttribute{Name: "group", Value: "datacenters"}); !m.MatchHost(hosts["db-a.example.com"]) || m.MatchHost(hosts["db-b.example.com"]) {
+		t.Errorf("Unable to match on groups")
+	}
+}
+
+func TestYamlInventory(t *testing.T) {
+	hosts := load(t, "yaml/hosts.yml")
+	if len(hosts) != 4 {
+		t.Errorf("Expected 4 hosts, got %d", len(hosts))
+	}
+	checkAttributes(t, hosts["mail.example.com"], herd.HostAttributes{"group": []string{}})
+	checkAttributes(t, hosts["web02.example.com"], herd.HostAttributes{"group": []string{"webservers"}, "http_port": int64(8080), "packages": []any{"nginx", "certbot"}})
+	checkAttributes(t, hosts["db01.example.com"], herd.HostAttributes{"disks": map[string]any{"data": "/dev/sdb"}})
+	if h := hosts["db01.example.com"]; h != nil && h.Address != "192.0.2.10" {
+		t.Errorf("ansible_host not used as address")
+	}
+}
+
+func TestInventoryScripts(t *testing.T) {
+	hosts := load(t, "scripts")
+	if len(hosts) != 3 {
+		t.Errorf("Expected 3 hosts, got %d", len(hosts))
+	}
+	checkAttributes(t, hosts["web01.example.com"], herd.HostAttributes{"group": []string{"webservers"}, "http_port": int64(80), "ansible_host": "192.0.2.1"})
+	checkAttributes(t, hosts["web02.example.com"], herd.HostAttributes{"group": []string{"canary", "webservers"}, "http_port": int64(80)})
+	checkAttributes(t, hosts["db01.example.com"], herd.HostAttributes{"group": []string{"dbservers"}, "replicas": int64(2)})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -14,8 +15,9 @@ import (
 )
 
 type fakeProvider struct {
-	loaded  int
-	doError bool
+	loaded     int
+	doError    bool
+	attributes herd.HostAttributes
 }
 
 func (p *fakeProvider) Name() string {
@@ -33,7 +35,11 @@ func (p *fakeProvider) Equivalent(o herd.HostProvider) bool {
 func (p *fakeProvider) Load(ctx context.Context, lm herd.LoadingMessage) (*herd.HostSet, error) {
 	p.loaded++
 	hosts := new(herd.HostSet)
-	hosts.AddHost(herd.NewHost("test-host", "", herd.HostAttributes{"foo": "bar"}))
+	attributes := p.attributes
+	if attributes == nil {
+		attributes = herd.HostAttributes{"foo": "bar"}
+	}
+	hosts.AddHost(herd.NewHost("test-host", "", attributes))
 	if p.doError {
 		return hosts, fmt.Errorf("You wanted an error")
 	}
@@ -82,6 +88,26 @@ func TestCache(t *testing.T) {
 	}
 }
 
+func TestCacheNestedValues(t *testing.T) {
+	tmpdir := t.TempDir()
+	p := &fakeProvider{attributes: herd.HostAttributes{
+		"vars": map[string]any{"port": int64(2222), "ratio": 0.5, "disks": []any{int64(1), int64(2)}},
+	}}
+	c := NewFromProvider(p).(*Cache)
+	c.config.Lifetime = 1 * time.Hour
+	c.SetCacheDir(filepath.Join(tmpdir, "cache"))
+	if _, err := c.Load(t.Context(), func(string, bool, error) {}); err != nil {
+		t.Fatalf("First cache load did not succeed: %s", err)
+	}
+	hosts, err := c.Load(t.Context(), func(string, bool, error) {})
+	if err != nil || p.loaded != 1 {
+		t.Fatalf("Second cache load did not come from the cache: %d loads, %v", p.loaded, err)
+	}
+	if vars := hosts.Get(0).Attributes["vars"]; !reflect.DeepEqual(vars, p.attributes["vars"]) {
+		t.Errorf("Nested values did not survive the cache: %#v", vars)
+	}
+}
+
 func TestRelativeFiles(t *testing.T) {
 	tmpdir := t.TempDir()
 	r := herd.NewRegistry("/foo", filepath.Join(tmpdir, "cache"))
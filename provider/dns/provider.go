@@ -0,0 +1,306 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"github.com/miekg/dns"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("dns", newProvider, nil)
+}
+
+// The dns provider finds hosts in DNS, either by transferring whole zones or
+// by looking up a list of names. Names starting with an underscore are SRV
+// records, and all hosts they point to are returned. All other names are
+// looked up as A and AAAA records.
+type dnsProvider struct {
+	name   string
+	config struct {
+		Prefix        string
+		Server        string
+		Zones         []string
+		Records       []string
+		TsigName      string
+		TsigSecret    string
+		TsigAlgorithm string
+		Timeout       time.Duration
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	p := &dnsProvider{name: name}
+	p.config.TsigAlgorithm = dns.HmacSHA256
+	p.config.Timeout = 10 * time.Second
+	return p
+}
+
+func (p *dnsProvider) Name() string {
+	return p.name
+}
+
+func (p *dnsProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *dnsProvider) Equivalent(o herd.HostProvider) bool {
+	op := o.(*dnsProvider)
+	return p.config.Server == op.config.Server &&
+		reflect.DeepEqual(p.config.Zones, op.config.Zones) &&
+		reflect.DeepEqual(p.config.Records, op.config.Records)
+}
+
+func (p *dnsProvider) ParseViper(v *viper.Viper) error {
+	if err := v.Unmarshal(&p.config); err != nil {
+		return err
+	}
+	if len(p.config.Zones) == 0 && len(p.config.Records) == 0 {
+		return fmt.Errorf("No zones or records specified")
+	}
+	if p.config.TsigName != "" {
+		p.config.TsigName = dns.Fqdn(strings.ToLower(p.config.TsigName))
+		p.config.TsigAlgorithm = dns.Fqdn(strings.ToLower(p.config.TsigAlgorithm))
+	}
+	return nil
+}
+
+// server returns the configured server, or the first nameserver from
+// resolv.conf
+func (p *dnsProvider) server() (string, error) {
+	server := p.config.Server
+	if server == "" {
+		cc, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return "", fmt.Errorf("No server configured and unable to read resolv.conf: %w", err)
+		}
+		if len(cc.Servers) == 0 {
+			return "", fmt.Errorf("No server configured and no nameservers found in resolv.conf")
+		}
+		server = cc.Servers[0]
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return server, nil
+}
+
+func (p *dnsProvider) Load(ctx context.Context, lm herd.LoadingMessage) (*herd.HostSet, error) {
+	lm(p.name, false, nil)
+	server, err := p.server()
+	if err != nil {
+		return nil, err
+	}
+	records := []dns.RR{}
+	for _, zone := range p.config.Zones {
+		rrs, err := p.transfer(ctx, zone, server)
+		if err != nil {
+			return nil, fmt.Errorf("Zone transfer of %s from %s failed: %w", zone, server, err)
+		}
+		records = append(records, rrs...)
+	}
+	if len(p.config.Records) != 0 {
+		rrs, err := p.lookup(ctx, server)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rrs...)
+	}
+	return hostsFromRecords(records), nil
+}
+
+// transfer fetches all records in a zone with AXFR. The transfer can't be
+// cancelled, so we dial the connection ourselves and close it when the
+// context is done.
+func (p *dnsProvider) transfer(ctx context.Context, zone, server string) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(dns.Fqdn(zone))
+	d := &net.Dialer{Timeout: p.config.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	t := &dns.Transfer{Conn: &dns.Conn{Conn: conn}, ReadTimeout: p.config.Timeout}
+	if p.config.TsigName != "" {
+		m.SetTsig(p.config.TsigName, p.config.TsigAlgorithm, 300, time.Now().Unix())
+		t.TsigSecret = map[string]string{p.config.TsigName: p.config.TsigSecret}
+	}
+	env, err := t.In(m, server)
+	if err != nil {
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	records := []dns.RR{}
+	for e := range env {
+		if e.Error != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, e.Error
+		}
+		records = append(records, e.RR...)
+	}
+	return records, nil
+}
+
+// lookup queries all configured records, and the addresses, TXT and SSHFP
+// records of the hosts that SRV records point to
+func (p *dnsProvider) lookup(ctx context.Context, server string) ([]dns.RR, error) {
+	c := &dns.Client{Timeout: p.config.Timeout}
+	records := []dns.RR{}
+	names := []string{}
+	for _, name := range p.config.Records {
+		name = dns.Fqdn(name)
+		if !strings.HasPrefix(name, "_") {
+			names = append(names, name)
+			continue
+		}
+		rrs, err := query(ctx, c, server, name, dns.TypeSRV)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rrs...)
+		for _, rr := range rrs {
+			if srv, ok := rr.(*dns.SRV); ok && !slices.Contains(names, srv.Target) {
+				names = append(names, srv.Target)
+			}
+		}
+	}
+	for _, name := range names {
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeSSHFP} {
+			rrs, err := query(ctx, c, server, name, qtype)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rrs...)
+		}
+	}
+	return records, nil
+}
+
+func query(ctx context.Context, c *dns.Client, server, name string, qtype uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = true
+	resp, _, err := c.ExchangeContext(ctx, m, server)
+	if err == nil && resp.Truncated {
+		tc := *c
+		tc.Net = "tcp"
+		resp, _, err = tc.ExchangeContext(ctx, m, server)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to look up %s %s: %w", dns.TypeToString[qtype], name, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("Unable to look up %s %s: %s", dns.TypeToString[qtype], name, dns.RcodeToString[resp.Rcode])
+	}
+	return resp.Answer, nil
+}
+
+// hostsFromRecords turns every name with an A or AAAA record into a host.
+// Other records for the same name, and CNAME and SRV records that point to
+// it, become attributes of that host.
+func hostsFromRecords(records []dns.RR) *herd.HostSet {
+	byName := make(map[string][]dns.RR)
+	aliases := make(map[string][]string)
+	services := make(map[string][]*dns.SRV)
+	for _, rr := range records {
+		name := strings.ToLower(rr.Header().Name)
+		byName[name] = append(byName[name], rr)
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			target := strings.ToLower(rr.Target)
+			aliases[target] = append(aliases[target], strings.TrimSuffix(name, "."))
+		case *dns.SRV:
+			target := strings.ToLower(rr.Target)
+			services[target] = append(services[target], rr)
+		}
+	}
+
+	hosts := herd.NewHostSet()
+	for name, rrs := range byName {
+		var addresses []string
+		var ttl uint32
+		types := []string{}
+		txt := make(map[string]any)
+		txtRecords := []string{}
+		sshfp := []herd.SSHFP{}
+		for _, rr := range rrs {
+			t := dns.TypeToString[rr.Header().Rrtype]
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+			switch rr := rr.(type) {
+			case *dns.A:
+				addresses = append(addresses, rr.A.String())
+			case *dns.AAAA:
+				addresses = append(addresses, rr.AAAA.String())
+			case *dns.TXT:
+				s := strings.Join(rr.Txt, "")
+				txtRecords = append(txtRecords, s)
+				if k, v, ok := strings.Cut(s, "="); ok {
+					txt[k] = v
+				}
+				continue
+			case *dns.SSHFP:
+				sshfp = append(sshfp, herd.SSHFP{Algorithm: rr.Algorithm, Type: rr.Type, Fingerprint: strings.ToLower(rr.FingerPrint)})
+				continue
+			default:
+				continue
+			}
+			if ttl == 0 || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+		if len(addresses) == 0 {
+			continue
+		}
+		// Prefer ipv4 addresses, like most other providers do
+		slices.SortStableFunc(addresses, func(a, b string) int {
+			return strings.Count(a, ":") - strings.Count(b, ":")
+		})
+		slices.Sort(types)
+		srv := []map[string]any{}
+		srvNames := []string{}
+		for _, s := range services[name] {
+			service := strings.TrimSuffix(strings.ToLower(s.Hdr.Name), ".")
+			srv = append(srv, map[string]any{"service": service, "port": int64(s.Port), "priority": int64(s.Priority), "weight": int64(s.Weight)})
+			if !slices.Contains(srvNames, service) {
+				srvNames = append(srvNames, service)
+			}
+		}
+		fps := make([]string, len(sshfp))
+		for i, fp := range sshfp {
+			fps[i] = fp.String()
+		}
+		host := herd.NewHost(strings.TrimSuffix(name, "."), addresses[0], herd.HostAttributes{
+			"addresses":    addresses,
+			"record_types": types,
+			"ttl":          int64(ttl),
+			"aliases":      append([]string{}, aliases[name]...),
+			"txt":          txt,
+			"txt_records":  txtRecords,
+			"sshfp":        fps,
+			"srv":          srv,
+			"services":     srvNames,
+		})
+		for _, fp := range sshfp {
+			host.AddSSHFP(fp)
+		}
+		hosts.AddHost(host)
+	}
+	return hosts
+}
@@ -0,0 +1,224 @@
+package dns
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/ssh"
+)
+
+const zone = `$ORIGIN example.com.
+$TTL 3600
+@         IN SOA   ns1 hostmaster 1 7200 3600 1209600 3600
+@         IN NS    ns1
+ns1       IN A     192.0.2.53
+web01     IN A     192.0.2.1
+web01     IN AAAA  2001:db8::1
+web01 300 IN A     192.0.2.101
+web01     IN TXT   "role=web" "server"
+web01     IN TXT   "owner=frontend-team"
+web01     IN TXT   "no metadata"
+web01     IN SSHFP 4 2 %s
+www       IN CNAME web01
+web02     IN AAAA  2001:db8::2
+_http._tcp IN SRV  10 5 8080 web01
+_http._tcp IN SRV  20 5 8080 web02
+mail      IN MX    10 web02
+`
+
+// startServer serves a zone over udp and tcp, and allows transfers of it
+// only with the test TSIG key
+func startServer(t *testing.T, records []dns.RR) string {
+	t.Helper()
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		q := r.Question[0]
+		if q.Qtype == dns.TypeAXFR {
+			if r.IsTsig() == nil || w.TsigStatus() != nil {
+				m := new(dns.Msg)
+				m.SetRcode(r, dns.RcodeRefused)
+				_ = w.WriteMsg(m)
+				return
+			}
+			ch := make(chan *dns.Envelope, 1)
+			ch <- &dns.Envelope{RR: append(records, records[0])}
+			close(ch)
+			tr := new(dns.Transfer)
+			_ = tr.Out(w, r, ch)
+			w.Hijack()
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, rr := range records {
+			if strings.EqualFold(rr.Header().Name, q.Name) && rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		_ = w.WriteMsg(m)
+	})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := map[string]string{"herd.": "c2VjcmV0LXNlY3JldC1zZWNyZXQ="}
+	var wg sync.WaitGroup
+	for _, s := range []*dns.Server{{PacketConn: pc, Handler: handler}, {Listener: l, Handler: handler, TsigSecret: secret}} {
+		wg.Add(1)
+		s.NotifyStartedFunc = wg.Done
+		go func() { _ = s.ActivateAndServe() }()
+		t.Cleanup(func() { _ = s.Shutdown() })
+	}
+	wg.Wait()
+	return pc.LocalAddr().String()
+}
+
+func TestDns(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := fmt.Sprintf("%x", sha256.Sum256(key.Marshal()))
+	records := []dns.RR{}
+	zp := dns.NewZoneParser(strings.NewReader(fmt.Sprintf(zone, fp)), "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records = append(records, rr)
+	}
+	if err = zp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	server := startServer(t, records)
+
+	load := func(t *testing.T, configure func(p *dnsProvider)) map[string]*herd.Host {
+		t.Helper()
+		p := newProvider("dns").(*dnsProvider)
+		p.config.Server = server
+		configure(p)
+		hosts, err := p.Load(t.Context(), func(string, bool, error) {})
+		if err != nil {
+			t.Fatalf("Unable to load hosts: %s", err)
+		}
+		ret := make(map[string]*herd.Host)
+		for i := 0; i < hosts.Len(); i++ {
+			ret[hosts.Get(i).Name] = hosts.Get(i)
+		}
+		return ret
+	}
+
+	t.Run("axfr", func(t *testing.T) {
+		hosts := load(t, func(p *dnsProvider) {
+			p.config.Zones = []string{"example.com"}
+			p.config.TsigName = "herd."
+			p.config.TsigSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+			p.config.TsigAlgorithm = dns.HmacSHA256
+		})
+		if len(hosts) != 3 {
+			t.Errorf("Expected 3 hosts, got %d", len(hosts))
+		}
+		web01, web02 := hosts["web01.example.com"], hosts["web02.example.com"]
+		if web01 == nil || web02 == nil {
+			t.Fatalf("Hosts missing: %v", hosts)
+		}
+		if web01.Address != "192.0.2.1" || web02.Address != "2001:db8::2" {
+			t.Errorf("Unexpected addresses: %s, %s", web01.Address, web02.Address)
+		}
+		expected := herd.HostAttributes{
+			"addresses":    []string{"192.0.2.1", "192.0.2.101", "2001:db8::1"},
+			"record_types": []string{"A", "AAAA", "SSHFP", "TXT"},
+			"ttl":          int64(300),
+			"aliases":      []string{"www.example.com"},
+			"txt":          map[string]any{"role": "webserver", "owner": "frontend-team"},
+			"txt_records":  []string{"role=webserver", "owner=frontend-team", "no metadata"},
+			"sshfp":        []string{"4 2 " + fp},
+			"services":     []string{"_http._tcp.example.com"},
+		}
+		for k, v := range expected {
+			if !reflect.DeepEqual(web01.Attributes[k], v) {
+				t.Errorf("Expected %s to be %#v, got %#v", k, v, web01.Attributes[k])
+			}
+		}
+		if v, _ := web02.GetAttribute("srv[0].priority"); v != int64(20) {
+			t.Errorf("Unexpected srv records: %v", web02.Attributes["srv"])
+		}
+		if !slices.Equal(web01.SSHFPs(), []herd.SSHFP{{Algorithm: 4, Type: 2, Fingerprint: fp}}) {
+			t.Errorf("Unexpected sshfp records: %v", web01.SSHFPs())
+		}
+	})
+
+	t.Run("axfr without tsig", func(t *testing.T) {
+		p := newProvider("dns").(*dnsProvider)
+		p.config.Server = server
+		p.config.Zones = []string{"example.com"}
+		if _, err := p.Load(t.Context(), func(string, bool, error) {}); err == nil {
+			t.Errorf("Expected refused zone transfer without TSIG")
+		}
+	})
+
+	t.Run("records", func(t *testing.T) {
+		hosts := load(t, func(p *dnsProvider) {
+			p.config.Records = []string{"_http._tcp.example.com", "ns1.example.com"}
+		})
+		if len(hosts) != 3 {
+			t.Errorf("Expected 3 hosts, got %d", len(hosts))
+		}
+		web01 := hosts["web01.example.com"]
+		if web01 == nil || len(web01.SSHFPs()) != 1 || web01.Attributes["txt"].(map[string]any)["owner"] != "frontend-team" {
+			t.Errorf("TXT and SSHFP records not found for web01: %v", web01)
+		}
+		if ns1 := hosts["ns1.example.com"]; ns1 == nil || ns1.Address != "192.0.2.53" {
+			t.Errorf("A record not found for ns1: %v", ns1)
+		}
+	})
+}
+
+func TestTransferCancelled(t *testing.T) {
+	// A server that accepts the connection, but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			_, _ = io.Copy(io.Discard, conn)
+		}
+	}()
+
+	p := newProvider("dns").(*dnsProvider)
+	p.config.Server = l.Addr().String()
+	p.config.Zones = []string{"example.com"}
+	p.config.Timeout = time.Minute
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.Load(ctx, func(string, bool, error) {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the transfer to be cancelled, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Cancelling the transfer took %s", time.Since(start))
+	}
+}
@@ -88,7 +88,7 @@ func (p *knownHostsProvider) LoadHostKeys(ctx context.Context, lm herd.LoadingMe
 			continue
 		}
 		for {
-			_, matches, key, _, rest, err := ssh.ParseKnownHosts(data)
+			marker, matches, key, _, rest, err := ssh.ParseKnownHosts(data)
 			if err == io.EOF {
 				break
 			}
@@ -98,6 +98,10 @@ func (p *knownHostsProvider) LoadHostKeys(ctx context.Context, lm herd.LoadingMe
 				continue
 			}
 			data = rest
+			// Certificate authorities and revoked keys are not host keys
+			if marker != "" {
+				continue
+			}
 			name := matches[0]
 			if strings.HasPrefix(name, "|") {
 				if !hashed {
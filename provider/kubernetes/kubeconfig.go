@@ -0,0 +1,290 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/seveas/herd"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The parts of a kubeconfig file that herd needs to talk to the API servers
+// of its contexts
+type kubeconfig struct {
+	dir            string
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string
+		Cluster kubeCluster
+	}
+	Contexts []struct {
+		Name    string
+		Context struct {
+			Cluster string
+			User    string
+		}
+	}
+	Users []struct {
+		Name string
+		User kubeUser
+	}
+}
+
+type kubeCluster struct {
+	Server                   string
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+	TLSServerName            string `yaml:"tls-server-name"`
+}
+
+type kubeUser struct {
+	Token                 string
+	TokenFile             string `yaml:"tokenFile"`
+	ClientCertificate     string `yaml:"client-certificate"`
+	ClientCertificateData string `yaml:"client-certificate-data"`
+	ClientKey             string `yaml:"client-key"`
+	ClientKeyData         string `yaml:"client-key-data"`
+	Username              string
+	Password              string // #nosec G117 -- Credential field required for HTTP basic auth
+	Exec                  *kubeExec
+}
+
+// Credential plugins, as used by most managed kubernetes offerings
+type kubeExec struct {
+	APIVersion string `yaml:"apiVersion"`
+	Command    string
+	Args       []string
+	Env        []struct {
+		Name  string
+		Value string
+	}
+}
+
+func loadKubeconfig(path string) (*kubeconfig, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- The kubeconfig file comes from configuration
+	if err != nil {
+		return nil, err
+	}
+	var c kubeconfig
+	if err = yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %w", path, err)
+	}
+	c.dir = filepath.Dir(path)
+	return &c, nil
+}
+
+// defaultKubeconfig finds the kubeconfig file the same way kubectl does,
+// except that only the first file in $KUBECONFIG is used
+func defaultKubeconfig() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+// A kubeClient can talk to the API server of a single context
+type kubeClient struct {
+	context string
+	cluster string
+	server  *url.URL
+	client  *http.Client
+	user    kubeUser
+}
+
+func (c *kubeconfig) client(ctx context.Context, name string) (*kubeClient, error) {
+	var cluster *kubeCluster
+	var user *kubeUser
+	clusterName, userName, found := "", "", false
+	for _, kc := range c.Contexts {
+		if kc.Name == name {
+			clusterName, userName, found = kc.Context.Cluster, kc.Context.User, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("No such context: %s", name)
+	}
+	for i := range c.Clusters {
+		if c.Clusters[i].Name == clusterName {
+			cluster = &c.Clusters[i].Cluster
+		}
+	}
+	if cluster == nil {
+		return nil, fmt.Errorf("Context %s refers to unknown cluster %s", name, clusterName)
+	}
+	for i := range c.Users {
+		if c.Users[i].Name == userName {
+			user = &c.Users[i].User
+		}
+	}
+	if user == nil {
+		user = &kubeUser{}
+	}
+	server, err := url.Parse(cluster.Server)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid server for cluster %s: %w", clusterName, err)
+	}
+
+	kc := &kubeClient{context: name, cluster: clusterName, server: server, user: *user}
+	if kc.user.Exec != nil {
+		if err = kc.user.exec(ctx, c.dir); err != nil {
+			return nil, err
+		}
+	}
+	tlsConfig := &tls.Config{ServerName: cluster.TLSServerName, InsecureSkipVerify: cluster.InsecureSkipTLSVerify} // #nosec G402 -- Only when the kubeconfig asks for it
+	if ca, err := c.read(cluster.CertificateAuthorityData, cluster.CertificateAuthority); err != nil {
+		return nil, err
+	} else if ca != nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("Invalid certificate authority for cluster %s", clusterName)
+		}
+	}
+	cert, err := c.read(kc.user.ClientCertificateData, kc.user.ClientCertificate)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.read(kc.user.ClientKeyData, kc.user.ClientKey)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil && key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client certificate for user %s: %w", userName, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	if kc.user.TokenFile != "" {
+		token, err := c.read("", kc.user.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		kc.user.Token = strings.TrimSpace(string(token))
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	kc.client = &http.Client{Transport: transport}
+	return kc, nil
+}
+
+// read returns base64 encoded inline data, or the contents of a file relative
+// to the kubeconfig file
+func (c *kubeconfig) read(data, path string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.dir, path)
+	}
+	return os.ReadFile(path) // #nosec G304 -- Files referenced by the kubeconfig file
+}
+
+// exec runs a credential plugin and uses the token or client certificate it
+// returns
+func (u *kubeUser) exec(ctx context.Context, dir string) error {
+	info, _ := json.Marshal(map[string]any{
+		"apiVersion": u.Exec.APIVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]any{"interactive": false},
+	})
+	cmd := exec.CommandContext(ctx, u.Exec.Command, u.Exec.Args...) // #nosec G204 -- The command comes from the kubeconfig file
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "KUBERNETES_EXEC_INFO="+string(info))
+	for _, e := range u.Exec.Env {
+		cmd.Env = append(cmd.Env, e.Name+"="+e.Value)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("Credential plugin %s failed: %w: %s", u.Exec.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	var cred struct {
+		Status struct {
+			Token                 string
+			ClientCertificateData string
+			ClientKeyData         string
+		}
+	}
+	if err = json.Unmarshal(out, &cred); err != nil {
+		return fmt.Errorf("Unable to parse output of credential plugin %s: %w", u.Exec.Command, err)
+	}
+	u.Token = cred.Status.Token
+	// Certificates from credential plugins are PEM, not base64 encoded PEM
+	if cred.Status.ClientCertificateData != "" {
+		u.ClientCertificateData = base64.StdEncoding.EncodeToString([]byte(cred.Status.ClientCertificateData))
+		u.ClientKeyData = base64.StdEncoding.EncodeToString([]byte(cred.Status.ClientKeyData))
+	}
+	return nil
+}
+
+// list fetches all objects of a kind, following continuation tokens
+func list[T any](ctx context.Context, c *kubeClient, path string) ([]T, error) {
+	items := []T{}
+	cont := ""
+	for {
+		u := c.server.JoinPath(path)
+		q := url.Values{"limit": {"500"}}
+		if cont != "" {
+			q.Set("continue", cont)
+		}
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", fmt.Sprintf("herd/%s", herd.Version()))
+		if c.user.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.user.Token)
+		} else if c.user.Username != "" {
+			req.SetBasicAuth(c.user.Username, c.user.Password)
+		}
+		resp, err := c.client.Do(req) // #nosec G704 -- The server comes from the kubeconfig file
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("http response code %d: %s", resp.StatusCode, body)
+		}
+		var l struct {
+			Metadata struct {
+				Continue string
+			}
+			Items []T
+		}
+		if err = json.Unmarshal(body, &l); err != nil {
+			return nil, err
+		}
+		items = append(items, l.Items...)
+		if cont = l.Metadata.Continue; cont == "" {
+			return items, nil
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/cache"
+
+	"github.com/seveas/scattergather"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("kubernetes", newProvider, magicProvider)
+}
+
+type kubernetesProvider struct {
+	name   string
+	config struct {
+		Prefix     string
+		Kubeconfig string
+		Contexts   []string
+		Pods       bool
+		Namespaces []string
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	return &kubernetesProvider{name: name}
+}
+
+func magicProvider() herd.HostProvider {
+	path := defaultKubeconfig()
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	p := &kubernetesProvider{name: "kubernetes"}
+	p.config.Kubeconfig = path
+	return cache.NewFromProvider(p)
+}
+
+func (p *kubernetesProvider) Name() string {
+	return p.name
+}
+
+func (p *kubernetesProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *kubernetesProvider) Equivalent(o herd.HostProvider) bool {
+	op := o.(*kubernetesProvider)
+	return p.kubeconfig() == op.kubeconfig() &&
+		reflect.DeepEqual(p.config.Contexts, op.config.Contexts)
+}
+
+func (p *kubernetesProvider) ParseViper(v *viper.Viper) error {
+	return v.Unmarshal(&p.config)
+}
+
+func (p *kubernetesProvider) kubeconfig() string {
+	if p.config.Kubeconfig != "" {
+		return p.config.Kubeconfig
+	}
+	return defaultKubeconfig()
+}
+
+// Load returns the nodes, and optionally the pods, of all configured
+// contexts. Without configured contexts, the current context is used.
+func (p *kubernetesProvider) Load(ctx context.Context, lm herd.LoadingMessage) (*herd.HostSet, error) {
+	lm(p.name, false, nil)
+	kc, err := loadKubeconfig(p.kubeconfig())
+	if err != nil {
+		return nil, err
+	}
+	contexts := p.config.Contexts
+	if len(contexts) == 0 {
+		if kc.CurrentContext == "" {
+			return nil, fmt.Errorf("No current context set in %s", p.kubeconfig())
+		}
+		contexts = []string{kc.CurrentContext}
+	} else if len(contexts) == 1 && contexts[0] == "*" {
+		contexts = make([]string, len(kc.Contexts))
+		for i, c := range kc.Contexts {
+			contexts[i] = c.Name
+		}
+	}
+
+	sg := scattergather.New[*herd.HostSet](int64(len(contexts)))
+	for _, kctx := range contexts {
+		sg.Run(ctx, func() (*herd.HostSet, error) {
+			name := fmt.Sprintf("%s@%s", p.name, kctx)
+			lm(name, false, nil)
+			hosts, err := p.loadContext(ctx, kc, kctx)
+			lm(name, true, err)
+			return hosts, err
+		})
+	}
+	allHosts, err := sg.Wait()
+	return herd.MergeHostSets(allHosts), err
+}
+
+func (p *kubernetesProvider) loadContext(ctx context.Context, kc *kubeconfig, kctx string) (*herd.HostSet, error) {
+	c, err := kc.client(ctx, kctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := list[node](ctx, c, "/api/v1/nodes")
+	if err != nil {
+		return nil, err
+	}
+	hosts := herd.NewHostSet()
+	for _, n := range nodes {
+		hosts.AddHost(n.host(c))
+	}
+	if !p.config.Pods {
+		return hosts, nil
+	}
+	paths := []string{"/api/v1/pods"}
+	if len(p.config.Namespaces) != 0 {
+		paths = make([]string, len(p.config.Namespaces))
+		for i, ns := range p.config.Namespaces {
+			paths[i] = fmt.Sprintf("/api/v1/namespaces/%s/pods", ns)
+		}
+	}
+	for _, path := range paths {
+		pods, err := list[pod](ctx, c, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, pd := range pods {
+			hosts.AddHost(pd.host(c))
+		}
+	}
+	return hosts, nil
+}
+
+type objectMeta struct {
+	Name              string
+	Namespace         string
+	Labels            map[string]string
+	CreationTimestamp time.Time
+	OwnerReferences   []struct {
+		Kind string
+		Name string
+	}
+}
+
+type node struct {
+	Metadata objectMeta
+	Spec     struct {
+		Unschedulable bool
+		PodCIDR       string
+		ProviderID    string
+		Taints        []struct {
+			Key    string
+			Value  string
+			Effect string
+		}
+	}
+	Status struct {
+		Addresses []struct {
+			Type    string
+			Address string
+		}
+		Conditions []struct {
+			Type   string
+			Status string
+		}
+		NodeInfo struct {
+			KubeletVersion          string
+			OSImage                 string
+			KernelVersion           string
+			ContainerRuntimeVersion string
+			Architecture            string
+			OperatingSystem         string
+		}
+	}
+}
+
+func (n *node) host(c *kubeClient) *herd.Host {
+	addresses := make(map[string]string)
+	for _, a := range n.Status.Addresses {
+		if _, ok := addresses[a.Type]; !ok {
+			addresses[a.Type] = a.Address
+		}
+	}
+	conditions := make(map[string]string)
+	for _, cond := range n.Status.Conditions {
+		conditions[cond.Type] = cond.Status
+	}
+	taints := make([]string, len(n.Spec.Taints))
+	for i, t := range n.Spec.Taints {
+		taints[i] = t.Key
+		if t.Value != "" {
+			taints[i] += "=" + t.Value
+		}
+		taints[i] += ":" + t.Effect
+	}
+	address := addresses["InternalIP"]
+	if address == "" {
+		address = addresses["ExternalIP"]
+	}
+	info := n.Status.NodeInfo
+	return herd.NewHost(n.Metadata.Name, address, herd.HostAttributes{
+		"kind":              "node",
+		"context":           c.context,
+		"cluster":           c.cluster,
+		"labels":            n.Metadata.Labels,
+		"taints":            taints,
+		"conditions":        conditions,
+		"ready":             conditions["Ready"] == "True",
+		"addresses":         addresses,
+		"unschedulable":     n.Spec.Unschedulable,
+		"pod_cidr":          n.Spec.PodCIDR,
+		"provider_id":       n.Spec.ProviderID,
+		"kubelet_version":   info.KubeletVersion,
+		"os_image":          info.OSImage,
+		"kernel_version":    info.KernelVersion,
+		"container_runtime": info.ContainerRuntimeVersion,
+		"architecture":      info.Architecture,
+		"operating_system":  info.OperatingSystem,
+		"created":           n.Metadata.CreationTimestamp,
+	})
+}
+
+type pod struct {
+	Metadata objectMeta
+	Spec     struct {
+		NodeName   string
+		Containers []struct {
+			Name  string
+			Image string
+		}
+	}
+	Status struct {
+		Phase  string
+		PodIP  string
+		HostIP string
+	}
+}
+
+// Pods are named pod.namespace, as pods in different namespaces can have the
+// same name
+func (pd *pod) host(c *kubeClient) *herd.Host {
+	owner := ""
+	if len(pd.Metadata.OwnerReferences) > 0 {
+		owner = pd.Metadata.OwnerReferences[0].Kind + "/" + pd.Metadata.OwnerReferences[0].Name
+	}
+	containers := make([]string, len(pd.Spec.Containers))
+	images := make([]string, len(pd.Spec.Containers))
+	for i, container := range pd.Spec.Containers {
+		containers[i] = container.Name
+		images[i] = container.Image
+	}
+	return herd.NewHost(pd.Metadata.Name+"."+pd.Metadata.Namespace, pd.Status.PodIP, herd.HostAttributes{
+		"kind":       "pod",
+		"context":    c.context,
+		"cluster":    c.cluster,
+		"namespace":  pd.Metadata.Namespace,
+		"labels":     pd.Metadata.Labels,
+		"owner":      owner,
+		"node":       pd.Spec.NodeName,
+		"phase":      pd.Status.Phase,
+		"host_ip":    pd.Status.HostIP,
+		"containers": containers,
+		"images":     images,
+		"created":    pd.Metadata.CreationTimestamp,
+	})
+}
@@ -0,0 +1,156 @@
+package kubernetes
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/seveas/herd"
+)
+
+const nodesPage1 = `{"kind": "NodeList", "metadata": {"continue": "page2"}, "items": [
+  {"metadata": {"name": "node-1", "labels": {"kubernetes.io/arch": "amd64", "node-role.kubernetes.io/control-plane": ""}, "creationTimestamp": "2024-03-01T12:00:00Z"},
+   "spec": {"podCIDR": "10.244.0.0/24", "taints": [{"key": "node-role.kubernetes.io/control-plane", "effect": "NoSchedule"}]},
+   "status": {"addresses": [{"type": "InternalIP", "address": "192.0.2.1"}, {"type": "Hostname", "address": "node-1"}],
+              "conditions": [{"type": "MemoryPressure", "status": "False"}, {"type": "Ready", "status": "True"}],
+              "nodeInfo": {"kubeletVersion": "v1.30.2", "osImage": "Debian GNU/Linux 12 (bookworm)", "architecture": "amd64"}}}
+]}`
+
+const nodesPage2 = `{"kind": "NodeList", "metadata": {}, "items": [
+  {"metadata": {"name": "node-2", "labels": {"kubernetes.io/arch": "arm64"}},
+   "spec": {"unschedulable": true, "taints": [{"key": "dedicated", "value": "gpu", "effect": "NoExecute"}]},
+   "status": {"addresses": [{"type": "ExternalIP", "address": "198.51.100.2"}], "conditions": [{"type": "Ready", "status": "Unknown"}]}}
+]}`
+
+const pods = `{"kind": "PodList", "metadata": {}, "items": [
+  {"metadata": {"name": "web-7d4b9c-x2x8z", "namespace": "shop", "labels": {"app": "web"}, "ownerReferences": [{"kind": "ReplicaSet", "name": "web-7d4b9c"}]},
+   "spec": {"nodeName": "node-2", "containers": [{"name": "web", "image": "nginx:1.27"}, {"name": "metrics", "image": "exporter:2"}]},
+   "status": {"phase": "Running", "podIP": "10.244.1.7", "hostIP": "198.51.100.2"}}
+]}`
+
+func TestKubernetes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"kind": "Status", "message": "Unauthorized"}`)
+			return
+		}
+		switch r.URL.Path + "?" + r.URL.Query().Get("continue") {
+		case "/api/v1/nodes?":
+			fmt.Fprint(w, nodesPage1)
+		case "/api/v1/nodes?page2":
+			fmt.Fprint(w, nodesPage2)
+		case "/api/v1/namespaces/shop/pods?":
+			fmt.Fprint(w, pods)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test-cluster
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: test
+  context:
+    cluster: test-cluster
+    user: test-user
+- name: broken
+  context:
+    cluster: test-cluster
+    user: nobody
+users:
+- name: test-user
+  user:
+    tokenFile: token
+- name: nobody
+  user: {}
+`, server.URL, base64.StdEncoding.EncodeToString(ca))
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newProvider("kubernetes").(*kubernetesProvider)
+	p.config.Kubeconfig = path
+	p.config.Pods = true
+	p.config.Namespaces = []string{"shop"}
+	hosts, err := p.Load(t.Context(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to query fake kubernetes: %s", err)
+	}
+	if hosts.Len() != 3 {
+		t.Fatalf("Incorrect number of hosts returned (%d)", hosts.Len())
+	}
+
+	n1, n2, pod := hosts.Get(0), hosts.Get(1), hosts.Get(2)
+	if n1.Name != "node-1" || n1.Address != "192.0.2.1" || n2.Address != "198.51.100.2" {
+		t.Errorf("Unexpected nodes: %s, %s", n1, n2)
+	}
+	if v, _ := n1.GetAttribute(`labels["kubernetes.io/arch"]`); v != "amd64" {
+		t.Errorf("Labels not copied to host attributes: %v", n1.Attributes)
+	}
+	if v, _ := n1.GetAttribute("taints[0]"); v != "node-role.kubernetes.io/control-plane:NoSchedule" {
+		t.Errorf("Unexpected taints: %v", n1.Attributes["taints"])
+	}
+	if v, _ := n2.GetAttribute("taints[0]"); v != "dedicated=gpu:NoExecute" {
+		t.Errorf("Unexpected taints: %v", n2.Attributes["taints"])
+	}
+	if v, _ := n1.GetAttribute("conditions.MemoryPressure"); v != "False" || n1.Attributes["ready"] != true || n2.Attributes["ready"] != false {
+		t.Errorf("Unexpected conditions: %v %v", n1.Attributes["conditions"], n2.Attributes["conditions"])
+	}
+	if n1.Attributes["os_image"] != "Debian GNU/Linux 12 (bookworm)" || n1.Attributes["context"] != "test" || n1.Attributes["kind"] != "node" {
+		t.Errorf("Unexpected attributes: %v", n1.Attributes)
+	}
+	if pod.Name != "web-7d4b9c-x2x8z.shop" || pod.Address != "10.244.1.7" {
+		t.Errorf("Unexpected pod: %s", pod)
+	}
+	if pod.Attributes["owner"] != "ReplicaSet/web-7d4b9c" || pod.Attributes["node"] != "node-2" || pod.Attributes["namespace"] != "shop" {
+		t.Errorf("Unexpected pod attributes: %v", pod.Attributes)
+	}
+
+	// Contexts that fail to load are errors, but the other contexts are
+	// still loaded
+	p.config.Contexts = []string{"*"}
+	p.config.Pods = false
+	hosts, err = p.Load(t.Context(), func(string, bool, error) {})
+	if err == nil {
+		t.Errorf("Expected an error for the broken context")
+	}
+	if hosts == nil || hosts.Len() != 2 {
+		t.Errorf("Expected the nodes of the working context")
+	}
+}
+
+func TestMagicProvider(t *testing.T) {
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "config"))
+	if p := magicProvider(); p != nil {
+		t.Errorf("Magic provider should not be used without a kubeconfig file")
+	}
+	if err := os.WriteFile(os.Getenv("KUBECONFIG"), []byte("current-context: test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, ok := magicProvider().(herd.Cache)
+	if !ok {
+		t.Fatalf("Magic provider should be used, and cached, when a kubeconfig file exists")
+	}
+	if kp, ok := p.Source().(*kubernetesProvider); !ok || kp.config.Kubeconfig != os.Getenv("KUBECONFIG") {
+		t.Errorf("Unexpected source for the magic provider: %#v", p.Source())
+	}
+}
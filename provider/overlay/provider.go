@@ -0,0 +1,177 @@
+package overlay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/scripting"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	herd.RegisterProvider("overlay", newProvider, nil)
+}
+
+// The overlay provider doesn't find any hosts, but adds attributes to hosts
+// that other providers found, or removes them. Rules are read from a yaml or
+// json file and are applied in order to all hosts that match them.
+type overlayProvider struct {
+	name   string
+	config struct {
+		File string
+	}
+	rules []*rule
+	err   error
+}
+
+type rule struct {
+	Hosts   string
+	Filters []string
+	Set     map[string]any
+	Remove  []string
+	attrs   herd.MatchAttributes
+}
+
+func newProvider(name string) herd.HostProvider {
+	return &overlayProvider{name: name}
+}
+
+func (p *overlayProvider) Name() string {
+	return p.name
+}
+
+func (p *overlayProvider) Prefix() string {
+	return ""
+}
+
+func (p *overlayProvider) Equivalent(o herd.HostProvider) bool {
+	return p.config.File == o.(*overlayProvider).config.File
+}
+
+// SetDataDir also loads the rules. This can't wait until Load, as Load is not
+// called at all when the overlay is cached.
+func (p *overlayProvider) SetDataDir(dir string) error {
+	if !filepath.IsAbs(p.config.File) {
+		p.config.File = filepath.Join(dir, p.config.File)
+	}
+	p.rules, p.err = loadRules(p.config.File)
+	return p.err
+}
+
+func (p *overlayProvider) ParseViper(v *viper.Viper) error {
+	if err := v.Unmarshal(&p.config); err != nil {
+		return err
+	}
+	if p.config.File == "" {
+		return fmt.Errorf("No overlay file specified")
+	}
+	return nil
+}
+
+func (p *overlayProvider) Load(ctx context.Context, lm herd.LoadingMessage) (*herd.HostSet, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return herd.NewHostSet(), nil
+}
+
+func loadRules(file string) ([]*rule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseRules(data, strings.HasSuffix(file, ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %w", file, err)
+	}
+	return rules, nil
+}
+
+func parseRules(data []byte, isJson bool) ([]*rule, error) {
+	var rules []*rule
+	if isJson {
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&rules); err != nil {
+			return nil, err
+		}
+	} else if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for i, r := range rules {
+		if r == nil {
+			return nil, fmt.Errorf("rule %d is empty", i+1)
+		}
+		attrs, err := scripting.ParseFilters(r.Filters)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		r.attrs = attrs
+		if r.Hosts == "" {
+			r.Hosts = "*"
+		}
+		for k, v := range r.Set {
+			r.Set[k] = herd.NormalizeValue(v)
+		}
+	}
+	return rules, nil
+}
+
+// copyValue makes a deep copy of a value from a rule, so hosts don't share
+// maps and slices, and changing one host's attributes doesn't change others
+func copyValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = copyValue(e)
+		}
+		return l
+	}
+	return v
+}
+
+// Overlay applies all rules to all hosts. Rules see the changes earlier rules
+// made, and hosts that match any rule get this provider added to their
+// herd_provider attribute, just like when providers amend each other's hosts.
+func (p *overlayProvider) Overlay(hosts *herd.HostSet) {
+	for i := 0; i < hosts.Len(); i++ {
+		host := hosts.Get(i)
+		matched := false
+		for _, r := range p.rules {
+			if !host.Match(r.Hosts, r.attrs) {
+				continue
+			}
+			matched = true
+			for _, k := range r.Remove {
+				delete(host.Attributes, k)
+			}
+			for k, v := range r.Set {
+				host.Attributes[k] = copyValue(v)
+			}
+		}
+		if matched {
+			providers, _ := host.Attributes["herd_provider"].([]string)
+			host.Attributes["herd_provider"] = append(providers, p.name)
+		}
+	}
+}
+
+var (
+	_ herd.DataLoader  = &overlayProvider{}
+	_ herd.HostOverlay = &overlayProvider{}
+)
@@ -0,0 +1,114 @@
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/seveas/herd"
+)
+
+func TestOverlay(t *testing.T) {
+	yamlRules := `
+- filters: ["role=db"]
+  set:
+    owner: dba
+    backup:
+      schedule: daily
+      keep: 7
+- hosts: "*-02.example.com"
+  filters: ["(role=db or role=cache)"]
+  set:
+    maintenance: true
+  remove: [legacy]
+- hosts: "web-*"
+  filters: ["exists(owner)"]
+  set:
+    notes: never matches
+`
+	jsonRules := `[
+  {"Filters": ["role=db"], "Set": {"owner": "dba", "backup": {"schedule": "daily", "keep": 7}}},
+  {"Hosts": "*-02.example.com", "Filters": ["(role=db or role=cache)"], "Set": {"maintenance": true}, "Remove": ["legacy"]},
+  {"Hosts": "web-*", "Filters": ["exists(owner)"], "Set": {"notes": "never matches"}}
+]`
+	for _, test := range []struct {
+		name   string
+		data   string
+		isJson bool
+	}{{"yaml", yamlRules, false}, {"json", jsonRules, true}} {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := parseRules([]byte(test.data), test.isJson)
+			if err != nil {
+				t.Fatalf("Unable to parse rules: %s", err)
+			}
+			p := &overlayProvider{name: "overlay", rules: rules}
+			hosts := herd.NewHostSet()
+			for _, h := range []struct{ name, role string }{{"db-01", "db"}, {"db-02", "db"}, {"web-01", "web"}} {
+				hosts.AddHost(herd.NewHost(h.name+".example.com", "", herd.HostAttributes{"role": h.role, "legacy": true, "herd_provider": []string{"inventory"}}))
+			}
+			p.Overlay(hosts)
+
+			db1, db2, web1 := hosts.Get(0), hosts.Get(1), hosts.Get(2)
+			if v, _ := db1.GetAttribute("backup.keep"); db1.Attributes["owner"] != "dba" || v != int64(7) {
+				t.Errorf("db-01 did not get the db attributes: %v", db1.Attributes)
+			}
+			if _, ok := db1.Attributes["maintenance"]; ok || db1.Attributes["legacy"] != true {
+				t.Errorf("db-01 should not be in maintenance: %v", db1.Attributes)
+			}
+			if _, ok := db2.Attributes["legacy"]; ok || db2.Attributes["maintenance"] != true || db2.Attributes["owner"] != "dba" {
+				t.Errorf("db-02 should be in maintenance: %v", db2.Attributes)
+			}
+			if _, ok := web1.Attributes["notes"]; ok {
+				t.Errorf("web-01 should not have been changed: %v", web1.Attributes)
+			}
+			db1.Attributes["backup"].(map[string]any)["keep"] = int64(1)
+			if v, _ := db2.GetAttribute("backup.keep"); v != int64(7) {
+				t.Errorf("Hosts should not share attribute values, db-02 has backup.keep=%v", v)
+			}
+			if p := db2.Attributes["herd_provider"].([]string); len(p) != 2 || p[1] != "overlay" {
+				t.Errorf("overlay should be added to herd_provider for changed hosts: %v", p)
+			}
+			if p := web1.Attributes["herd_provider"].([]string); len(p) != 1 {
+				t.Errorf("overlay should not be added to herd_provider for unchanged hosts: %v", p)
+			}
+		})
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	if _, err := parseRules([]byte(`[{"Filters": ["role"]}]`), true); err == nil || err.Error() != "rule 1: incorrect filter: role" {
+		t.Errorf("Unexpected error for an invalid filter: %v", err)
+	}
+	if _, err := parseRules([]byte("- set: [1, 2]"), false); err == nil {
+		t.Errorf("Expected an error for an invalid rule")
+	}
+}
+
+func TestSetDataDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "overlay.yaml"), []byte("- set: {owner: ops}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Rules are loaded before Load is called, so they also apply when the
+	// overlay is cached and Load is not called at all
+	p := newProvider("overlay").(*overlayProvider)
+	p.config.File = "overlay.yaml"
+	if err := p.SetDataDir(dir); err != nil {
+		t.Fatalf("Unable to load rules: %s", err)
+	}
+	hosts := herd.NewHostSet()
+	hosts.AddHost(herd.NewHost("web-01.example.com", "", herd.HostAttributes{}))
+	p.Overlay(hosts)
+	if hosts.Get(0).Attributes["owner"] != "ops" {
+		t.Errorf("Rules were not applied: %v", hosts.Get(0).Attributes)
+	}
+
+	p = newProvider("overlay").(*overlayProvider)
+	p.config.File = "missing.yaml"
+	if err := p.SetDataDir(dir); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+	if _, err := p.Load(t.Context(), func(string, bool, error) {}); err == nil {
+		t.Errorf("Expected Load to return the error")
+	}
+}
@@ -0,0 +1,184 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/seveas/herd"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/spf13/viper"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	herd.RegisterProvider("sql", newProvider, nil)
+}
+
+// The sql provider runs a query against a database and turns every row into
+// a host. One column is used as the name, one as the address, and all other
+// columns become attributes.
+type sqlProvider struct {
+	name   string
+	config struct {
+		Prefix        string
+		Driver        string
+		DSN           string
+		Query         string
+		NameColumn    string
+		AddressColumn string
+	}
+}
+
+// Alternative names for the drivers we include, as people tend to refer to
+// the database and not the driver
+var driverAliases = map[string]string{
+	"postgres":   "pgx",
+	"postgresql": "pgx",
+	"sqlite3":    "sqlite",
+}
+
+func newProvider(name string) herd.HostProvider {
+	p := &sqlProvider{name: name}
+	p.config.NameColumn = "name"
+	p.config.AddressColumn = "address"
+	return p
+}
+
+func (p *sqlProvider) Name() string {
+	return p.name
+}
+
+func (p *sqlProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *sqlProvider) Equivalent(o herd.HostProvider) bool {
+	op := o.(*sqlProvider)
+	return p.config.Driver == op.config.Driver &&
+		p.config.DSN == op.config.DSN &&
+		p.config.Query == op.config.Query
+}
+
+func (p *sqlProvider) ParseViper(v *viper.Viper) error {
+	if err := v.Unmarshal(&p.config); err != nil {
+		return err
+	}
+	if d, ok := driverAliases[p.config.Driver]; ok {
+		p.config.Driver = d
+	}
+	if !slices.Contains(sql.Drivers(), p.config.Driver) {
+		return fmt.Errorf("Unknown database driver '%s', supported drivers: %s", p.config.Driver, strings.Join(sql.Drivers(), ", "))
+	}
+	if p.config.DSN == "" {
+		return fmt.Errorf("No DSN specified")
+	}
+	if p.config.Query == "" {
+		return fmt.Errorf("No query specified")
+	}
+	return nil
+}
+
+func (p *sqlProvider) Load(ctx context.Context, lm herd.LoadingMessage) (*herd.HostSet, error) {
+	lm(p.name, false, nil)
+	db, err := sql.Open(p.config.Driver, p.config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, p.config.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	nameIdx, addressIdx := -1, -1
+	for i, c := range columns {
+		switch c.Name() {
+		case p.config.NameColumn:
+			nameIdx = i
+		case p.config.AddressColumn:
+			addressIdx = i
+		}
+	}
+	if nameIdx == -1 {
+		return nil, fmt.Errorf("Query result has no %s column", p.config.NameColumn)
+	}
+
+	hosts := herd.NewHostSet()
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		attrs := make(herd.HostAttributes)
+		name, address := "", ""
+		for i, c := range columns {
+			value := convert(values[i], c.DatabaseTypeName())
+			switch i {
+			case nameIdx:
+				name = fmt.Sprintf("%v", value)
+			case addressIdx:
+				if value != nil {
+					address = fmt.Sprintf("%v", value)
+				}
+			default:
+				attrs[c.Name()] = value
+			}
+		}
+		if values[nameIdx] == nil || name == "" {
+			continue
+		}
+		hosts.AddHost(herd.NewHost(name, address, attrs))
+	}
+	return hosts, rows.Err()
+}
+
+// convert turns database values into attribute values. Drivers that use a
+// text protocol, like mysql, return numbers as bytes, so we use the column
+// type to turn those back into numbers. Sqlite has no real booleans and
+// returns them as numbers.
+func convert(value any, dbType string) any {
+	dbType = strings.ToUpper(dbType)
+	var s string
+	switch v := value.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		if dbType == "BOOL" || dbType == "BOOLEAN" {
+			return v != 0
+		}
+		return value
+	default:
+		return value
+	}
+	switch {
+	case strings.Contains(dbType, "INT") || strings.Contains(dbType, "SERIAL"):
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case dbType == "DECIMAL" || dbType == "NUMERIC" || dbType == "FLOAT" || dbType == "DOUBLE" || dbType == "REAL":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case dbType == "BOOL" || dbType == "BOOLEAN":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package sql
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seveas/herd"
+
+	"github.com/spf13/viper"
+)
+
+func TestSqlite(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "cmdb.sqlite")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE hosts (fqdn TEXT, ip TEXT, role TEXT, cpus INTEGER, load REAL, decommissioned BOOLEAN, rack TEXT);
+		INSERT INTO hosts VALUES
+			('db-01.example.com', '10.0.0.1', 'db', 16, 0.5, 0, 'r1'),
+			('web-01.example.com', NULL, 'web', 4, 1.25, 0, NULL),
+			('old-01.example.com', '10.0.0.3', 'web', 2, 0, 1, 'r2'),
+			(NULL, '10.0.0.4', 'broken', 1, 0, 0, NULL);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := viper.New()
+	v.Set("Driver", "sqlite")
+	v.Set("DSN", dsn)
+	v.Set("Query", "SELECT fqdn, ip, role, cpus, load, decommissioned, rack, cpus * 2 AS threads FROM hosts ORDER BY fqdn")
+	v.Set("NameColumn", "fqdn")
+	v.Set("AddressColumn", "ip")
+	p := newProvider("cmdb").(*sqlProvider)
+	if err = p.ParseViper(v); err != nil {
+		t.Fatalf("Unable to parse configuration: %s", err)
+	}
+	hosts, err := p.Load(t.Context(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Unable to load hosts: %s", err)
+	}
+	if hosts.Len() != 3 {
+		t.Fatalf("Expected 3 hosts, got %d", hosts.Len())
+	}
+
+	db1, old1, web1 := hosts.Get(0), hosts.Get(1), hosts.Get(2)
+	if db1.Name != "db-01.example.com" || db1.Address != "10.0.0.1" || web1.Address != "" {
+		t.Errorf("Unexpected names or addresses: %s %s", db1, web1)
+	}
+	expected := herd.HostAttributes{"role": "db", "cpus": int64(16), "load": 0.5, "decommissioned": false, "rack": "r1", "threads": int64(32)}
+	for k, v := range expected {
+		if db1.Attributes[k] != v {
+			t.Errorf("Expected %s to be %#v, got %#v", k, v, db1.Attributes[k])
+		}
+	}
+	if _, ok := db1.Attributes["fqdn"]; ok {
+		t.Errorf("Name column should not be an attribute")
+	}
+	if v, ok := web1.Attributes["rack"]; !ok || v != nil {
+		t.Errorf("NULL values should be nil attributes, got %#v", v)
+	}
+	if old1.Attributes["decommissioned"] != true {
+		t.Errorf("Booleans should be booleans, got %#v", old1.Attributes["decommissioned"])
+	}
+	m := herd.MatchAttribute{Name: "cpus", Value: int64(8), Operator: herd.MatchGreater}
+	if !m.MatchHost(db1) || m.MatchHost(web1) {
+		t.Errorf("Numeric matching of integer columns failed")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	tests := []struct {
+		config map[string]string
+		err    string
+	}{
+		{map[string]string{"Driver": "oracle", "DSN": "x", "Query": "x"}, "Unknown database driver 'oracle'"},
+		{map[string]string{"Driver": "postgres", "Query": "x"}, "No DSN specified"},
+		{map[string]string{"Driver": "sqlite3", "Query": "x"}, "No DSN specified"},
+		{map[string]string{"Driver": "mysql", "DSN": "x"}, "No query specified"},
+	}
+	for _, test := range tests {
+		v := viper.New()
+		for k, val := range test.config {
+			v.Set(k, val)
+		}
+		err := newProvider("sql").ParseViper(v)
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("Expected error %q, got %v", test.err, err)
+		}
+	}
+}
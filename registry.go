@@ -48,6 +48,7 @@ type Registry struct {
 	dataDir      string
 	cacheDir     string
 	magicLoaded  bool
+	derived      []*derivedAttribute
 }
 
 type HostProvider interface {
@@ -62,6 +63,13 @@ type HostKeyProvider interface {
 	LoadHostKeys(ctx context.Context, l LoadingMessage) (map[string][]ssh.PublicKey, error)
 }
 
+// A HostOverlay is a provider that doesn't find hosts itself, but changes the
+// hosts other providers found. Overlays are applied after all hosts have been
+// loaded and merged, in order of their names.
+type HostOverlay interface {
+	Overlay(hosts *HostSet)
+}
+
 type DataLoader interface {
 	SetDataDir(string) error
 }
@@ -161,6 +169,18 @@ func (r *Registry) LoadProviders(c *viper.Viper) error {
 	return nil
 }
 
+// AddDerivedAttribute adds an attribute that is computed for all hosts after
+// they have been loaded. Derived attributes are computed in the order they
+// are added, so they can use attributes derived before them.
+func (r *Registry) AddDerivedAttribute(name, value string) error {
+	d, err := newDerivedAttribute(name, value)
+	if err != nil {
+		return err
+	}
+	r.derived = append(r.derived, d)
+	return nil
+}
+
 func (r *Registry) AddProvider(p HostProvider) {
 	logrus.Debugf("Adding provider %s", p.Name())
 	if c, ok := p.(Cache); ok {
@@ -260,6 +280,23 @@ func (r *Registry) LoadHosts(ctx context.Context, lm LoadingMessage) error {
 
 	hostSets, err := sg.Wait()
 	r.hosts = MergeHostSets(hostSets)
+	// Providers are configured in a map, so overlays are sorted by name to
+	// apply them in a predictable order
+	overlays := []HostProvider{}
+	for _, p := range r.providers {
+		if _, ok := stripCache(p).(HostOverlay); ok {
+			overlays = append(overlays, p)
+		}
+	}
+	sort.Slice(overlays, func(i, j int) bool { return overlays[i].Name() < overlays[j].Name() })
+	for _, p := range overlays {
+		stripCache(p).(HostOverlay).Overlay(r.hosts)
+	}
+	for _, host := range r.hosts.hosts {
+		for _, d := range r.derived {
+			d.apply(host)
+		}
+	}
 	lm("", true, err)
 	return err
 }
@@ -3,11 +3,19 @@ package herd
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"os/signal"
+	"path"
+	"path/filepath"
 	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/seveas/scattergather"
@@ -19,6 +27,20 @@ type Executor interface {
 	SetConnectTimeout(time.Duration)
 }
 
+// StdinRunner is implemented by executors that can send data to the stdin of
+// commands
+type StdinRunner interface {
+	RunWithStdin(ctx context.Context, host *Host, cmd string, stdin io.Reader, oc chan OutputLine) *Result
+}
+
+// FileTransferer is implemented by executors that can copy files to and from
+// hosts. Push copies the local file src to dst on the host, Pull copies src
+// on the host to the local file dst.
+type FileTransferer interface {
+	Push(ctx context.Context, host *Host, src, dst string) *Result
+	Pull(ctx context.Context, host *Host, src, dst string) *Result
+}
+
 type OutputLine struct {
 	Host   *Host
 	Stderr bool
@@ -32,16 +54,24 @@ type ProgressMessage struct {
 }
 
 type Runner struct {
-	hosts            *HostSet
-	parallel         int
-	splay            time.Duration
-	timeout          time.Duration
-	hostTimeout      time.Duration
-	executor         Executor
-	current          *scattergather.ScatterGather[*Result]
-	cancel           context.CancelFunc
-	signalHandlers   map[os.Signal]func()
-	expectExitStatus []int
+	hosts                 *HostSet
+	parallel              int
+	batchSize             int
+	batchPercentage       bool
+	maxFailures           int
+	maxFailuresPercentage bool
+	splay                 time.Duration
+	timeout               time.Duration
+	hostTimeout           time.Duration
+	executor              Executor
+	current               *scattergather.ScatterGather[*Result]
+	cancel                context.CancelFunc
+	signalHandlers        map[os.Signal]func()
+	expectExitStatus      []int
+	stdin                 *Stdin
+	retries               map[ErrorClass]int
+	retryBackoff          time.Duration
+	templateCommand       bool
 }
 
 type ProgressState int
@@ -51,6 +81,8 @@ const (
 	Waiting
 	Running
 	Finished
+	Skipped
+	Retrying
 )
 
 func NewRunner(hosts *HostSet, executor Executor) *Runner {
@@ -59,6 +91,9 @@ func NewRunner(hosts *HostSet, executor Executor) *Runner {
 		executor:         executor,
 		signalHandlers:   make(map[os.Signal]func()),
 		expectExitStatus: []int{0},
+		maxFailures:      -1,
+		retries:          make(map[ErrorClass]int),
+		retryBackoff:     time.Second,
 	}
 }
 
@@ -69,6 +104,45 @@ func (r *Runner) SetParallel(p int) {
 	}
 }
 
+// SetBatchSize makes the runner run commands on hosts in consecutive batches
+// of at most size hosts. If percentage is true, size is a percentage of the
+// number of hosts. A size of 0 disables batching.
+func (r *Runner) SetBatchSize(size int, percentage bool) {
+	r.batchSize = size
+	r.batchPercentage = percentage
+}
+
+// SetMaxFailures makes the runner stop starting commands as soon as more than
+// count hosts in the current batch have failed. If percentage is true, count
+// is a percentage of the batch size. A negative count disables this check.
+func (r *Runner) SetMaxFailures(count int, percentage bool) {
+	r.maxFailures = count
+	r.maxFailuresPercentage = percentage
+}
+
+// SetStdin makes the runner send the data in stdin to all commands it runs
+func (r *Runner) SetStdin(stdin *Stdin) {
+	r.stdin = stdin
+}
+
+// SetRetries makes the runner retry commands that fail with an error of the
+// given class up to this many times
+func (r *Runner) SetRetries(class ErrorClass, retries int) {
+	r.retries[class] = retries
+}
+
+// SetRetryBackoff sets how long to wait before the first retry. The wait
+// doubles for every next retry.
+func (r *Runner) SetRetryBackoff(t time.Duration) {
+	r.retryBackoff = t
+}
+
+// SetTemplateCommand enables expanding commands as templates for every host,
+// with the same functions as are available for host list templates
+func (r *Runner) SetTemplateCommand(t bool) {
+	r.templateCommand = t
+}
+
 func (r *Runner) SetSplay(t time.Duration) {
 	r.splay = t
 }
@@ -81,11 +155,10 @@ func (r *Runner) GetTimeout() time.Duration {
 	if r.timeout != 0 {
 		return r.timeout
 	}
-	if r.parallel == 0 || r.hostTimeout == 0 {
+	if r.parallel == 0 && r.batchSize == 0 || r.hostTimeout == 0 {
 		return r.hostTimeout
 	}
-	batches := len(r.hosts.hosts)/r.parallel + 1
-	return r.hostTimeout * time.Duration(batches)
+	return r.hostTimeout * time.Duration(r.rounds())
 }
 
 func (r *Runner) SetHostTimeout(t time.Duration) {
@@ -96,11 +169,35 @@ func (r *Runner) GetHostTimeout() time.Duration {
 	if r.hostTimeout != 0 {
 		return r.hostTimeout
 	}
-	if r.parallel == 0 || r.timeout == 0 {
+	if r.parallel == 0 && r.batchSize == 0 || r.timeout == 0 {
 		return r.timeout
 	}
-	batches := len(r.hosts.hosts)/r.parallel + 1
-	return r.timeout / time.Duration(batches)
+	return r.timeout / time.Duration(r.rounds())
+}
+
+// The number of hosts in each batch, which is all hosts when not batching
+func (r *Runner) getBatchSize() int {
+	n := len(r.hosts.hosts)
+	size := r.batchSize
+	if r.batchPercentage {
+		size = (n*size + 99) / 100
+	}
+	if size <= 0 || size > n {
+		return n
+	}
+	return size
+}
+
+// How many hosts, at most, will run one after another
+func (r *Runner) rounds() int {
+	p := r.getBatchSize()
+	if r.parallel > 0 && r.parallel < p {
+		p = r.parallel
+	}
+	if p == 0 {
+		return 1
+	}
+	return len(r.hosts.hosts)/p + 1
 }
 
 func (r *Runner) SetConnectTimeout(t time.Duration) {
@@ -120,10 +217,114 @@ func (r *Runner) Settings() (string, map[string]any) {
 		"Timeout":          r.timeout,
 		"HostTimeout":      r.hostTimeout,
 		"ExpectExitStatus": r.expectExitStatus,
+		"BatchSize":        formatCountOrPercentage(r.batchSize, r.batchPercentage),
+		"MaxFailures":      formatCountOrPercentage(r.maxFailures, r.maxFailuresPercentage),
+		"RetryConnect":     r.retries[ConnectError],
+		"RetryAuth":        r.retries[AuthError],
+		"RetryTimeout":     r.retries[SessionTimeout],
+		"RetryBackoff":     r.retryBackoff,
+		"TemplateCommand":  r.templateCommand,
+	}
+}
+
+// ParseCountOrPercentage parses arguments like "10" and "10%", as accepted by
+// SetBatchSize and SetMaxFailures
+func ParseCountOrPercentage(s string) (int, bool, error) {
+	percentage := strings.HasSuffix(s, "%")
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil {
+		return 0, false, fmt.Errorf("Invalid count or percentage: %s", s)
+	}
+	if percentage && (n < 0 || n > 100) {
+		return 0, false, fmt.Errorf("Percentage out of range: %s", s)
+	}
+	return n, percentage, nil
+}
+
+func formatCountOrPercentage(n int, percentage bool) string {
+	if percentage {
+		return fmt.Sprintf("%d%%", n)
 	}
+	return strconv.Itoa(n)
 }
 
 func (r *Runner) Run(command string, pc chan ProgressMessage, oc chan OutputLine) (*HistoryItem, error) {
+	expand, err := r.commandExpander(command)
+	if err != nil {
+		return nil, err
+	}
+	if r.stdin != nil {
+		runner, ok := r.executor.(StdinRunner)
+		if r.executor != nil && !ok {
+			return nil, errors.New("Executor does not support sending data to stdin")
+		}
+		return r.run(command, pc, func(ctx context.Context, host *Host) *Result {
+			command, err := expand(host)
+			if err != nil {
+				return templateErrorResult(host, err)
+			}
+			return runner.RunWithStdin(ctx, host, command, r.stdin.Reader(), oc)
+		})
+	}
+	return r.run(command, pc, func(ctx context.Context, host *Host) *Result {
+		command, err := expand(host)
+		if err != nil {
+			return templateErrorResult(host, err)
+		}
+		return r.executor.Run(ctx, host, command, oc)
+	})
+}
+
+// commandExpander returns a function that turns the command into the command
+// for a specific host. Unless commands are templates, that's the command
+// itself.
+func (r *Runner) commandExpander(command string) (func(*Host) (string, error), error) {
+	if !r.templateCommand {
+		return func(*Host) (string, error) { return command, nil }, nil
+	}
+	// Running a command with "<no value>" in it is never what anyone wants,
+	// so missing attributes are an error
+	tmpl, err := template.New("command").Funcs(templateFuncs).Option("missingkey=error").Parse(command)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid command template: %w", err)
+	}
+	return func(host *Host) (string, error) {
+		var sb strings.Builder
+		err := tmpl.Execute(&sb, host)
+		return sb.String(), err
+	}, nil
+}
+
+func templateErrorResult(host *Host, err error) *Result {
+	now := time.Now()
+	return &Result{Host: host.Name, StartTime: now, EndTime: now, ExitStatus: -1, Err: fmt.Errorf("Unable to expand command template: %w", err)}
+}
+
+// Push copies the local file src to dst on all hosts. If dst is an existing
+// directory, the file is copied into it.
+func (r *Runner) Push(src, dst string, pc chan ProgressMessage) (*HistoryItem, error) {
+	transferer, ok := r.executor.(FileTransferer)
+	if r.executor != nil && !ok {
+		return nil, errors.New("Executor does not support file transfers")
+	}
+	return r.run(fmt.Sprintf("push %s %s", src, dst), pc, func(ctx context.Context, host *Host) *Result {
+		return transferer.Push(ctx, host, src, dst)
+	})
+}
+
+// Pull copies src from all hosts to the local directory dst, using a
+// subdirectory per host.
+func (r *Runner) Pull(src, dst string, pc chan ProgressMessage) (*HistoryItem, error) {
+	transferer, ok := r.executor.(FileTransferer)
+	if r.executor != nil && !ok {
+		return nil, errors.New("Executor does not support file transfers")
+	}
+	return r.run(fmt.Sprintf("pull %s %s", src, dst), pc, func(ctx context.Context, host *Host) *Result {
+		return transferer.Pull(ctx, host, src, filepath.Join(dst, host.Name, path.Base(src)))
+	})
+}
+
+func (r *Runner) run(command string, pc chan ProgressMessage, execute func(context.Context, *Host) *Result) (*HistoryItem, error) {
 	if r.executor == nil {
 		return nil, errors.New("No executor defined")
 	}
@@ -143,28 +344,6 @@ func (r *Runner) Run(command string, pc chan ProgressMessage, oc chan OutputLine
 	ctx, cancel := context.WithCancel(context.Background())
 	r.cancel = cancel
 	defer cancel()
-	count := r.parallel
-	if count <= 0 {
-		count = len(r.hosts.hosts)
-	}
-	r.current = scattergather.New[*Result](int64(count))
-	for index, host := range r.hosts.hosts {
-		r.current.Run(ctx, func() (*Result, error) {
-			if r.splay > 0 {
-				pc <- ProgressMessage{Host: host, State: Waiting}
-				r.splayDelay(ctx)
-			}
-			pc <- ProgressMessage{Host: host, State: Running}
-			ctx, cancel := context.WithTimeout(ctx, r.GetHostTimeout())
-			defer cancel()
-			result := r.executor.Run(ctx, host, command, oc)
-			result.ExitSuccess = slices.Contains(r.expectExitStatus, result.ExitStatus)
-			result.index = index
-			host.LastResult = result
-			pc <- ProgressMessage{Host: host, State: Finished, Result: result}
-			return result, nil
-		})
-	}
 	go func() {
 		timeout := time.After(r.GetTimeout())
 		signals := make(chan os.Signal, 5)
@@ -189,23 +368,73 @@ func (r *Runner) Run(command string, pc chan ProgressMessage, oc chan OutputLine
 		}
 	}()
 
-	results, _ := r.current.Wait()
+	var aborted atomic.Bool
+	batchSize := r.getBatchSize()
+	for start := 0; start < len(r.hosts.hosts) && ctx.Err() == nil; start += batchSize {
+		batch := r.hosts.hosts[start:min(start+batchSize, len(r.hosts.hosts))]
+		if batchSize != len(r.hosts.hosts) {
+			logrus.Infof("Starting batch %d of %d (%d hosts)", start/batchSize+1, (len(r.hosts.hosts)+batchSize-1)/batchSize, len(batch))
+		}
+		maxFailures := r.maxFailures
+		if r.maxFailuresPercentage {
+			maxFailures = len(batch) * r.maxFailures / 100
+		}
+		var failures atomic.Int64
+		count := r.parallel
+		if count <= 0 {
+			count = len(batch)
+		}
+		r.current = scattergather.New[*Result](int64(count))
+		for i, host := range batch {
+			index := start + i
+			r.current.Run(ctx, func() (*Result, error) {
+				if aborted.Load() {
+					return r.skip(host, index, pc), nil
+				}
+				if r.splay > 0 {
+					pc <- ProgressMessage{Host: host, State: Waiting}
+					r.splayDelay(ctx)
+				}
+				pc <- ProgressMessage{Host: host, State: Running}
+				result := r.runWithRetries(ctx, host, execute, pc)
+				result.ExitSuccess = slices.Contains(r.expectExitStatus, result.ExitStatus)
+				result.index = index
+				host.LastResult = result
+				pc <- ProgressMessage{Host: host, State: Finished, Result: result}
+				if !result.ExitSuccess && maxFailures >= 0 && failures.Add(1) == int64(maxFailures)+1 {
+					logrus.Errorf("More than %s of hosts in this batch failed, not starting any more commands", formatCountOrPercentage(r.maxFailures, r.maxFailuresPercentage))
+					aborted.Store(true)
+				}
+				return result, nil
+			})
+		}
+
+		results, _ := r.current.Wait()
+		for _, result := range results {
+			hi.Results[result.index] = result
+			switch {
+			case result.skipped():
+				hi.Summary.Skipped++
+			case result.ExitStatus == -1:
+				hi.Summary.Err++
+			case result.ExitSuccess:
+				hi.Summary.Ok++
+			default:
+				hi.Summary.Fail++
+			}
+		}
+		if aborted.Load() {
+			break
+		}
+	}
 	r.current = nil
 	r.cancel = nil
 	cancel()
-	for _, result := range results {
-		hi.Results[result.index] = result
-		switch {
-		case result.ExitStatus == -1:
-			hi.Summary.Err++
-		case result.ExitSuccess:
-			hi.Summary.Ok++
-		default:
-			hi.Summary.Fail++
-		}
-	}
 	for index, host := range r.hosts.hosts {
-		if hi.Results[index] == nil {
+		if hi.Results[index] == nil && aborted.Load() {
+			hi.Results[index] = r.skip(host, index, pc)
+			hi.Summary.Skipped++
+		} else if hi.Results[index] == nil {
 			result := &Result{Host: host.Name, ExitStatus: -1, Err: errors.New("context canceled")}
 			host.LastResult = result
 			pc <- ProgressMessage{Host: host, State: Finished, Result: result}
@@ -228,6 +457,30 @@ func (r *Runner) Run(command string, pc chan ProgressMessage, oc chan OutputLine
 	return hi, nil
 }
 
+// Run a command on a host, retrying it if it fails with an error we should
+// retry on
+func (r *Runner) runWithRetries(ctx context.Context, host *Host, execute func(context.Context, *Host) *Result, pc chan ProgressMessage) *Result {
+	backoff := r.retryBackoff
+	for attempt := 1; ; attempt++ {
+		hctx, cancel := context.WithTimeout(ctx, r.GetHostTimeout())
+		result := execute(hctx, host)
+		cancel()
+		result.Attempts = attempt
+		if result.Err == nil || attempt > r.retries[ErrorClassOf(result.Err)] || ctx.Err() != nil {
+			return result
+		}
+		logrus.Debugf("Attempt %d on %s failed: %s, retrying in %s", attempt, host.Name, result.Err, backoff)
+		pc <- ProgressMessage{Host: host, State: Retrying, Result: result}
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		pc <- ProgressMessage{Host: host, State: Running}
+	}
+}
+
 func (r *Runner) OnSignal(s os.Signal, f func()) {
 	r.signalHandlers[s] = f
 }
@@ -263,6 +516,22 @@ func (r *Runner) splayDelay(ctx context.Context) {
 	}
 }
 
+func (r *Runner) skip(host *Host, index int, pc chan ProgressMessage) *Result {
+	now := time.Now()
+	result := &Result{Host: host.Name, ExitStatus: -1, Err: SkippedError{}, StartTime: now, EndTime: now, index: index}
+	host.LastResult = result
+	pc <- ProgressMessage{Host: host, State: Skipped, Result: result}
+	return result
+}
+
+// SkippedError is the error set on results for hosts that were never
+// started, because too many hosts failed before them.
+type SkippedError struct{}
+
+func (e SkippedError) Error() string {
+	return "skipped because too many hosts failed"
+}
+
 type TimeoutError struct {
 	Message string
 }
@@ -0,0 +1,319 @@
+package herd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeExecutor struct{}
+
+func (e *fakeExecutor) Run(ctx context.Context, host *Host, cmd string, oc chan OutputLine) *Result {
+	r := &Result{Host: host.Name}
+	if strings.HasPrefix(host.Name, "fail") {
+		r.ExitStatus = 1
+		r.Err = errors.New("exited with status 1")
+	}
+	return r
+}
+
+func (e *fakeExecutor) SetConnectTimeout(time.Duration) {}
+
+func (e *fakeExecutor) RunWithStdin(ctx context.Context, host *Host, cmd string, stdin io.Reader, oc chan OutputLine) *Result {
+	r := e.Run(ctx, host, cmd, oc)
+	r.Stdout, _ = io.ReadAll(stdin)
+	return r
+}
+
+func (e *fakeExecutor) Push(ctx context.Context, host *Host, src, dst string) *Result {
+	return &Result{Host: host.Name, Transfers: []Transfer{{Source: src, Destination: dst}}}
+}
+
+func (e *fakeExecutor) Pull(ctx context.Context, host *Host, src, dst string) *Result {
+	return &Result{Host: host.Name, Transfers: []Transfer{{Source: src, Destination: dst}}}
+}
+
+// flakyExecutor fails to connect to hosts named flaky-N the first N times,
+// and can never authenticate to hosts named auth-*
+type flakyExecutor struct {
+	fakeExecutor
+	lock     sync.Mutex
+	attempts map[string]int
+}
+
+func (e *flakyExecutor) Run(ctx context.Context, host *Host, cmd string, oc chan OutputLine) *Result {
+	e.lock.Lock()
+	e.attempts[host.Name]++
+	attempt := e.attempts[host.Name]
+	e.lock.Unlock()
+	r := &Result{Host: host.Name, ExitStatus: -1}
+	if strings.HasPrefix(host.Name, "auth-") {
+		r.Err = ClassifiedError{Class: AuthError, Err: errors.New("unable to authenticate")}
+	} else if n, _ := strconv.Atoi(strings.TrimPrefix(host.Name, "flaky-")); attempt <= n {
+		r.Err = ClassifiedError{Class: ConnectError, Err: errors.New("connection refused")}
+	} else {
+		r.ExitStatus = 0
+	}
+	return r
+}
+
+func TestRunnerBatches(t *testing.T) {
+	hosts := NewHostSet()
+	for _, name := range []string{"fail-1", "fail-2", "ok-1", "ok-2", "ok-3", "ok-4"} {
+		hosts.AddHost(NewHost(name, "", HostAttributes{}))
+	}
+	runner := NewRunner(hosts, &fakeExecutor{})
+	runner.SetTimeout(time.Minute)
+	runner.SetHostTimeout(time.Minute)
+	runner.SetBatchSize(2, false)
+	runner.SetMaxFailures(1, false)
+	hi, err := runner.Run("true", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if hi.Summary.Fail != 2 || hi.Summary.Ok != 0 || hi.Summary.Skipped != 4 {
+		t.Errorf("Expected 2 failed and 4 skipped hosts, got %+v", hi.Summary)
+	}
+	for _, r := range hi.Results[2:] {
+		if !r.skipped() {
+			t.Errorf("Expected %s to be skipped, got %v", r.Host, r.Err)
+		}
+	}
+
+	runner.SetBatchSize(50, true)
+	runner.SetMaxFailures(-1, false)
+	hi, err = runner.Run("true", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if hi.Summary.Fail != 2 || hi.Summary.Ok != 4 || hi.Summary.Skipped != 0 {
+		t.Errorf("Expected 2 failed and 4 ok hosts, got %+v", hi.Summary)
+	}
+}
+
+func TestRunnerStdin(t *testing.T) {
+	hosts := NewHostSet()
+	for _, name := range []string{"ok-1", "ok-2", "ok-3"} {
+		hosts.AddHost(NewHost(name, "", HostAttributes{}))
+	}
+	stdin, err := NewStdin(strings.NewReader("hello\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	runner := NewRunner(hosts, &fakeExecutor{})
+	runner.SetTimeout(time.Minute)
+	runner.SetHostTimeout(time.Minute)
+	runner.SetStdin(stdin)
+	hi, err := runner.Run("cat", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, r := range hi.Results {
+		if string(r.Stdout) != "hello\n" {
+			t.Errorf("Expected %s to receive stdin, got %q", r.Host, r.Stdout)
+		}
+	}
+}
+
+func TestRunnerPull(t *testing.T) {
+	hosts := NewHostSet()
+	for _, name := range []string{"ok-1", "ok-2"} {
+		hosts.AddHost(NewHost(name, "", HostAttributes{}))
+	}
+	runner := NewRunner(hosts, &fakeExecutor{})
+	runner.SetTimeout(time.Minute)
+	runner.SetHostTimeout(time.Minute)
+	hi, err := runner.Pull("/etc/motd", "out", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if hi.Command != "pull /etc/motd out" {
+		t.Errorf("Unexpected command: %s", hi.Command)
+	}
+	for _, r := range hi.Results {
+		want := filepath.Join("out", r.Host, "motd")
+		if len(r.Transfers) != 1 || r.Transfers[0].Destination != want {
+			t.Errorf("Expected %s to be pulled to %s, got %v", r.Host, want, r.Transfers)
+		}
+	}
+}
+
+func TestRunnerRetries(t *testing.T) {
+	hosts := NewHostSet()
+	for _, name := range []string{"flaky-0", "flaky-1", "flaky-2", "flaky-3", "auth-1"} {
+		hosts.AddHost(NewHost(name, "", HostAttributes{}))
+	}
+	executor := &flakyExecutor{attempts: make(map[string]int)}
+	runner := NewRunner(hosts, executor)
+	runner.SetTimeout(time.Minute)
+	runner.SetHostTimeout(time.Minute)
+	runner.SetRetries(ConnectError, 2)
+	runner.SetRetryBackoff(time.Millisecond)
+	pc := make(chan ProgressMessage)
+	retries := 0
+	done := make(chan bool)
+	go func() {
+		for msg := range pc {
+			if msg.State == Retrying {
+				retries++
+			}
+		}
+		done <- true
+	}()
+	hi, err := runner.Run("true", pc, nil)
+	close(pc)
+	<-done
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := map[string]int{"flaky-0": 1, "flaky-1": 2, "flaky-2": 3, "flaky-3": 3, "auth-1": 1}
+	for _, r := range hi.Results {
+		if r.Attempts != expected[r.Host] || executor.attempts[r.Host] != expected[r.Host] {
+			t.Errorf("Expected %d attempts for %s, got %d", expected[r.Host], r.Host, r.Attempts)
+		}
+	}
+	if hi.Summary.Ok != 3 || hi.Summary.Err != 2 {
+		t.Errorf("Expected 3 ok and 2 error hosts, got %+v", hi.Summary)
+	}
+	if retries != 5 {
+		t.Errorf("Expected 5 retries, got %d", retries)
+	}
+}
+
+func TestProgressCancelDuringRetry(t *testing.T) {
+	hosts := NewHostSet()
+	for _, name := range []string{"flaky-1", "flaky-2"} {
+		hosts.AddHost(NewHost(name, "", HostAttributes{}))
+	}
+	runner := NewRunner(hosts, &flakyExecutor{attempts: make(map[string]int)})
+	runner.SetTimeout(time.Minute)
+	runner.SetHostTimeout(time.Minute)
+	runner.SetRetries(ConnectError, 2)
+	runner.SetRetryBackoff(time.Hour)
+	ui := &SimpleUI{hosts: hosts, outputMode: OutputAll, pchan: make(chan outputMessage, 1000)}
+	upc := ui.ProgressChannel(time.Now().Add(time.Minute))
+
+	// Interrupt the run once both hosts are waiting to be retried
+	pc := make(chan ProgressMessage)
+	done := make(chan bool)
+	go func() {
+		retries := 0
+		for msg := range pc {
+			upc <- msg
+			if msg.State == Retrying {
+				retries++
+				if retries == 2 {
+					runner.Interrupt()
+				}
+			}
+		}
+		close(upc)
+		done <- true
+	}()
+	hi, err := runner.Run("true", pc, nil)
+	close(pc)
+	<-done
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if hi.Summary.Err != 2 {
+		t.Errorf("Expected 2 error hosts, got %+v", hi.Summary)
+	}
+
+	var last string
+	for msg := range ui.pchan {
+		if msg.message == "" {
+			break
+		}
+		if strings.Contains(msg.message, "-") {
+			t.Errorf("Negative count in progress message %q", msg.message)
+		}
+		if strings.HasPrefix(msg.message, "Waiting") {
+			last = msg.message
+		}
+	}
+	if !strings.Contains(last, ", 0 in progress, 1 retrying,") {
+		t.Errorf("Unexpected progress after the first cancelled retry: %q", last)
+	}
+}
+
+func TestParseCountOrPercentage(t *testing.T) {
+	tests := []struct {
+		input      string
+		count      int
+		percentage bool
+		err        bool
+	}{
+		{"10", 10, false, false},
+		{"25%", 25, true, false},
+		{"101%", 0, false, true},
+		{"ten", 0, false, true},
+	}
+	for _, test := range tests {
+		count, percentage, err := ParseCountOrPercentage(test.input)
+		if (err != nil) != test.err || count != test.count || percentage != test.percentage {
+			t.Errorf("ParseCountOrPercentage(%q) returned %d, %t, %v", test.input, count, percentage, err)
+		}
+	}
+}
+
+// recordingExecutor remembers which command was run on which host
+type recordingExecutor struct {
+	fakeExecutor
+	lock     sync.Mutex
+	commands map[string]string
+}
+
+func (e *recordingExecutor) Run(ctx context.Context, host *Host, cmd string, oc chan OutputLine) *Result {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.commands[host.Name] = cmd
+	return &Result{Host: host.Name}
+}
+
+func TestRunnerTemplateCommand(t *testing.T) {
+	hosts := NewHostSet()
+	hosts.AddHost(NewHost("web-1", "", HostAttributes{"dc": "ams1"}))
+	hosts.AddHost(NewHost("web-2", "", HostAttributes{"dc": "fra2"}))
+	hosts.AddHost(NewHost("web-3", "", HostAttributes{}))
+	executor := &recordingExecutor{commands: make(map[string]string)}
+	runner := NewRunner(hosts, executor)
+	runner.SetTimeout(time.Minute)
+	runner.SetHostTimeout(time.Minute)
+
+	hi, err := runner.Run("echo {{.Attributes.dc}}", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(executor.commands) != 3 || executor.commands["web-1"] != "echo {{.Attributes.dc}}" {
+		t.Errorf("Command should not be expanded by default, got %v", executor.commands)
+	}
+
+	runner.SetTemplateCommand(true)
+	executor.commands = make(map[string]string)
+	hi, err = runner.Run("echo {{.Name}} {{.Attributes.dc}}", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if executor.commands["web-1"] != "echo web-1 ams1" || executor.commands["web-2"] != "echo web-2 fra2" {
+		t.Errorf("Commands not expanded correctly: %v", executor.commands)
+	}
+	if _, ok := executor.commands["web-3"]; ok {
+		t.Errorf("Command with a missing attribute should not run, but ran %s", executor.commands["web-3"])
+	}
+	for _, r := range hi.Results {
+		if r.Host == "web-3" && (r.ExitStatus != -1 || r.Err == nil || !strings.Contains(r.Err.Error(), "Unable to expand command template")) {
+			t.Errorf("Expected an error for web-3, got %v", r.Err)
+		}
+	}
+
+	if _, err = runner.Run("echo {{.Name", nil, nil); err == nil || !strings.HasPrefix(err.Error(), "Invalid command template") {
+		t.Errorf("Expected an invalid template error, got %v", err)
+	}
+}
@@ -8,7 +8,14 @@ SET: 'set' ;
 ADD: 'add' ;
 REMOVE: 'remove' ;
 LIST: 'list' ;
+PUSH: 'push' ;
+PULL: 'pull' ;
 HOSTS: 'hosts' ;
+AND: 'and' ;
+OR: 'or' ;
+NOT: 'not' ;
+IN: 'in' ;
+EXISTS: 'exists' ;
 DURATION: ( '-'? [0-9]+ ( '.' [0-9]+ )? [smh] )+ ;
 NUMBER: '0x'?[0-9]+ ;
 IDENTIFIER: ( [a-zA-Z_][-a-zA-Z_.:0-9]*[a-zA-Z_0-9] | [a-zA-Z] );
@@ -17,6 +24,10 @@ EQUALS: '==' ;
 MATCHES: '=~' ;
 NOT_EQUALS: '!=';
 NOT_MATCHES: '!~';
+LESS_EQUALS: '<=' ;
+GREATER_EQUALS: '>=' ;
+LESS: '<' ;
+GREATER: '>' ;
 STRING
  : '"' ( '\\' . | ~[\\\r\n\f"] )* '"'
  ;
@@ -30,13 +41,19 @@ fragment SPACES: ' '+ ;
 SKIP_ : ( SPACES | COMMENT ) -> skip ;
 
 prog : line* EOF ;
-line : ( run | set | add | remove | list )? '\n' ;
+line : ( run | set | add | remove | list | push | pull )? '\n' ;
 run : RUN ;
 set: SET (varname=IDENTIFIER varvalue=scalar)? ;
 add: ADD HOSTS ( glob=(GLOB|IDENTIFIER) filters=filter* | filters=filter+ );
 remove: REMOVE HOSTS ( glob=(GLOB|IDENTIFIER) filters=filter* | filters=filter+ );
 list: LIST HOSTS opts=hash? ;
-filter: key=IDENTIFIER ( comp=( EQUALS | NOT_EQUALS ) val=scalar | comp=( MATCHES | NOT_MATCHES ) rx=REGEXP );
+push: PUSH src=STRING dst=STRING ;
+pull: PULL src=STRING dst=STRING ;
+filter: andFilter ( OR andFilter )* ;
+andFilter: notFilter ( AND notFilter )* ;
+notFilter: NOT notFilter | '(' filter ')' | EXISTS '(' key=path ')' | comparison ;
+comparison: key=path ( comp=( EQUALS | NOT_EQUALS | LESS | LESS_EQUALS | GREATER | GREATER_EQUALS ) val=scalar | comp=( MATCHES | NOT_MATCHES ) rx=REGEXP | comp=IN ( arr=array | val=scalar ) );
+path: IDENTIFIER ( '[' ( NUMBER | STRING ) ']' )* ;
 scalar: NUMBER | STRING | DURATION | IDENTIFIER ;
 value: scalar | array | hash ;
 array: ( '[' ']' | '[' value (',' value)* ']' );
@@ -40,9 +40,37 @@ func (c setCommand) execute(e *ScriptEngine) {
 		e.Runner.SetConnectTimeout(c.value.(time.Duration))
 	case "Parallel":
 		e.Runner.SetParallel(int(c.value.(int64)))
+	case "RetryConnect":
+		e.Runner.SetRetries(herd.ConnectError, int(c.value.(int64)))
+	case "RetryAuth":
+		e.Runner.SetRetries(herd.AuthError, int(c.value.(int64)))
+	case "RetryTimeout":
+		e.Runner.SetRetries(herd.SessionTimeout, int(c.value.(int64)))
+	case "RetryBackoff":
+		e.Runner.SetRetryBackoff(c.value.(time.Duration))
+	case "BatchSize":
+		v := c.value.(countOrPercentage)
+		e.Runner.SetBatchSize(v.count, v.percentage)
+	case "MaxFailures":
+		v := c.value.(countOrPercentage)
+		e.Runner.SetMaxFailures(v.count, v.percentage)
+	case "TemplateCommand":
+		e.Runner.SetTemplateCommand(c.value.(bool))
 	}
 }
 
+type countOrPercentage struct {
+	count      int
+	percentage bool
+}
+
+func (c countOrPercentage) String() string {
+	if c.percentage {
+		return fmt.Sprintf("%d%%", c.count)
+	}
+	return fmt.Sprintf("%d", c.count)
+}
+
 func (c setCommand) String() string {
 	return fmt.Sprintf("set %s %v", c.variable, c.value)
 }
@@ -100,16 +128,17 @@ func (c listHostsCommand) String() string {
 		c.opts.AllAttributes, strings.Join(c.opts.Attributes, ", "))
 }
 
-type runCommand struct {
-	command string
-}
-
-func (c runCommand) execute(e *ScriptEngine) {
-	oc := e.Ui.OutputChannel()
+// runOnHosts shows progress while a command, push or pull runs on all hosts,
+// and records its result in the history. Only commands stream their output.
+func runOnHosts(e *ScriptEngine, what string, output bool, run func(pc chan herd.ProgressMessage, oc chan herd.OutputLine) (*herd.HistoryItem, error)) {
+	var oc chan herd.OutputLine
+	if output {
+		oc = e.Ui.OutputChannel()
+	}
 	pc := e.Ui.ProgressChannel(time.Now().Add(e.Runner.GetTimeout()))
-	hi, err := e.Runner.Run(c.command, pc, oc)
+	hi, err := run(pc, oc)
 	if err != nil {
-		logrus.Errorf("Unable to execute %s: %s", c.command, err)
+		logrus.Errorf("Unable to %s: %s", what, err)
 	}
 	if oc != nil {
 		close(oc)
@@ -122,6 +151,46 @@ func (c runCommand) execute(e *ScriptEngine) {
 	}
 }
 
+type runCommand struct {
+	command string
+}
+
+func (c runCommand) execute(e *ScriptEngine) {
+	runOnHosts(e, "execute "+c.command, true, func(pc chan herd.ProgressMessage, oc chan herd.OutputLine) (*herd.HistoryItem, error) {
+		return e.Runner.Run(c.command, pc, oc)
+	})
+}
+
 func (c runCommand) String() string {
 	return "run " + c.command
 }
+
+type pushCommand struct {
+	src string
+	dst string
+}
+
+func (c pushCommand) execute(e *ScriptEngine) {
+	runOnHosts(e, "push "+c.src, false, func(pc chan herd.ProgressMessage, _ chan herd.OutputLine) (*herd.HistoryItem, error) {
+		return e.Runner.Push(c.src, c.dst, pc)
+	})
+}
+
+func (c pushCommand) String() string {
+	return fmt.Sprintf("push %q %q", c.src, c.dst)
+}
+
+type pullCommand struct {
+	src string
+	dst string
+}
+
+func (c pullCommand) execute(e *ScriptEngine) {
+	runOnHosts(e, "pull "+c.src, false, func(pc chan herd.ProgressMessage, _ chan herd.OutputLine) (*herd.HistoryItem, error) {
+		return e.Runner.Pull(c.src, c.dst, pc)
+	})
+}
+
+func (c pullCommand) String() string {
+	return fmt.Sprintf("pull %q %q", c.src, c.dst)
+}
@@ -39,7 +39,7 @@ func (e *ScriptEngine) ParseCommandLine(args []string, splitAt int) error {
 	if splitAt != -1 {
 		filters = filters[:splitAt]
 	}
-	comparison := regexp.MustCompile("^(.*?)(=~|==?|!=|!~)(.*)$")
+	comparison := regexp.MustCompile(`^(.*?)(=~|==?|!=|!~|<=?|>=?|\sin\s)(.*)$`)
 	sampling := regexp.MustCompile("^((?:(?:[^:]*):)+)([0-9]+)$")
 	// First we add hosts from the command line, in all modes
 	commands := make([]command, 0)
@@ -49,7 +49,7 @@ hostspecLoop:
 		glob := filters[0]
 		// Do we have a glob or not?
 		haveGlob := true
-		if comparison.MatchString(glob) {
+		if comparison.MatchString(glob) || isFilterExpression(glob) {
 			haveGlob = false
 		} else if sampling.MatchString(glob) {
 			haveGlob = false
@@ -65,12 +65,16 @@ hostspecLoop:
 		} else {
 			filters = filters[1:]
 		}
-		attrs := make(herd.MatchAttributes, 0)
+		filterArgs := make([]string, 0)
 		sampled := make([]string, 0)
 		count := 0
 		for i, arg := range filters {
 			if arg == "+" || arg == "-" {
 				filters = filters[i+1:]
+				attrs, err := ParseFilters(filterArgs)
+				if err != nil {
+					return err
+				}
 				if add {
 					commands = append(commands, addHostsCommand{glob: glob, attributes: attrs, sampled: sampled, count: count})
 				} else {
@@ -106,33 +110,14 @@ hostspecLoop:
 				count64, _ := strconv.ParseInt(sampledAndCount[2], 0, 64)
 				count = int(count64)
 			} else {
-				parts := comparison.FindStringSubmatch(arg)
-				if len(parts) == 0 {
-					return fmt.Errorf("incorrect filter: %s", arg)
-				}
-				key, comp, val := parts[1], parts[2], parts[3]
-				attr := herd.MatchAttribute{Name: key, Value: val, FuzzyTyping: true}
-				if strings.HasPrefix(comp, "!") {
-					attr.Negate = true
-				}
-				if strings.HasSuffix(comp, "~") {
-					re, err := regexp.Compile(val)
-					if err != nil {
-						return fmt.Errorf("Invalid regexp /%s/: %s", val, err)
-					} else {
-						attr.Value = re
-						attr.Regex = true
-						attr.FuzzyTyping = false
-					}
-				}
-				if !attr.Regex && strings.HasPrefix(val, "$") {
-					attr.Reference = true
-					attr.Attribute = attr.Value.(string)[1:]
-				}
-				attrs = append(attrs, attr)
+				filterArgs = append(filterArgs, arg)
 			}
 		}
 		// We've fallen through, so no more hostspecs
+		attrs, err := ParseFilters(filterArgs)
+		if err != nil {
+			return err
+		}
 		if add {
 			commands = append(commands, addHostsCommand{glob: glob, attributes: attrs, sampled: sampled, count: count})
 		} else {
@@ -169,6 +154,17 @@ func (e *ScriptEngine) ParseCodeLine(code string) error {
 	return nil
 }
 
+// QueuePush queues a copy of the local file src to dst on all selected hosts
+func (e *ScriptEngine) QueuePush(src, dst string) {
+	e.commands = append(e.commands, pushCommand{src: src, dst: dst})
+}
+
+// QueuePull queues a copy of src on all selected hosts to per-host
+// directories under the local directory dst
+func (e *ScriptEngine) QueuePull(src, dst string) {
+	e.commands = append(e.commands, pullCommand{src: src, dst: dst})
+}
+
 func (e *ScriptEngine) Execute() {
 	if len(e.commands) < e.position {
 		return
@@ -1,6 +1,7 @@
 package scripting
 
 import (
+	"net/netip"
 	"regexp"
 	"strings"
 	"testing"
@@ -118,6 +119,83 @@ func TestParseCommandLine(t *testing.T) {
 			cmd:  []command{},
 			err:  "only one sampling per hostspec allowed",
 		},
+		{
+			spec: []string{"(role==db or role==cache) and cpu_count>=16"},
+			cmd: []command{addHostsCommand{glob: "*", attributes: herd.MatchAttributes{
+				{Any: []herd.MatchAttributes{{{Name: "role", Value: "db", FuzzyTyping: true}}, {{Name: "role", Value: "cache", FuzzyTyping: true}}}},
+				{Name: "cpu_count", Value: "16", FuzzyTyping: true, Operator: herd.MatchGreaterOrEqual},
+			}, sampled: []string{}}},
+			err: "",
+		},
+		{
+			spec: []string{"web-*", "not exists(retired)", "address in [10.0.0.0/8, 192.0.2.1]", "uptime < 1h"},
+			cmd: []command{addHostsCommand{glob: "web-*", attributes: herd.MatchAttributes{
+				{Name: "retired", Operator: herd.MatchExists, Negate: true},
+				{Name: "address", Value: []any{netip.MustParsePrefix("10.0.0.0/8"), "192.0.2.1"}, FuzzyTyping: true, Operator: herd.MatchIn},
+				{Name: "uptime", Value: "1h", FuzzyTyping: true, Operator: herd.MatchLess},
+			}, sampled: []string{}}},
+			err: "",
+		},
+		{
+			spec: []string{"not (role=db and site=ams1)"},
+			cmd: []command{addHostsCommand{glob: "*", attributes: herd.MatchAttributes{
+				{Any: []herd.MatchAttributes{{{Name: "role", Value: "db", FuzzyTyping: true}, {Name: "site", Value: "ams1", FuzzyTyping: true}}}, Negate: true},
+			}, sampled: []string{}}},
+			err: "",
+		},
+		{
+			spec: []string{"os.release.major>=12", `labels["app.kubernetes.io/name"]==postgres`},
+			cmd: []command{addHostsCommand{glob: "*", attributes: herd.MatchAttributes{
+				{Name: "os.release.major", Value: "12", FuzzyTyping: true, Operator: herd.MatchGreaterOrEqual},
+				{Name: `labels["app.kubernetes.io/name"]`, Value: "postgres", FuzzyTyping: true},
+			}, sampled: []string{}}},
+			err: "",
+		},
+		{
+			spec: []string{"(role==db or role==cache"},
+			cmd:  []command{},
+			err:  "incorrect filter: missing )",
+		},
+		{
+			spec: []string{"role==db", "(role==web or ())"},
+			cmd:  []command{},
+			err:  "incorrect filter: unexpected )",
+		},
+		{
+			spec: []string{"not role==db or"},
+			cmd:  []command{},
+			err:  "incorrect filter: unexpected end of filter",
+		},
+		{
+			spec: []string{"role in [db, cache]", "description==web server (old)", "and==1", "not==x"},
+			cmd: []command{addHostsCommand{glob: "*", attributes: herd.MatchAttributes{
+				{Name: "role", Value: []any{"db", "cache"}, FuzzyTyping: true, Operator: herd.MatchIn},
+				{Name: "description", Value: "web server (old)", FuzzyTyping: true},
+				{Name: "and", Value: "1", FuzzyTyping: true},
+				{Name: "not", Value: "x", FuzzyTyping: true},
+			}, sampled: []string{}}},
+			err: "",
+		},
+		{
+			spec: []string{"cpu_count>=16 and role==db"},
+			cmd:  []command{},
+			err:  "incorrect filter: cpu_count>=16 and role==db, use parentheses to combine filters: (cpu_count>=16 and role==db)",
+		},
+		{
+			spec: []string{"role==db or role==cache"},
+			cmd:  []command{},
+			err:  "incorrect filter: role==db or role==cache, use parentheses to combine filters: (role==db or role==cache)",
+		},
+		{
+			spec: []string{"cpu_count>=lots"},
+			cmd:  []command{},
+			err:  "incorrect filter: >= needs a number or duration, not lots",
+		},
+		{
+			spec: []string{"(role==db and uptime<forever)"},
+			cmd:  []command{},
+			err:  "incorrect filter: < needs a number or duration, not forever",
+		},
 		{
 			spec: []string{"file:1"},
 			cmd:  []command{addHostsCommand{glob: "file:1", attributes: herd.MatchAttributes{}, sampled: []string{}}},
@@ -0,0 +1,405 @@
+package scripting
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/seveas/herd"
+)
+
+// Filters on the command line are separate arguments that all have to match,
+// but an argument can also be an expression, combining filters with and, or,
+// not and parentheses:
+//
+//	(role==db or role==cache) and cpu_count>=16 and not exists(retired)
+//
+// Only arguments that start with a parenthesis, not or exists() are
+// expressions. All other arguments are a single filter whose value is the
+// rest of the argument, so those can contain spaces and parentheses without
+// needing quotes. They can't contain and or or after a value though, as that
+// is almost certainly an expression missing its parentheses. In expressions,
+// values extend up to the next and, or or unbalanced closing parenthesis,
+// unless they are double-quoted.
+
+type filterTokenType int
+
+const (
+	filterTokenFilter filterTokenType = iota
+	filterTokenAnd
+	filterTokenOr
+	filterTokenNot
+	filterTokenOpen
+	filterTokenClose
+)
+
+type filterToken struct {
+	typ  filterTokenType
+	text string
+	attr herd.MatchAttribute
+}
+
+// The operators that can appear in filters, longest first so that >= is not
+// mistaken for >
+var filterOperators = []string{"=~", "==", "!=", "!~", "<=", ">=", "=", "<", ">"}
+
+var existsFilter = regexp.MustCompile(`^exists\(\s*([^()\s]+)\s*\)`)
+
+// isFilterExpression returns whether an argument is an expression, and thus
+// can't be a glob
+func isFilterExpression(arg string) bool {
+	return strings.HasPrefix(arg, "(") || keywordAt(arg, "not") || existsFilter.MatchString(arg)
+}
+
+// keywordAt returns whether s starts with the given keyword, followed by
+// whitespace, a parenthesis or the end of s
+func keywordAt(s, keyword string) bool {
+	if !strings.HasPrefix(s, keyword) {
+		return false
+	}
+	rest := s[len(keyword):]
+	return rest == "" || rest[0] == '(' || rest[0] == ')' || unicode.IsSpace(rune(rest[0]))
+}
+
+func tokenizeFilters(args []string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	for _, arg := range args {
+		if !isFilterExpression(arg) {
+			attr, _, err := parseFilter(arg, false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, filterToken{typ: filterTokenFilter, text: arg, attr: attr})
+			continue
+		}
+		s := arg
+		for {
+			s = strings.TrimLeftFunc(s, unicode.IsSpace)
+			if s == "" {
+				break
+			}
+			switch {
+			case s[0] == '(':
+				tokens = append(tokens, filterToken{typ: filterTokenOpen, text: "("})
+				s = s[1:]
+			case s[0] == ')':
+				tokens = append(tokens, filterToken{typ: filterTokenClose, text: ")"})
+				s = s[1:]
+			case keywordAt(s, "and"):
+				tokens = append(tokens, filterToken{typ: filterTokenAnd, text: "and"})
+				s = s[3:]
+			case keywordAt(s, "or"):
+				tokens = append(tokens, filterToken{typ: filterTokenOr, text: "or"})
+				s = s[2:]
+			case keywordAt(s, "not"):
+				tokens = append(tokens, filterToken{typ: filterTokenNot, text: "not"})
+				s = s[3:]
+			default:
+				if m := existsFilter.FindStringSubmatch(s); m != nil {
+					attr := herd.MatchAttribute{Name: m[1], Operator: herd.MatchExists}
+					tokens = append(tokens, filterToken{typ: filterTokenFilter, text: m[0], attr: attr})
+					s = s[len(m[0]):]
+					continue
+				}
+				attr, n, err := parseFilter(s, true)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, filterToken{typ: filterTokenFilter, text: s[:n], attr: attr})
+				s = s[n:]
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// parseFilter parses a single filter at the start of s, and returns it
+// together with the length of the text it was parsed from. Outside of
+// expressions, the value is all of the remaining text, unless and or or
+// follow what would be the value in an expression.
+func parseFilter(s string, expression bool) (herd.MatchAttribute, int, error) {
+	end := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == ')' })
+	if end == -1 {
+		end = len(s)
+	}
+	keyEnd, comp := -1, ""
+	for i := range s {
+		for _, op := range filterOperators {
+			if strings.HasPrefix(s[i:], op) {
+				keyEnd, comp = i, op
+				break
+			}
+		}
+		if comp != "" || i == end {
+			break
+		}
+	}
+	if comp == "" {
+		// Operators can also be separated from the key by spaces, and in
+		// has to be
+		rest := strings.TrimLeftFunc(s[end:], unicode.IsSpace)
+		if keywordAt(rest, "in") {
+			comp = "in"
+		}
+		for _, op := range filterOperators {
+			if comp == "" && strings.HasPrefix(rest, op) {
+				comp = op
+			}
+		}
+		if end == 0 || comp == "" {
+			return herd.MatchAttribute{}, 0, fmt.Errorf("incorrect filter: %s", s[:max(end, 1)])
+		}
+		keyEnd = len(s) - len(rest)
+	}
+	pos := keyEnd + len(comp)
+	key := strings.TrimRightFunc(s[:keyEnd], unicode.IsSpace)
+	if key == "" || strings.ContainsFunc(key, unicode.IsSpace) {
+		return herd.MatchAttribute{}, 0, fmt.Errorf("incorrect filter: %s", s[:max(end, 1)])
+	}
+	pos = len(s) - len(strings.TrimLeftFunc(s[pos:], unicode.IsSpace))
+	val, n := scanFilterValue(s[pos:], comp == "in")
+	if !expression {
+		rest := strings.TrimLeftFunc(s[pos+n:], unicode.IsSpace)
+		if keywordAt(rest, "and") || keywordAt(rest, "or") {
+			return herd.MatchAttribute{}, 0, fmt.Errorf("incorrect filter: %s, use parentheses to combine filters: (%s)", s, s)
+		}
+		val, n = s[pos:], len(s)-pos
+	}
+	pos += n
+
+	attr := herd.MatchAttribute{Name: key, Value: val, FuzzyTyping: true}
+	switch comp {
+	case "in":
+		attr.Operator = herd.MatchIn
+		attr.Value = parseFilterList(val)
+		return attr, pos, nil
+	case "<":
+		attr.Operator = herd.MatchLess
+	case "<=":
+		attr.Operator = herd.MatchLessOrEqual
+	case ">":
+		attr.Operator = herd.MatchGreater
+	case ">=":
+		attr.Operator = herd.MatchGreaterOrEqual
+	}
+	if attr.Operator != herd.MatchEqual {
+		if _, ok := herd.NumericValue(val); !ok {
+			return attr, 0, fmt.Errorf("incorrect filter: %s needs a number or duration, not %s", comp, val)
+		}
+	}
+	if strings.HasPrefix(comp, "!") {
+		attr.Negate = true
+	}
+	if strings.HasSuffix(comp, "~") {
+		re, err := regexp.Compile(val)
+		if err != nil {
+			return attr, 0, fmt.Errorf("Invalid regexp /%s/: %s", val, err)
+		}
+		attr.Value = re
+		attr.Regex = true
+		attr.FuzzyTyping = false
+	}
+	if !attr.Regex && attr.Operator == herd.MatchEqual && strings.HasPrefix(val, "$") {
+		attr.Reference = true
+		attr.Attribute = val[1:]
+	}
+	return attr, pos, nil
+}
+
+// scanFilterValue finds the end of a value in a filter, and returns the value
+// and the length of the text it was found in. Quoted values are unquoted,
+// lists in square brackets are kept as-is.
+func scanFilterValue(s string, list bool) (string, int) {
+	if strings.HasPrefix(s, `"`) {
+		if q, err := strconv.QuotedPrefix(s); err == nil {
+			v, _ := strconv.Unquote(q)
+			return v, len(q)
+		}
+	}
+	if list && strings.HasPrefix(s, "[") {
+		if i := strings.IndexByte(s, ']'); i != -1 {
+			return s[:i+1], i + 1
+		}
+	}
+	depth := 0
+	for i, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth == 0 {
+				return strings.TrimRightFunc(s[:i], unicode.IsSpace), i
+			}
+			depth--
+		case unicode.IsSpace(r) && depth == 0:
+			rest := strings.TrimLeftFunc(s[i:], unicode.IsSpace)
+			if keywordAt(rest, "and") || keywordAt(rest, "or") || strings.HasPrefix(rest, ")") || rest == "" {
+				return s[:i], i
+			}
+		}
+	}
+	return s, len(s)
+}
+
+// parseFilterList parses the value of an in filter: a single value or a list
+// of comma separated values in square brackets. Values that look like a
+// network in CIDR notation match all addresses in that network.
+func parseFilterList(s string) []any {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	values := []any{}
+	for v := range strings.SplitSeq(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if u, err := strconv.Unquote(v); err == nil {
+			v = u
+		}
+		if prefix, err := netip.ParsePrefix(v); err == nil {
+			values = append(values, prefix.Masked())
+		} else {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// filterParser turns a list of tokens into MatchAttributes. Filters that
+// follow each other without an operator in between all have to match, just
+// like with and.
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// ParseFilters parses filters the way they are given on the command line: all
+// arguments have to match, and each argument can be a filter expression. This
+// makes it possible to use the same filters elsewhere, such as in config
+// files.
+func ParseFilters(args []string) (herd.MatchAttributes, error) {
+	tokens, err := tokenizeFilters(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return herd.MatchAttributes{}, nil
+	}
+	p := &filterParser{tokens: tokens}
+	attrs, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.unexpected()
+	}
+	return attrs, nil
+}
+
+func (p *filterParser) unexpected() error {
+	if t := p.peek(); t != nil {
+		return fmt.Errorf("incorrect filter: unexpected %s", t.text)
+	}
+	return fmt.Errorf("incorrect filter: unexpected end of filter")
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (herd.MatchAttributes, error) {
+	attrs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	alternatives := []herd.MatchAttributes{attrs}
+	for t := p.peek(); t != nil && t.typ == filterTokenOr; t = p.peek() {
+		p.pos++
+		attrs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, attrs)
+	}
+	return anyOf(alternatives), nil
+}
+
+func (p *filterParser) parseAnd() (herd.MatchAttributes, error) {
+	attrs := herd.MatchAttributes{}
+	for {
+		t := p.peek()
+		if t == nil || t.typ == filterTokenOr || t.typ == filterTokenClose {
+			if len(attrs) == 0 {
+				return nil, p.unexpected()
+			}
+			return attrs, nil
+		}
+		if t.typ == filterTokenAnd {
+			if len(attrs) == 0 {
+				return nil, p.unexpected()
+			}
+			p.pos++
+		}
+		more, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, more...)
+	}
+}
+
+func (p *filterParser) parseNot() (herd.MatchAttributes, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, p.unexpected()
+	}
+	p.pos++
+	switch t.typ {
+	case filterTokenNot:
+		attrs, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return negate(attrs), nil
+	case filterTokenOpen:
+		attrs, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.typ != filterTokenClose {
+			return nil, fmt.Errorf("incorrect filter: missing )")
+		}
+		p.pos++
+		return attrs, nil
+	case filterTokenFilter:
+		return herd.MatchAttributes{t.attr}, nil
+	}
+	p.pos--
+	return nil, p.unexpected()
+}
+
+// anyOf combines alternatives, of which at least one has to match
+func anyOf(alternatives []herd.MatchAttributes) herd.MatchAttributes {
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	return herd.MatchAttributes{{Any: alternatives}}
+}
+
+// negate inverts filters. A single filter can simply be negated, multiple
+// filters are negated as a group.
+func negate(attrs herd.MatchAttributes) herd.MatchAttributes {
+	if len(attrs) == 1 {
+		attr := attrs[0]
+		attr.Negate = !attr.Negate
+		return herd.MatchAttributes{attr}
+	}
+	return herd.MatchAttributes{{Any: []herd.MatchAttributes{attrs}, Negate: true}}
+}
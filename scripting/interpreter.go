@@ -2,6 +2,7 @@ package scripting
 
 import (
 	"fmt"
+	"net/netip"
 	"regexp"
 	"strconv"
 	"strings"
@@ -112,16 +113,40 @@ func (l *herdListener) ExitSet(c *parser.SetContext) {
 	case "HostTimeout":
 		fallthrough
 	case "ConnectTimeout":
+		fallthrough
+	case "RetryBackoff":
 		if _, ok := varValue.(time.Duration); !ok {
 			err = fmt.Errorf("%s must be a duration", varName)
 		}
 
 	case "Parallel":
+		fallthrough
+	case "RetryConnect":
+		fallthrough
+	case "RetryAuth":
+		fallthrough
+	case "RetryTimeout":
 		if _, ok := varValue.(int64); !ok {
 			err = fmt.Errorf("%s must be a number", varName)
 		}
+	case "BatchSize":
+		fallthrough
+	case "MaxFailures":
+		switch v := varValue.(type) {
+		case int64:
+			varValue = countOrPercentage{count: int(v)}
+		case string:
+			var cp countOrPercentage
+			if cp.count, cp.percentage, err = herd.ParseCountOrPercentage(v); err == nil {
+				varValue = cp
+			}
+		default:
+			err = fmt.Errorf("%s must be a number or a percentage", varName)
+		}
 	case "Timestamp":
 		fallthrough
+	case "TemplateCommand":
+		fallthrough
 	case "NoPager":
 		fallthrough
 	case "NoColor":
@@ -131,15 +156,18 @@ func (l *herdListener) ExitSet(c *parser.SetContext) {
 	case "Output":
 		if s, ok := varValue.(string); ok {
 			outputModes := map[string]herd.OutputMode{
-				"all":      herd.OutputAll,
-				"inline":   herd.OutputInline,
-				"per-host": herd.OutputPerhost,
-				"tail":     herd.OutputTail,
+				"all":       herd.OutputAll,
+				"inline":    herd.OutputInline,
+				"per-host":  herd.OutputPerhost,
+				"tail":      herd.OutputTail,
+				"grouped":   herd.OutputGrouped,
+				"diff":      herd.OutputDiff,
+				"dashboard": herd.OutputDashboard,
 			}
-			if s == "all" || s == "per-host" || s == "inline" || s == "tail" {
-				varValue = outputModes[s]
+			if mode, ok := outputModes[s]; ok {
+				varValue = mode
 			} else {
-				err = fmt.Errorf("Unknown output mode: %s. Known modes: all, per-host, inline, tail", s)
+				err = fmt.Errorf("Unknown output mode: %s. Known modes: all, per-host, inline, tail, grouped, diff, dashboard", s)
 			}
 		} else {
 			err = fmt.Errorf("%s must be a string", varName)
@@ -202,39 +230,123 @@ func (l *herdListener) parseFilters(filters []parser.IFilterContext) herd.MatchA
 	attrs := make(herd.MatchAttributes, 0, len(filters))
 	for _, filter := range filters {
 		// If there already are lexer/parser errors, don't bother anymore
-		for _, child := range filter.GetChildren() {
-			if _, ok := child.(*antlr.ErrorNodeImpl); ok {
-				return attrs
-			}
+		if hasErrorNode(filter) {
+			return attrs
+		}
+		more, err := convertFilter(filter)
+		if err != nil {
+			continue
 		}
+		attrs = append(attrs, more...)
+	}
+	return attrs
+}
 
-		key := filter.GetKey().GetText()
-		attr := herd.MatchAttribute{Name: key}
-		comp := filter.GetComp().GetText()
-		if strings.HasPrefix(comp, "!") {
-			attr.Negate = true
+func hasErrorNode(tree antlr.Tree) bool {
+	if _, ok := tree.(*antlr.ErrorNodeImpl); ok {
+		return true
+	}
+	for _, child := range tree.GetChildren() {
+		if hasErrorNode(child) {
+			return true
 		}
-		if strings.HasSuffix(comp, "~") {
-			s := filter.GetRx().GetText()
-			value, err := regexp.Compile(strings.ReplaceAll(s[1:len(s)-1], "\\/", "/"))
+	}
+	return false
+}
+
+// convertFilter turns a filter expression into MatchAttributes. Errors are
+// reported to the error listeners, and returned so the caller can skip the
+// filter.
+func convertFilter(filter parser.IFilterContext) (herd.MatchAttributes, error) {
+	alternatives := []herd.MatchAttributes{}
+	for _, af := range filter.AllAndFilter() {
+		attrs := herd.MatchAttributes{}
+		for _, nf := range af.AllNotFilter() {
+			more, err := convertNotFilter(nf)
 			if err != nil {
-				filter.GetParser().NotifyErrorListeners(err.Error(), filter.GetVal().GetStart(), nil)
-				continue
+				return nil, err
 			}
-			attr.Regex = true
-			attr.FuzzyTyping = false
-			attr.Value = value
-		} else {
-			value, err := convertScalar(filter.GetVal())
-			if err != nil {
-				filter.GetParser().NotifyErrorListeners(err.Error(), filter.GetVal().GetStart(), nil)
-				continue
+			attrs = append(attrs, more...)
+		}
+		alternatives = append(alternatives, attrs)
+	}
+	return anyOf(alternatives), nil
+}
+
+func convertNotFilter(filter parser.INotFilterContext) (herd.MatchAttributes, error) {
+	nf := filter.(*parser.NotFilterContext)
+	switch {
+	case nf.NOT() != nil:
+		attrs, err := convertNotFilter(nf.NotFilter())
+		if err != nil {
+			return nil, err
+		}
+		return negate(attrs), nil
+	case nf.Filter() != nil:
+		return convertFilter(nf.Filter())
+	case nf.EXISTS() != nil:
+		return herd.MatchAttributes{{Name: nf.GetKey().GetText(), Operator: herd.MatchExists}}, nil
+	}
+	c := nf.Comparison().(*parser.ComparisonContext)
+	attr := herd.MatchAttribute{Name: c.GetKey().GetText()}
+	comp := c.GetComp().GetText()
+	switch comp {
+	case "<":
+		attr.Operator = herd.MatchLess
+	case "<=":
+		attr.Operator = herd.MatchLessOrEqual
+	case ">":
+		attr.Operator = herd.MatchGreater
+	case ">=":
+		attr.Operator = herd.MatchGreaterOrEqual
+	case "in":
+		attr.Operator = herd.MatchIn
+	}
+	if strings.HasPrefix(comp, "!") {
+		attr.Negate = true
+	}
+	switch {
+	case strings.HasSuffix(comp, "~"):
+		s := c.GetRx().GetText()
+		value, err := regexp.Compile(strings.ReplaceAll(s[1:len(s)-1], "\\/", "/"))
+		if err != nil {
+			c.GetParser().NotifyErrorListeners(err.Error(), c.GetRx(), nil)
+			return nil, err
+		}
+		attr.Regex = true
+		attr.Value = value
+	case c.GetArr() != nil:
+		values, err := convertArray(c.GetArr())
+		if err != nil {
+			c.GetParser().NotifyErrorListeners(err.Error(), c.GetArr().GetStart(), nil)
+			return nil, err
+		}
+		attr.Value = networks(values)
+	default:
+		value, err := convertScalar(c.GetVal())
+		if err != nil {
+			c.GetParser().NotifyErrorListeners(err.Error(), c.GetVal().GetStart(), nil)
+			return nil, err
+		}
+		attr.Value = value
+		if attr.Operator == herd.MatchIn {
+			attr.Value = networks([]any{value})
+		}
+	}
+	return herd.MatchAttributes{attr}, nil
+}
+
+// networks replaces strings in CIDR notation with the networks they describe,
+// so in can match addresses in them
+func networks(values []any) []any {
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			if prefix, err := netip.ParsePrefix(s); err == nil {
+				values[i] = prefix.Masked()
 			}
-			attr.Value = value
 		}
-		attrs = append(attrs, attr)
 	}
-	return attrs
+	return values
 }
 
 func (l *herdListener) ExitList(c *parser.ListContext) {
@@ -307,6 +419,48 @@ func (l *herdListener) ExitRun(c *parser.RunContext) {
 	l.commands = append(l.commands, runCommand{command: command})
 }
 
+func (l *herdListener) ExitPush(c *parser.PushContext) {
+	if l.errorListener.hasErrors() {
+		return
+	}
+	src, dst, ok := l.parseTransfer(c.GetParser(), c.GetSrc(), c.GetDst())
+	if !ok {
+		return
+	}
+	l.commands = append(l.commands, pushCommand{src: src, dst: dst})
+}
+
+func (l *herdListener) ExitPull(c *parser.PullContext) {
+	if l.errorListener.hasErrors() {
+		return
+	}
+	src, dst, ok := l.parseTransfer(c.GetParser(), c.GetSrc(), c.GetDst())
+	if !ok {
+		return
+	}
+	l.commands = append(l.commands, pullCommand{src: src, dst: dst})
+}
+
+func (l *herdListener) parseTransfer(p antlr.Parser, srcToken, dstToken antlr.Token) (string, string, bool) {
+	src, err := strconv.Unquote(srcToken.GetText())
+	if err == nil && src == "" {
+		err = fmt.Errorf("no source specified")
+	}
+	if err != nil {
+		p.NotifyErrorListeners(err.Error(), srcToken, nil)
+		return "", "", false
+	}
+	dst, err := strconv.Unquote(dstToken.GetText())
+	if err == nil && dst == "" {
+		err = fmt.Errorf("no destination specified")
+	}
+	if err != nil {
+		p.NotifyErrorListeners(err.Error(), dstToken, nil)
+		return "", "", false
+	}
+	return src, dst, true
+}
+
 func parseCode(code string) ([]command, error) {
 	is := antlr.NewInputStream(code)
 	lexer := parser.NewHerdLexer(is)
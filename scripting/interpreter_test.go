@@ -2,6 +2,7 @@ package scripting
 
 import (
 	"fmt"
+	"net/netip"
 	"regexp"
 	"strings"
 	"testing"
@@ -31,7 +32,7 @@ var testcases = []testcase{
 	},
 	{
 		program: "syntax error",
-		errors:  []error{fmt.Errorf("line 1:0 mismatched input 'syntax' expecting {<EOF>, '\\n', RUN, 'set', 'add', 'remove', 'list'}")},
+		errors:  []error{fmt.Errorf("line 1:0 mismatched input 'syntax' expecting {<EOF>, '\\n', RUN, 'set', 'add', 'remove', 'list', 'push', 'pull'}")},
 	},
 	{
 		program: strings.Join([]string{
@@ -56,6 +57,33 @@ var testcases = []testcase{
 			listHostsCommand{opts: herd.HostListOptions{Separator: "-", OneLine: true, AllAttributes: true, Attributes: []string{"foo"}, Csv: true}},
 		},
 	},
+	{
+		program: strings.Join([]string{
+			"add hosts * (role == \"db\" or role == \"cache\") and cpu_count >= 16",
+			"add hosts web-* not exists(retired) address in [\"10.0.0.0/8\", \"192.0.2.1\"] uptime < 1h",
+			"remove hosts * not (site == \"ams1\" and rack =~ /^a/)",
+			"add hosts * os.release.major >= 12 tags[0] == \"db\" exists(labels[\"app.kubernetes.io/name\"])",
+		}, "\n") + "\n",
+		commands: []command{
+			addHostsCommand{glob: "*", attributes: herd.MatchAttributes{
+				{Any: []herd.MatchAttributes{{{Name: "role", Value: "db"}}, {{Name: "role", Value: "cache"}}}},
+				{Name: "cpu_count", Value: int64(16), Operator: herd.MatchGreaterOrEqual},
+			}},
+			addHostsCommand{glob: "web-*", attributes: herd.MatchAttributes{
+				{Name: "retired", Operator: herd.MatchExists, Negate: true},
+				{Name: "address", Value: []any{netip.MustParsePrefix("10.0.0.0/8"), "192.0.2.1"}, Operator: herd.MatchIn},
+				{Name: "uptime", Value: time.Hour, Operator: herd.MatchLess},
+			}},
+			removeHostsCommand{glob: "*", attributes: herd.MatchAttributes{
+				{Any: []herd.MatchAttributes{{{Name: "site", Value: "ams1"}, {Name: "rack", Value: regexp.MustCompile("^a"), Regex: true}}}, Negate: true},
+			}},
+			addHostsCommand{glob: "*", attributes: herd.MatchAttributes{
+				{Name: "os.release.major", Value: int64(12), Operator: herd.MatchGreaterOrEqual},
+				{Name: "tags[0]", Value: "db"},
+				{Name: `labels["app.kubernetes.io/name"]`, Operator: herd.MatchExists},
+			}},
+		},
+	},
 	{
 		program: "list hosts {OneLine: 1, Align: \"foo\", Separator: nil, AllAttributes: 3m, Attributes: [true], Csv: 21, Header: \"oink\"}\n",
 		errors: []error{
@@ -80,6 +108,13 @@ var testcases = []testcase{
 			"set NoColor true",
 			"set LogLevel \"debug\"",
 			"set Output \"inline\"",
+			"set BatchSize 10",
+			"set MaxFailures \"5%\"",
+			"set RetryConnect 3",
+			"set RetryAuth 1",
+			"set RetryTimeout 2",
+			"set RetryBackoff 2s",
+			"set TemplateCommand true",
 		}, "\n") + "\n",
 		commands: []command{
 			setCommand{variable: "Splay", value: 5 * time.Second},
@@ -92,6 +127,13 @@ var testcases = []testcase{
 			setCommand{variable: "NoColor", value: true},
 			setCommand{variable: "LogLevel", value: logrus.DebugLevel},
 			setCommand{variable: "Output", value: herd.OutputInline},
+			setCommand{variable: "BatchSize", value: countOrPercentage{count: 10}},
+			setCommand{variable: "MaxFailures", value: countOrPercentage{count: 5, percentage: true}},
+			setCommand{variable: "RetryConnect", value: int64(3)},
+			setCommand{variable: "RetryAuth", value: int64(1)},
+			setCommand{variable: "RetryTimeout", value: int64(2)},
+			setCommand{variable: "RetryBackoff", value: 2 * time.Second},
+			setCommand{variable: "TemplateCommand", value: true},
 		},
 	},
 	{
@@ -114,6 +156,22 @@ var testcases = []testcase{
 		program: "set Parallel \"nope\"\n",
 		errors:  []error{fmt.Errorf("line 1:13 Parallel must be a number")},
 	},
+	{
+		program: "set RetryConnect 1s\n",
+		errors:  []error{fmt.Errorf("line 1:17 RetryConnect must be a number")},
+	},
+	{
+		program: "set RetryBackoff 3\n",
+		errors:  []error{fmt.Errorf("line 1:17 RetryBackoff must be a duration")},
+	},
+	{
+		program: "set BatchSize true\n",
+		errors:  []error{fmt.Errorf("line 1:14 BatchSize must be a number or a percentage")},
+	},
+	{
+		program: "set MaxFailures \"lots\"\n",
+		errors:  []error{fmt.Errorf("line 1:16 Invalid count or percentage: lots")},
+	},
 	{
 		program: "set Timestamp 23\n",
 		errors:  []error{fmt.Errorf("line 1:14 Timestamp must be a boolean")},
@@ -132,7 +190,7 @@ var testcases = []testcase{
 	},
 	{
 		program: "set Output \"foo\"\n",
-		errors:  []error{fmt.Errorf("line 1:11 Unknown output mode: foo. Known modes: all, per-host, inline, tail")},
+		errors:  []error{fmt.Errorf("line 1:11 Unknown output mode: foo. Known modes: all, per-host, inline, tail, grouped, diff, dashboard")},
 	},
 	{
 		program: "set LogLevel nil\n",
@@ -150,6 +208,21 @@ var testcases = []testcase{
 		program: "set timeout 10s\n",
 		errors:  []error{fmt.Errorf("line 1:4 Unknown variable: timeout")},
 	},
+	{
+		program: "push \"motd\" \"/etc/motd\"\npull \"/var/log/syslog\" \"logs\"\n",
+		commands: []command{
+			pushCommand{src: "motd", dst: "/etc/motd"},
+			pullCommand{src: "/var/log/syslog", dst: "logs"},
+		},
+	},
+	{
+		program: "push \"motd\" \"\"\n",
+		errors:  []error{fmt.Errorf("line 1:12 no destination specified")},
+	},
+	{
+		program: "pull \"/etc/motd\"\n",
+		errors:  []error{fmt.Errorf("line 1:16 missing STRING at '\\n'")},
+	},
 }
 
 func TestScripts(t *testing.T) {
@@ -170,3 +243,15 @@ func TestScripts(t *testing.T) {
 		}
 	}
 }
+
+func TestSetCommandString(t *testing.T) {
+	tests := map[string]setCommand{
+		"set BatchSize 10":   {variable: "BatchSize", value: countOrPercentage{count: 10}},
+		"set MaxFailures 5%": {variable: "MaxFailures", value: countOrPercentage{count: 5, percentage: true}},
+	}
+	for expected, c := range tests {
+		if s := c.String(); s != expected {
+			t.Errorf("Expected %q, got %q", expected, s)
+		}
+	}
+}
@@ -20,6 +20,7 @@ type agentPool struct {
 	agents        []sshagent.ExtendedAgent
 	signers       []ssh.Signer
 	signersByPath map[string][]ssh.Signer
+	certSigners   map[string]certSigner
 	current       int
 }
 
@@ -43,6 +44,7 @@ func newAgentPool(agentCount int, agentTimeout time.Duration) (*agentPool, error
 		agents:        make([]sshagent.ExtendedAgent, agentCount),
 		signers:       make([]ssh.Signer, len(signers)),
 		signersByPath: make(map[string][]ssh.Signer),
+		certSigners:   make(map[string]certSigner),
 	}
 	for i, s := range signers {
 		pool.signers[i] = &signer{pool, s.PublicKey()}
@@ -133,31 +135,53 @@ func (ap *agentPool) SignersForPath(path string) []ssh.Signer {
 	}
 	ap.lock.Lock()
 	defer ap.lock.Unlock()
+	// ssh-add adds certificates with the same comment as their key, so we
+	// may find more than one signer
+	signers := []ssh.Signer{}
 	for _, signer := range ap.signers {
 		if signer.PublicKey().(*sshagent.Key).Comment == path {
-			ap.signersByPath[path] = []ssh.Signer{signer}
-			return []ssh.Signer{signer}
+			signers = append(signers, signer)
 		}
 	}
+	if len(signers) != 0 {
+		ap.signersByPath[path] = signers
+		return signers
+	}
 
 	// If we didn't find the key, try again by parsing the public key and matching by key data
-	ap.signersByPath[path] = []ssh.Signer{}
+	ap.signersByPath[path] = signers
 	data, err := os.ReadFile(path + ".pub")
 	if err != nil {
-		return []ssh.Signer{}
+		return signers
 	}
 	key, _, _, _, err := ssh.ParseAuthorizedKey(data) //nolint:dogsled // Can't help it that we don't need the rest
 	if err != nil {
-		return []ssh.Signer{}
+		return signers
 	}
 	mkey := key.Marshal()
 	for _, signer := range ap.signers {
-		if bytes.Equal(signer.PublicKey().Marshal(), mkey) {
-			ap.signersByPath[path] = []ssh.Signer{signer}
-			return []ssh.Signer{signer}
+		if bytes.Equal(signer.PublicKey().Marshal(), mkey) || bytes.Equal(certifiedKey(signer.PublicKey()), mkey) {
+			signers = append(signers, signer)
 		}
 	}
-	return []ssh.Signer{}
+	ap.signersByPath[path] = signers
+	return signers
+}
+
+// certifiedKey returns the key certified by an agent key that is a
+// certificate, or nil for agent keys that are not certificates
+func certifiedKey(key ssh.PublicKey) []byte {
+	if _, ok := certKeyAlgoNames[key.Type()]; !ok {
+		return nil
+	}
+	cert, err := ssh.ParsePublicKey(key.Marshal())
+	if err != nil {
+		return nil
+	}
+	if cert, ok := cert.(*ssh.Certificate); ok {
+		return cert.Key.Marshal()
+	}
+	return nil
 }
 
 func agentConnection() (io.ReadWriter, error) {
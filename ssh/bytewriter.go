@@ -1,48 +0,0 @@
-package ssh
-
-import (
-	"bytes"
-
-	"github.com/seveas/herd"
-)
-
-type byteWriter interface {
-	Write([]byte) (int, error)
-	Bytes() []byte
-}
-
-type lineWriterBuffer struct {
-	oc      chan herd.OutputLine
-	host    *herd.Host
-	stderr  bool
-	buf     *bytes.Buffer
-	lineBuf []byte
-}
-
-func newLineWriterBuffer(host *herd.Host, stderr bool, oc chan herd.OutputLine) *lineWriterBuffer {
-	return &lineWriterBuffer{
-		buf:     bytes.NewBuffer([]byte{}),
-		lineBuf: []byte{},
-		host:    host,
-		oc:      oc,
-		stderr:  stderr,
-	}
-}
-
-func (buf *lineWriterBuffer) Write(p []byte) (int, error) {
-	n, err := buf.buf.Write(p)
-	buf.lineBuf = bytes.Join([][]byte{buf.lineBuf, p}, []byte{})
-	for {
-		idx := bytes.Index(buf.lineBuf, []byte("\n"))
-		if idx == -1 {
-			break
-		}
-		buf.oc <- herd.OutputLine{Host: buf.host, Data: buf.lineBuf[:idx+1], Stderr: buf.stderr}
-		buf.lineBuf = buf.lineBuf[idx+1:]
-	}
-	return n, err
-}
-
-func (buf *lineWriterBuffer) Bytes() []byte {
-	return buf.buf.Bytes()
-}
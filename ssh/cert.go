@@ -0,0 +1,172 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/seveas/herd"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// A host authority is a CA key from a @cert-authority line in a known_hosts
+// file, trusted to sign host certificates for hosts matching its patterns
+type hostAuthority struct {
+	patterns []string
+	key      ssh.PublicKey
+}
+
+type hostAuthorities struct {
+	authorities []hostAuthority
+	revoked     [][]byte
+}
+
+func loadHostAuthorities(files ...string) (*hostAuthorities, error) {
+	ha := &hostAuthorities{}
+	for _, f := range files {
+		data, err := os.ReadFile(f) // #nosec G304 -- These are the known_hosts files
+		if err != nil {
+			return nil, err
+		}
+		// ParseKnownHosts does not tell us where an invalid line ends, so we
+		// feed it one line at a time to be able to skip those
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			marker, patterns, key, _, _, err := ssh.ParseKnownHosts(line)
+			if err != nil {
+				// Comments and empty lines are io.EOF, other errors will be
+				// reported when loading host keys
+				continue
+			}
+			switch marker {
+			case "cert-authority":
+				ha.authorities = append(ha.authorities, hostAuthority{patterns: patterns, key: key})
+			case "revoked":
+				ha.revoked = append(ha.revoked, key.Marshal())
+			}
+		}
+	}
+	return ha, nil
+}
+
+// IsHostAuthority can be used as a callback in ssh.CertChecker
+func (ha *hostAuthorities) IsHostAuthority(key ssh.PublicKey, address string) bool {
+	address = knownhosts.Normalize(address)
+	mkey := key.Marshal()
+	for _, a := range ha.authorities {
+		if bytes.Equal(a.key.Marshal(), mkey) && matchKnownHostsPatterns(a.patterns, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRevoked can be used as a callback in ssh.CertChecker
+func (ha *hostAuthorities) IsRevoked(cert *ssh.Certificate) bool {
+	for _, k := range ha.revoked {
+		if bytes.Equal(k, cert.Key.Marshal()) || bytes.Equal(k, cert.SignatureKey.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAuthorityFor returns whether any CA is trusted for this address, whether
+// or not it signed the host's certificate
+func (ha *hostAuthorities) hasAuthorityFor(address string) bool {
+	if ha == nil {
+		return false
+	}
+	address = knownhosts.Normalize(address)
+	for _, a := range ha.authorities {
+		if matchKnownHostsPatterns(a.patterns, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Patterns in known_hosts files can contain * and ? wildcards, and can be
+// negated with a !
+func matchKnownHostsPatterns(patterns []string, address string) bool {
+	matched := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		re := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(p)) + "$"
+		if ok, _ := regexp.MatchString(re, address); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// checkHostCertificate verifies a host certificate against the trusted CAs. If
+// no CA is trusted for the host, the certified key is checked as a plain host
+// key.
+func (e *Executor) checkHostCertificate(host *herd.Host, port int, remote net.Addr, cert *ssh.Certificate, c *config) error {
+	address := net.JoinHostPort(host.Name, fmt.Sprintf("%d", port))
+	if !e.authorities.hasAuthorityFor(address) {
+		logrus.Debugf("ssh: no certificate authority for %s, checking host key instead", host.Name)
+		return e.hostKeyCallback(host, port, remote, cert.Key, c)
+	}
+	checker := &ssh.CertChecker{
+		IsHostAuthority: e.authorities.IsHostAuthority,
+		IsRevoked:       e.authorities.IsRevoked,
+	}
+	if err := checker.CheckHostKey(address, remote, cert); err != nil {
+		return fmt.Errorf("ssh: invalid host certificate for %s: %w", host.Name, err)
+	}
+	return nil
+}
+
+// CertSignerForPath returns a signer for the certificate in a file, signing
+// with the agent key the certificate is for. Signers and errors are cached,
+// so every certificate is loaded only once.
+func (ap *agentPool) CertSignerForPath(path string) (ssh.Signer, error) {
+	ap.lock.Lock()
+	defer ap.lock.Unlock()
+	cs, ok := ap.certSigners[path]
+	if !ok {
+		if cs.signer, cs.err = ap.loadCertSigner(path); cs.err != nil {
+			logrus.Warnf("Not using certificate: %s", cs.err)
+		}
+		ap.certSigners[path] = cs
+	}
+	return cs.signer, cs.err
+}
+
+type certSigner struct {
+	signer ssh.Signer
+	err    error
+}
+
+func (ap *agentPool) loadCertSigner(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- The user configured this certificate
+	if err != nil {
+		return nil, err
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data) //nolint:dogsled // Can't help it that we don't need the rest
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse certificate %s: %w", path, err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", path)
+	}
+	mkey := cert.Key.Marshal()
+	for _, signer := range ap.signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), mkey) {
+			return ssh.NewCertSigner(cert, signer)
+		}
+	}
+	return nil, fmt.Errorf("The key for certificate %s was not found in the SSH agent", path)
+}
@@ -0,0 +1,126 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestMatchKnownHostsPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		address  string
+		match    bool
+	}{
+		{[]string{"*.example.com"}, "web-1.example.com", true},
+		{[]string{"*.example.com"}, "[web-1.example.com]:2222", false},
+		{[]string{"[*.example.com]:*"}, "[web-1.example.com]:2222", true},
+		{[]string{"web-?.example.com"}, "web-10.example.com", false},
+		{[]string{"*.example.com", "!db-*"}, "db-1.example.com", false},
+		{[]string{"web-1.example.com", "web-2.example.com"}, "web-2.example.com", true},
+		{[]string{"!web-1.example.com"}, "web-2.example.com", false},
+	}
+	for _, test := range tests {
+		if m := matchKnownHostsPatterns(test.patterns, test.address); m != test.match {
+			t.Errorf("Expected %v when matching %s against %v, got %v", test.match, test.address, test.patterns, m)
+		}
+	}
+}
+
+func TestHostAuthorities(t *testing.T) {
+	keys := make([]ssh.PublicKey, 3)
+	lines := make([]string, 3)
+	for i := range keys {
+		pub, _, _ := ed25519.GenerateKey(rand.Reader)
+		keys[i], _ = ssh.NewPublicKey(pub)
+		lines[i] = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(keys[i])))
+	}
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	data := "web-0.example.com ssh-ed25519 invalid\n" +
+		"@cert-authority *.example.com " + lines[0] + "\n" +
+		"# A comment\n" +
+		"@revoked * " + lines[1] + "\n" +
+		"web-1.example.com " + lines[2] + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ha, err := loadHostAuthorities(path)
+	if err != nil {
+		t.Fatalf("Unable to load authorities: %s", err)
+	}
+	if !ha.IsHostAuthority(keys[0], "web-1.example.com:22") || !ha.hasAuthorityFor("web-1.example.com:22") {
+		t.Errorf("Expected the first key to be an authority for web-1.example.com")
+	}
+	if ha.IsHostAuthority(keys[0], "web-1.example.org:22") || ha.hasAuthorityFor("web-1.example.org:22") {
+		t.Errorf("Did not expect an authority for web-1.example.org")
+	}
+	if ha.IsHostAuthority(keys[2], "web-1.example.com:22") {
+		t.Errorf("Did not expect a host key to be an authority")
+	}
+	if !ha.IsRevoked(&ssh.Certificate{Key: keys[1], SignatureKey: keys[0]}) || ha.IsRevoked(&ssh.Certificate{Key: keys[2], SignatureKey: keys[0]}) {
+		t.Errorf("Revoked keys not detected correctly")
+	}
+}
+
+func TestCertSignerForPath(t *testing.T) {
+	newSigner := func() ssh.Signer {
+		_, priv, _ := ed25519.GenerateKey(rand.Reader)
+		signer, _ := ssh.NewSignerFromKey(priv)
+		return signer
+	}
+	ca, agentKey, otherKey := newSigner(), newSigner(), newSigner()
+	dir := t.TempDir()
+	writeCert := func(name string, key ssh.PublicKey) string {
+		t.Helper()
+		cert := &ssh.Certificate{Key: key, CertType: ssh.UserCert, ValidPrincipals: []string{"herd"}, ValidBefore: ssh.CertTimeInfinity}
+		if err := cert.SignCert(rand.Reader, ca); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, ssh.MarshalAuthorizedKey(cert), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	good := writeCert("good-cert.pub", agentKey.PublicKey())
+	other := writeCert("other-cert.pub", otherKey.PublicKey())
+	plain := filepath.Join(dir, "plain.pub")
+	if err := os.WriteFile(plain, ssh.MarshalAuthorizedKey(agentKey.PublicKey()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing-cert.pub")
+
+	ap := &agentPool{signers: []ssh.Signer{agentKey}, certSigners: make(map[string]certSigner)}
+	signer, err := ap.CertSignerForPath(good)
+	if err != nil {
+		t.Fatalf("Unable to load certificate: %s", err)
+	}
+	if cert, ok := signer.PublicKey().(*ssh.Certificate); !ok || !bytes.Equal(cert.Key.Marshal(), agentKey.PublicKey().Marshal()) {
+		t.Errorf("Expected a certificate signer for the agent key, got %v", signer.PublicKey())
+	}
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{other, "was not found in the SSH agent"},
+		{plain, "is not a certificate"},
+		{missing, "no such file or directory"},
+	}
+	for _, test := range tests {
+		if _, err := ap.CertSignerForPath(test.path); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected error containing %q for %s, got %v", test.err, test.path, err)
+		}
+	}
+
+	// Results are cached, so creating the file afterwards does not help
+	writeCert("missing-cert.pub", agentKey.PublicKey())
+	if _, err := ap.CertSignerForPath(missing); err == nil {
+		t.Errorf("Expected the error for %s to be cached", missing)
+	}
+}
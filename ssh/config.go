@@ -32,6 +32,9 @@ type config struct {
 	strictHostKeyChecking strictHostKeyChecking
 	verifyHostKeyDns      bool
 	identityFile          string
+	certificateFile       string
+	proxyJump             []jump
+	proxyCommand          string
 	clientConfig          *ssh.ClientConfig
 }
 
@@ -85,6 +88,19 @@ func configForHost(host *herd.Host, user *user.User) (*config, error) {
 			c.identityFile = path
 		}
 	}
+	// Set certificate file, defaulting to the certificate next to the identity
+	// file, like openssh does
+	if cf := ssh_config.Get(host.Name, "certificatefile"); cf != "" {
+		if path, err := expandSshTokens(cf, host, user, c); err != nil {
+			return nil, err
+		} else if _, err = os.Stat(path); err == nil {
+			c.certificateFile = path
+		}
+	} else if c.identityFile != "" {
+		if _, err := os.Stat(c.identityFile + "-cert.pub"); err == nil {
+			c.certificateFile = c.identityFile + "-cert.pub"
+		}
+	}
 	port := ssh_config.Get(host.Name, "port")
 	if port != "" {
 		if porti, err := strconv.Atoi(port); err != nil {
@@ -93,6 +109,34 @@ func configForHost(host *herd.Host, user *user.User) (*config, error) {
 			c.port = porti
 		}
 	}
+	// Jump hosts can be set in ssh_config, or per host with the ssh_jump
+	// attribute, which is either a ProxyJump string or a list of hops
+	jumpSpec := ssh_config.Get(host.Name, "proxyjump")
+	switch v := host.Attributes["ssh_jump"].(type) {
+	case string:
+		jumpSpec = v
+	case []string:
+		jumpSpec = strings.Join(v, ",")
+	case []any:
+		hops := make([]string, 0, len(v))
+		for _, hop := range v {
+			hops = append(hops, fmt.Sprintf("%v", hop))
+		}
+		jumpSpec = strings.Join(hops, ",")
+	}
+	if jumpSpec != "" && jumpSpec != "none" {
+		var err error
+		if c.proxyJump, err = parseProxyJump(jumpSpec); err != nil {
+			return nil, err
+		}
+	}
+	// ProxyCommand is only used when no ProxyJump is set
+	if pc := ssh_config.Get(host.Name, "proxycommand"); pc != "" && pc != "none" && c.proxyJump == nil {
+		var err error
+		if c.proxyCommand, err = expandSshTokens(pc, host, user, c); err != nil {
+			return nil, err
+		}
+	}
 	c.verifyHostKeyDns = ssh_config.Get(host.Name, "verifyhostkeydns") == "yes"
 	switch strings.ToLower(ssh_config.Get(host.Name, "stricthostkeychecking")) {
 	case "yes":
@@ -122,7 +166,7 @@ func expandSshTokens(input string, host *herd.Host, user *user.User, c *config)
 	var err error
 	re := regexp.MustCompile("%[%CdhikLlnprTu]")
 	output := re.ReplaceAllStringFunc(input, func(token string) string {
-		switch token {
+		switch token[1:] {
 		case "%":
 			return "%"
 		case "C":
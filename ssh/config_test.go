@@ -0,0 +1,34 @@
+package ssh
+
+import (
+	"os/user"
+	"testing"
+
+	"github.com/seveas/herd"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestExpandSshTokens(t *testing.T) {
+	host := herd.NewHost("web-1.example.com", "", herd.HostAttributes{})
+	u := &user.User{Username: "seveas", HomeDir: "/home/seveas", Uid: "1000"}
+	c := &config{port: 2222, clientConfig: &ssh.ClientConfig{User: "admin"}}
+	tests := []struct {
+		input  string
+		output string
+		err    bool
+	}{
+		{"~/.ssh/id_ed25519", "/home/seveas/.ssh/id_ed25519", false},
+		{"aws ssm start-session --target %h --parameters portNumber=%p", "aws ssm start-session --target web-1.example.com --parameters portNumber=2222", false},
+		{"%d/.ssh/%r@%n-%i %%", "/home/seveas/.ssh/admin@web-1.example.com-1000 %", false},
+		{"%C", "", true},
+	}
+	for _, test := range tests {
+		output, err := expandSshTokens(test.input, host, u, c)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error status: %v", test.input, err)
+		} else if !test.err && output != test.output {
+			t.Errorf("%s: expected %q, got %q", test.input, test.output, output)
+		}
+	}
+}
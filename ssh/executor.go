@@ -5,11 +5,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/seveas/herd"
@@ -19,12 +21,22 @@ import (
 	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+type byteWriter interface {
+	io.Writer
+	Bytes() []byte
+}
+
 type Executor struct {
 	agent          *agentPool
+	jumps          *jumpPool
 	knownHosts     ssh.HostKeyCallback
+	authorities    *hostAuthorities
 	user           user.User
 	connectTimeout time.Duration
 	disconnect     bool
+	sudoPassword   []byte
+	sudoPrompt     []byte
+	sudoReady      []byte
 }
 
 func NewExecutor(agentCount int, agentTimeout time.Duration, user user.User, disconnect bool) (herd.Executor, error) {
@@ -48,12 +60,18 @@ func NewExecutor(agentCount int, agentTimeout time.Duration, user user.User, dis
 	if err != nil {
 		return nil, err
 	}
+	authorities, err := loadHostAuthorities(files...)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Executor{
-		agent:      agent,
-		user:       user,
-		knownHosts: knownHosts,
-		disconnect: disconnect,
+		agent:       agent,
+		jumps:       newJumpPool(),
+		user:        user,
+		knownHosts:  knownHosts,
+		authorities: authorities,
+		disconnect:  disconnect,
 	}, nil
 }
 
@@ -62,6 +80,10 @@ func (e *Executor) SetConnectTimeout(t time.Duration) {
 }
 
 func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	return e.RunWithStdin(ctx, host, command, nil, oc)
+}
+
+func (e *Executor) RunWithStdin(ctx context.Context, host *herd.Host, command string, stdin io.Reader, oc chan herd.OutputLine) *herd.Result {
 	now := time.Now()
 	r := &herd.Result{Host: host.Name, StartTime: now, EndTime: now, ElapsedTime: 0, ExitStatus: -1}
 	defer func() {
@@ -87,15 +109,31 @@ func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc
 
 	var stdout, stderr byteWriter
 	if oc != nil {
-		stdout = newLineWriterBuffer(host, false, oc)
-		stderr = newLineWriterBuffer(host, true, oc)
+		stdout = herd.NewLineWriterBuffer(host, false, oc, e.redactLine)
+		stderr = herd.NewLineWriterBuffer(host, true, oc, e.redactLine)
 	} else {
 		stdout = bytes.NewBuffer([]byte{})
 		stderr = bytes.NewBuffer([]byte{})
 	}
 
+	var sudo *sudoWriter
+	if e.sudoPassword != nil {
+		pipe, err := sess.StdinPipe()
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		sudo = e.newSudoWriter(stderr, pipe, stdin)
+		command = e.sudoCommand(command)
+	} else if stdin != nil {
+		sess.Stdin = stdin
+	}
+
 	sess.Stdout = stdout
 	sess.Stderr = stderr
+	if sudo != nil {
+		sess.Stderr = sudo
+	}
 	ec := make(chan error)
 
 	go func() {
@@ -108,7 +146,7 @@ func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc
 		if err := sess.Signal(ssh.SIGKILL); err != nil {
 			terr.Message = fmt.Sprintf("%s, and killing the session failed: %s", terr.Message, err)
 		}
-		r.Err = terr
+		r.Err = herd.ClassifiedError{Class: herd.SessionTimeout, Err: terr}
 	case err := <-ec:
 		r.Err = err
 	}
@@ -123,8 +161,11 @@ func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc
 		_ = connection.Close()
 		host.Connection = nil
 	}
-	r.Stdout = stdout.Bytes()
-	r.Stderr = stderr.Bytes()
+	if sudo != nil {
+		sudo.Flush()
+	}
+	r.Stdout = e.redact(stdout.Bytes())
+	r.Stderr = e.redact(stderr.Bytes())
 	return r
 }
 
@@ -136,17 +177,7 @@ func (e *Executor) connect(ctx context.Context, host *herd.Host) (*ssh.Client, e
 	if err != nil {
 		return nil, err
 	}
-	cc := config.clientConfig
-	cc.Timeout = e.connectTimeout
-	cc.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		return e.hostKeyCallback(host, config.port, remote, key, config)
-	}
-	if config.identityFile != "" {
-		cc.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(e.agent.SignersForPathCallback(config.identityFile))}
-	} else {
-		cc.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(e.agent.Signers)}
-	}
-	cc.Auth = append(cc.Auth, ssh.KeyboardInteractive(e.emptyPasswordCallback))
+	cc := e.clientConfig(host, config)
 	address := host.Address
 	if address == "" {
 		address = host.Name
@@ -160,21 +191,70 @@ func (e *Executor) connect(ctx context.Context, host *herd.Host) (*ssh.Client, e
 	ec := make(chan error)
 	go func() {
 		var err error
-		client, err = ssh.Dial("tcp", address, cc)
+		client, err = e.dial(ctx, address, cc, config.proxyJump, config.proxyCommand)
 		ec <- err
 	}()
 	select {
 	case <-ctx.Done():
-		return nil, herd.TimeoutError{Message: "Timed out while connecting to server"}
+		return nil, herd.ClassifiedError{Class: herd.ConnectError, Err: herd.TimeoutError{Message: "Timed out while connecting to server"}}
 	case err := <-ec:
 		if err == nil {
 			host.Connection = client
 		}
-		return client, err
+		return client, classifyConnectError(err)
+	}
+}
+
+func (e *Executor) clientConfig(host *herd.Host, config *config) *ssh.ClientConfig {
+	cc := config.clientConfig
+	cc.Timeout = e.connectTimeout
+	cc.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return e.hostKeyCallback(host, config.port, remote, key, config)
+	}
+	signers := e.agent.Signers
+	if config.identityFile != "" {
+		signers = e.agent.SignersForPathCallback(config.identityFile)
+	}
+	if config.certificateFile != "" {
+		// The certificate is tried first, the keys themselves can still be
+		// used if the host does not accept it
+		keySigners := signers
+		signers = func() ([]ssh.Signer, error) {
+			s, err := keySigners()
+			cert, cerr := e.agent.CertSignerForPath(config.certificateFile)
+			if cerr != nil {
+				return s, err
+			}
+			return append([]ssh.Signer{cert}, s...), nil
+		}
+	}
+	cc.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(signers)}
+	cc.Auth = append(cc.Auth, ssh.KeyboardInteractive(e.emptyPasswordCallback))
+	return cc
+}
+
+// Network errors and authentication failures may be temporary, so we mark
+// them as such. Other errors, like host key mismatches, are not.
+func classifyConnectError(err error) error {
+	var oerr *net.OpError
+	var cerr *ssh.OpenChannelError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &oerr), errors.As(err, &cerr), errors.Is(err, io.EOF):
+		return herd.ClassifiedError{Class: herd.ConnectError, Err: err}
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		return herd.ClassifiedError{Class: herd.AuthError, Err: err}
+	default:
+		return err
 	}
 }
 
 func (e *Executor) hostKeyCallback(host *herd.Host, port int, remote net.Addr, key ssh.PublicKey, c *config) error {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return e.checkHostCertificate(host, port, remote, cert, c)
+	}
+
 	// Do we have the key?
 	bkey := key.Marshal()
 	for _, pkey := range host.PublicKeys() {
@@ -183,10 +263,20 @@ func (e *Executor) hostKeyCallback(host *herd.Host, port int, remote net.Addr, k
 		}
 	}
 
-	// We don't have the key, but is it in DNS?
-	if c.verifyHostKeyDns && verifyHostKeyDns(host.Name, key) {
-		host.AddPublicKey(key)
-		return nil
+	// We don't have the key, but is it in DNS? Fingerprints that a provider
+	// found in DNS are trusted just like ones we look up ourselves, so only
+	// when VerifyHostKeyDNS is enabled.
+	if c.verifyHostKeyDns {
+		for _, fp := range host.SSHFPs() {
+			if matchSshfp(fp, key) {
+				host.AddPublicKey(key)
+				return nil
+			}
+		}
+		if verifyHostKeyDns(host.Name, key) {
+			host.AddPublicKey(key)
+			return nil
+		}
 	}
 
 	// We don't have a key, but is it in known_hosts?
@@ -231,4 +321,7 @@ func (e *Executor) emptyPasswordCallback(name, instruction string, questions []s
 	return make([]string, len(questions)), fmt.Errorf("keyboard-interactive authentication not supported")
 }
 
-var _ herd.Executor = &Executor{}
+var (
+	_ herd.Executor    = &Executor{}
+	_ herd.StdinRunner = &Executor{}
+)
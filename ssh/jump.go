@@ -0,0 +1,192 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// A jump is one hop in a ProxyJump chain
+type jump struct {
+	user string
+	host string
+	port int
+}
+
+func (j jump) String() string {
+	s := j.host
+	if j.port != 0 {
+		s = net.JoinHostPort(s, strconv.Itoa(j.port))
+	}
+	if j.user != "" {
+		s = j.user + "@" + s
+	}
+	return s
+}
+
+// parseProxyJump parses a ProxyJump specification: a comma separated list of
+// [user@]host[:port] hops, which are connected to in order.
+func parseProxyJump(spec string) ([]jump, error) {
+	jumps := []jump{}
+	for _, hop := range strings.Split(spec, ",") {
+		hop = strings.TrimPrefix(strings.TrimSpace(hop), "ssh://")
+		j := jump{}
+		if i := strings.LastIndex(hop, "@"); i != -1 {
+			j.user, hop = hop[:i], hop[i+1:]
+		}
+		j.host = hop
+		if host, port, err := net.SplitHostPort(hop); err == nil {
+			j.host = host
+			if j.port, err = strconv.Atoi(port); err != nil {
+				return nil, fmt.Errorf("Invalid port number in ProxyJump %s: %s", spec, port)
+			}
+		}
+		if j.host == "" {
+			return nil, fmt.Errorf("Invalid ProxyJump: %s", spec)
+		}
+		jumps = append(jumps, j)
+	}
+	return jumps, nil
+}
+
+// The jump pool keeps one connection to every jump host (or chain of jump
+// hosts), shared by all connections tunneled through it. Connections are only
+// removed from the pool when they fail.
+type jumpPool struct {
+	lock    sync.Mutex
+	clients map[string]*jumpClient
+}
+
+type jumpClient struct {
+	ready  chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+func newJumpPool() *jumpPool {
+	return &jumpPool{clients: make(map[string]*jumpClient)}
+}
+
+func (p *jumpPool) remove(key string, jc *jumpClient) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.clients[key] == jc {
+		delete(p.clients, key)
+	}
+}
+
+// jumpClient returns a connection to the last host in the chain, tunneled
+// through all hosts before it. Only the first caller for a chain connects,
+// all others wait for that connection.
+func (e *Executor) jumpClient(ctx context.Context, jumps []jump) (*ssh.Client, error) {
+	hops := make([]string, len(jumps))
+	for i, j := range jumps {
+		hops[i] = j.String()
+	}
+	key := strings.Join(hops, ",")
+
+	e.jumps.lock.Lock()
+	jc, ok := e.jumps.clients[key]
+	if !ok {
+		jc = &jumpClient{ready: make(chan struct{})}
+		e.jumps.clients[key] = jc
+		// The connection is shared, so we don't tie it to the context of
+		// whoever happens to connect first.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), e.connectTimeout+time.Second/2)
+			defer cancel()
+			jc.client, jc.err = e.connectJump(ctx, jumps)
+			close(jc.ready)
+			if jc.err != nil {
+				e.jumps.remove(key, jc)
+				return
+			}
+			_ = jc.client.Wait()
+			logrus.Debugf("Connection to jump host %s closed", key)
+			e.jumps.remove(key, jc)
+		}()
+	}
+	e.jumps.lock.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, herd.ClassifiedError{Class: herd.ConnectError, Err: herd.TimeoutError{Message: "Timed out while connecting to jump host " + key}}
+	case <-jc.ready:
+		if jc.err != nil {
+			return nil, fmt.Errorf("Unable to connect to jump host %s: %w", key, jc.err)
+		}
+		return jc.client, nil
+	}
+}
+
+func (e *Executor) connectJump(ctx context.Context, jumps []jump) (*ssh.Client, error) {
+	j := jumps[len(jumps)-1]
+	host := herd.NewHost(j.host, "", herd.HostAttributes{})
+	config, err := configForHost(host, &e.user)
+	if err != nil {
+		return nil, err
+	}
+	if j.user != "" {
+		config.clientConfig.User = j.user
+	}
+	if j.port != 0 {
+		config.port = j.port
+	}
+	cc := e.clientConfig(host, config)
+	address := net.JoinHostPort(j.host, strconv.Itoa(config.port))
+	logrus.Debugf("Connecting to jump host %s (%s) as %s with key %s", j.host, address, cc.User, config.identityFile)
+	return e.dial(ctx, address, cc, jumps[:len(jumps)-1], config.proxyCommand)
+}
+
+// dial connects to an address, either directly, through a chain of jump hosts
+// or through a ProxyCommand
+func (e *Executor) dial(ctx context.Context, address string, cc *ssh.ClientConfig, jumps []jump, proxyCommand string) (*ssh.Client, error) {
+	if len(jumps) == 0 && proxyCommand == "" {
+		return ssh.Dial("tcp", address, cc)
+	}
+	if len(jumps) == 0 {
+		conn, err := dialProxyCommand(proxyCommand)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newClient(ctx, conn, address, cc)
+		if err != nil {
+			return nil, conn.wrapError(err)
+		}
+		return client, nil
+	}
+	via, err := e.jumpClient(ctx, jumps)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := via.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(ctx, conn, address, cc)
+}
+
+// newClient sets up an ssh connection over an existing connection, closing
+// that connection if the context expires before the ssh handshake is done
+func newClient(ctx context.Context, conn net.Conn, address string, cc *ssh.ClientConfig) (*ssh.Client, error) {
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, address, cc)
+	if !stop() && err == nil {
+		_ = c.Close()
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
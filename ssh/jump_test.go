@@ -0,0 +1,33 @@
+package ssh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProxyJump(t *testing.T) {
+	tests := []struct {
+		spec  string
+		jumps []jump
+		err   bool
+	}{
+		{"bastion", []jump{{host: "bastion"}}, false},
+		{"admin@bastion:2222", []jump{{user: "admin", host: "bastion", port: 2222}}, false},
+		{"ssh://bastion-1, admin@[2001:db8::1]:22", []jump{{host: "bastion-1"}, {user: "admin", host: "2001:db8::1", port: 22}}, false},
+		{"bastion:ssh", nil, true},
+		{"admin@", nil, true},
+	}
+	for _, test := range tests {
+		jumps, err := parseProxyJump(test.spec)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error status: %v", test.spec, err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(jumps, test.jumps) {
+			t.Errorf("%s: expected %v, got %v", test.spec, test.jumps, jumps)
+		}
+	}
+	if s := (jump{user: "admin", host: "2001:db8::1", port: 22}).String(); s != "admin@[2001:db8::1]:22" {
+		t.Errorf("Unexpected string representation: %s", s)
+	}
+}
@@ -73,7 +73,20 @@ func (e *KeyScanExecutor) Run(ctx context.Context, host *herd.Host, cmd string,
 		cancel()
 	}()
 	<-ctx.Done()
-	return &herd.Result{Host: host.Name}
+	// Report the keys in known_hosts format, for those who want them as output
+	r := &herd.Result{Host: host.Name}
+	names := host.Name
+	if host.Address != "" {
+		names += "," + host.Address
+	}
+	for _, key := range host.PublicKeys() {
+		line := append([]byte(names+" "), ssh.MarshalAuthorizedKey(key)...)
+		r.Stdout = append(r.Stdout, line...)
+		if oc != nil {
+			oc <- herd.OutputLine{Host: host, Data: line}
+		}
+	}
+	return r
 }
 
 func (e *KeyScanExecutor) Disconnect() {
@@ -0,0 +1,81 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// proxyConn is a connection over the stdin and stdout of a ProxyCommand
+type proxyConn struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	stderr  *bytes.Buffer
+	command string
+	once    sync.Once
+}
+
+type proxyAddr string
+
+func (a proxyAddr) Network() string { return "proxy" }
+func (a proxyAddr) String() string  { return string(a) }
+
+func dialProxyCommand(command string) (*proxyConn, error) {
+	cmd := proxyCommand(command)
+	c := &proxyConn{cmd: cmd, command: command, stderr: &bytes.Buffer{}}
+	var err error
+	if c.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if c.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	cmd.Stderr = c.stderr
+	logrus.Debugf("Starting ProxyCommand %s", command)
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Unable to start ProxyCommand %s: %w", command, err)
+	}
+	return c, nil
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *proxyConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close stops the proxy command, it is not expected to exit by itself
+func (c *proxyConn) Close() error {
+	c.once.Do(func() {
+		_ = c.stdin.Close()
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	})
+	return nil
+}
+
+// wrapError adds the proxy command's error output, if any, to an error
+func (c *proxyConn) wrapError(err error) error {
+	if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+		return fmt.Errorf("%w (ProxyCommand output: %s)", err, msg)
+	}
+	return err
+}
+
+func (c *proxyConn) LocalAddr() net.Addr                { return proxyAddr("local") }
+func (c *proxyConn) RemoteAddr() net.Addr               { return proxyAddr(c.command) }
+func (c *proxyConn) SetDeadline(t time.Time) error      { return nil }
+func (c *proxyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *proxyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+var _ net.Conn = &proxyConn{}
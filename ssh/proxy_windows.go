@@ -0,0 +1,7 @@
+package ssh
+
+import "os/exec"
+
+func proxyCommand(command string) *exec.Cmd {
+	return exec.Command("cmd.exe", "/c", command) // #nosec G204 -- The user configured this command
+}
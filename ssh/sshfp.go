@@ -5,6 +5,9 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"net"
+	"strings"
+
+	"github.com/seveas/herd"
 
 	"github.com/miekg/dns"
 	"golang.org/x/crypto/ssh"
@@ -55,29 +58,32 @@ func verifyHostKeyDns(hostname string, key ssh.PublicKey) bool {
 	if sshfpResolver == nil {
 		return false
 	}
-	algo, ok := sshfpAlgorithms[key.Type()]
-	if !ok {
-		return false
-	}
-	blob := key.Marshal()
-	sha1sum := fmt.Sprintf("%x", sha1.Sum(blob)) // #nosec:G401 -- We want to support sha1 fingerprints for now
-	sha256sum := fmt.Sprintf("%x", sha256.Sum256(blob))
-
 	rrset, err := sshfpResolver.resolve(hostname+".", dns.TypeSSHFP)
 	if err != nil {
 		return false
 	}
 	for _, rr := range rrset {
 		if srr, ok := rr.(*dns.SSHFP); ok {
-			if srr.Algorithm == algo {
-				if srr.Type == dns.SHA1 && srr.FingerPrint == sha1sum {
-					return true
-				}
-				if srr.Type == dns.SHA256 && srr.FingerPrint == sha256sum {
-					return true
-				}
+			if matchSshfp(herd.SSHFP{Algorithm: srr.Algorithm, Type: srr.Type, Fingerprint: srr.FingerPrint}, key) {
+				return true
 			}
 		}
 	}
 	return false
 }
+
+// matchSshfp checks whether a key matches an sshfp record
+func matchSshfp(fp herd.SSHFP, key ssh.PublicKey) bool {
+	algo, ok := sshfpAlgorithms[key.Type()]
+	if !ok || fp.Algorithm != algo {
+		return false
+	}
+	blob := key.Marshal()
+	switch fp.Type {
+	case dns.SHA1:
+		return strings.EqualFold(fp.Fingerprint, fmt.Sprintf("%x", sha1.Sum(blob))) // #nosec:G401 -- We want to support sha1 fingerprints for now
+	case dns.SHA256:
+		return strings.EqualFold(fp.Fingerprint, fmt.Sprintf("%x", sha256.Sum256(blob)))
+	}
+	return false
+}
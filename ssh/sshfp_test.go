@@ -0,0 +1,63 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/sha1" // #nosec G505 -- Testing sha1 fingerprints
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/seveas/herd"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestMatchSshfp(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(key.Marshal())) // #nosec G401 -- Testing sha1 fingerprints
+	sha256sum := fmt.Sprintf("%x", sha256.Sum256(key.Marshal()))
+	tests := []struct {
+		fp    herd.SSHFP
+		match bool
+	}{
+		{herd.SSHFP{Algorithm: 4, Type: 1, Fingerprint: sha1sum}, true},
+		{herd.SSHFP{Algorithm: 4, Type: 2, Fingerprint: sha256sum}, true},
+		{herd.SSHFP{Algorithm: 4, Type: 2, Fingerprint: strings.ToUpper(sha256sum)}, true},
+		{herd.SSHFP{Algorithm: 1, Type: 2, Fingerprint: sha256sum}, false},
+		{herd.SSHFP{Algorithm: 4, Type: 1, Fingerprint: sha256sum}, false},
+		{herd.SSHFP{Algorithm: 4, Type: 3, Fingerprint: sha256sum}, false},
+	}
+	for _, test := range tests {
+		if matchSshfp(test.fp, key) != test.match {
+			t.Errorf("%s: expected match to be %v", test.fp, test.match)
+		}
+	}
+}
+
+func TestHostKeyCallbackSshfp(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Executor{knownHosts: func(string, net.Addr, ssh.PublicKey) error { return errors.New("unknown key") }}
+	for _, verify := range []bool{false, true} {
+		host := herd.NewHost("web-01.example.com", "", herd.HostAttributes{})
+		host.AddSSHFP(herd.SSHFP{Algorithm: 4, Type: 2, Fingerprint: fmt.Sprintf("%x", sha256.Sum256(key.Marshal()))})
+		c := &config{strictHostKeyChecking: yes, verifyHostKeyDns: verify}
+		err := e.hostKeyCallback(host, 22, nil, key, c)
+		if verify && (err != nil || len(host.PublicKeys()) != 1) {
+			t.Errorf("Expected the key to be accepted with VerifyHostKeyDNS, got %v", err)
+		}
+		if !verify && err == nil {
+			t.Errorf("Expected the key to be rejected without VerifyHostKeyDNS")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+)
+
+// SetSudoPassword turns on become mode: all commands are run via sudo, and
+// the password is sent to sudo when it asks for it.
+func (e *Executor) SetSudoPassword(password []byte) {
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	e.sudoPassword = password
+	e.sudoPrompt = []byte("[herd-sudo-" + hex.EncodeToString(nonce) + "]")
+	e.sudoReady = []byte("[herd-ready-" + hex.EncodeToString(nonce) + "]\n")
+}
+
+// sudoCommand wraps the command in sudo, using a prompt we can recognize and
+// printing a marker once sudo has done its thing, so we know when to stop
+// listening for password prompts.
+func (e *Executor) sudoCommand(command string) string {
+	inner := "echo '" + strings.TrimSuffix(string(e.sudoReady), "\n") + "' >&2; " + command
+	return "sudo -S -p '" + string(e.sudoPrompt) + "' -- sh -c " + shellQuote(inner)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// redact removes the sudo password from command output. The password only
+// ends up in the output when something echoes the input that sudo did not
+// consume, so only lines that consist of nothing but the password are
+// replaced. This way a short or common password can't mangle other output.
+func (e *Executor) redact(data []byte) []byte {
+	if len(e.sudoPassword) == 0 {
+		return data
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = e.redactLine(line)
+	}
+	return bytes.Join(lines, nil)
+}
+
+func (e *Executor) redactLine(line []byte) []byte {
+	if len(e.sudoPassword) == 0 {
+		return line
+	}
+	text := bytes.TrimRight(line, "\r\n")
+	if !bytes.Equal(text, e.sudoPassword) {
+		return line
+	}
+	return append([]byte("********"), line[len(text):]...)
+}
+
+// sudoWriter filters sudo's password prompt and our ready marker from a
+// command's stderr. It answers the first prompt with the password and closes
+// stdin when sudo asks again. When the command has started, it sends the
+// command's own stdin data, if any, and closes stdin. Flush can be called
+// while the session is still writing, so both hold a lock.
+type sudoWriter struct {
+	byteWriter
+	lock     sync.Mutex
+	stdin    io.WriteCloser
+	data     io.Reader
+	password []byte
+	prompt   []byte
+	ready    []byte
+	buf      []byte
+	prompted bool
+	started  bool
+	close    sync.Once
+}
+
+func (e *Executor) newSudoWriter(stderr byteWriter, stdin io.WriteCloser, data io.Reader) *sudoWriter {
+	return &sudoWriter{
+		byteWriter: stderr,
+		stdin:      stdin,
+		data:       data,
+		password:   e.sudoPassword,
+		prompt:     e.sudoPrompt,
+		ready:      e.sudoReady,
+	}
+}
+
+func (w *sudoWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.started {
+		return w.byteWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	for !w.started {
+		pi := bytes.Index(w.buf, w.prompt)
+		ri := bytes.Index(w.buf, w.ready)
+		if pi == -1 && ri == -1 {
+			break
+		}
+		if pi != -1 && (ri == -1 || pi < ri) {
+			if _, err := w.byteWriter.Write(w.buf[:pi]); err != nil {
+				return 0, err
+			}
+			w.buf = w.buf[pi+len(w.prompt):]
+			if w.prompted {
+				// Wrong password, make sudo give up
+				w.closeStdin()
+			} else {
+				w.prompted = true
+				if _, err := w.stdin.Write(append(append([]byte{}, w.password...), '\n')); err != nil {
+					w.closeStdin()
+				}
+			}
+		} else {
+			if _, err := w.byteWriter.Write(w.buf[:ri]); err != nil {
+				return 0, err
+			}
+			w.buf = w.buf[ri+len(w.ready):]
+			w.started = true
+			if w.data == nil {
+				w.closeStdin()
+			} else {
+				go func() {
+					_, _ = io.Copy(w.stdin, w.data)
+					w.closeStdin()
+				}()
+			}
+		}
+	}
+	// Hold back anything that could be the start of a marker
+	keep := 0
+	if !w.started {
+		keep = max(partialSuffix(w.buf, w.prompt), partialSuffix(w.buf, w.ready))
+	}
+	if _, err := w.byteWriter.Write(w.buf[:len(w.buf)-keep]); err != nil {
+		return 0, err
+	}
+	w.buf = w.buf[len(w.buf)-keep:]
+	return len(p), nil
+}
+
+func (w *sudoWriter) closeStdin() {
+	w.close.Do(func() { _ = w.stdin.Close() })
+}
+
+// Flush writes out anything held back, for when the command exits before
+// sudo has started it.
+func (w *sudoWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, _ = w.byteWriter.Write(w.buf)
+	w.buf = nil
+	if !w.started {
+		w.closeStdin()
+	}
+}
+
+// partialSuffix returns the length of the longest suffix of data that is a
+// prefix of marker
+func partialSuffix(data, marker []byte) int {
+	for n := min(len(data), len(marker)-1); n > 0; n-- {
+		if bytes.HasSuffix(data, marker[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+var _ byteWriter = &sudoWriter{}
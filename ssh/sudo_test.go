@@ -0,0 +1,133 @@
+package ssh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/seveas/herd"
+)
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestSudoWriter(t *testing.T) {
+	e := &Executor{}
+	e.SetSudoPassword([]byte("hunter2"))
+	tests := []struct {
+		name   string
+		chunks []string
+		stdin  string
+		stderr string
+	}{
+		{
+			name:   "prompt and start",
+			chunks: []string{"lecture\n" + string(e.sudoPrompt), string(e.sudoReady) + "output\n"},
+			stdin:  "hunter2\n",
+			stderr: "lecture\noutput\n",
+		},
+		{
+			name:   "split markers",
+			chunks: []string{"[herd", string(e.sudoPrompt[5:]) + "[", string(e.sudoReady[1:]), "[not a marker]\n"},
+			stdin:  "hunter2\n",
+			stderr: "[not a marker]\n",
+		},
+		{
+			name:   "no password needed",
+			chunks: []string{string(e.sudoReady), string(e.sudoPrompt)},
+			stderr: string(e.sudoPrompt),
+		},
+		{
+			name:   "wrong password",
+			chunks: []string{string(e.sudoPrompt), "Sorry, try again.\n", string(e.sudoPrompt), "sudo: 1 incorrect password attempt\n"},
+			stdin:  "hunter2\n",
+			stderr: "Sorry, try again.\nsudo: 1 incorrect password attempt\n",
+		},
+	}
+	for _, test := range tests {
+		stdin := &closeBuffer{}
+		stderr := bytes.NewBuffer([]byte{})
+		w := e.newSudoWriter(stderr, stdin, nil)
+		for _, c := range test.chunks {
+			if _, err := w.Write([]byte(c)); err != nil {
+				t.Fatalf("%s: unexpected error: %s", test.name, err)
+			}
+		}
+		w.Flush()
+		if stdin.String() != test.stdin {
+			t.Errorf("%s: expected %q on stdin, got %q", test.name, test.stdin, stdin.String())
+		}
+		if stderr.String() != test.stderr {
+			t.Errorf("%s: expected %q on stderr, got %q", test.name, test.stderr, stderr.String())
+		}
+		if !stdin.closed {
+			t.Errorf("%s: stdin was not closed", test.name)
+		}
+	}
+}
+
+func TestSudoWriterConcurrentFlush(t *testing.T) {
+	e := &Executor{}
+	e.SetSudoPassword([]byte("hunter2"))
+	w := e.newSudoWriter(bytes.NewBuffer([]byte{}), &closeBuffer{}, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			_, _ = w.Write([]byte("[herd"))
+		}
+	}()
+	w.Flush()
+	<-done
+}
+
+func TestSudoCommand(t *testing.T) {
+	e := &Executor{}
+	e.SetSudoPassword([]byte("hunter2"))
+	cmd := e.sudoCommand("echo 'hello world'")
+	want := "sudo -S -p '" + string(e.sudoPrompt) + "' -- sh -c 'echo '\\''" + string(e.sudoReady[:len(e.sudoReady)-1]) + "'\\'' >&2; echo '\\''hello world'\\'''"
+	if cmd != want {
+		t.Errorf("Expected %s, got %s", want, cmd)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	e := &Executor{}
+	e.SetSudoPassword([]byte("hunter2"))
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"hunter2\n", "********\n"},
+		{"before\nhunter2\r\nafter\n", "before\n********\r\nafter\n"},
+		{"hunter2", "********"},
+		// Only whole lines are redacted, so short passwords don't mangle output
+		{"hunter2s are not passwords\n", "hunter2s are not passwords\n"},
+	}
+	for _, test := range tests {
+		if out := e.redact([]byte(test.in)); string(out) != test.out {
+			t.Errorf("Expected %q to be redacted to %q, got %q", test.in, test.out, out)
+		}
+	}
+
+	// Streamed lines are redacted as well
+	oc := make(chan herd.OutputLine, 10)
+	w := herd.NewLineWriterBuffer(herd.NewHost("test-host", "", nil), false, oc, e.redactLine)
+	_, _ = w.Write([]byte("one\nhunt"))
+	_, _ = w.Write([]byte("er2\nthree\n"))
+	close(oc)
+	lines := []string{}
+	for l := range oc {
+		lines = append(lines, string(l.Data))
+	}
+	if strings.Join(lines, "") != "one\n********\nthree\n" {
+		t.Errorf("Streamed output not redacted: %q", lines)
+	}
+}
@@ -0,0 +1,142 @@
+package ssh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"github.com/pkg/sftp"
+)
+
+func (e *Executor) Push(ctx context.Context, host *herd.Host, src, dst string) *herd.Result {
+	return e.transfer(ctx, host, func(client *sftp.Client) (herd.Transfer, error) {
+		t := herd.Transfer{Source: src, Destination: dst}
+		in, err := os.Open(src) // #nosec G304 -- The user explicitly asked for this file to be pushed
+		if err != nil {
+			return t, err
+		}
+		defer in.Close()
+		info, err := in.Stat()
+		if err != nil {
+			return t, err
+		}
+		if info.IsDir() {
+			return t, fmt.Errorf("%s is a directory", src)
+		}
+		if rinfo, err := client.Stat(dst); err == nil && rinfo.IsDir() {
+			t.Destination = path.Join(dst, filepath.Base(src))
+		}
+		out, err := client.Create(t.Destination)
+		if err != nil {
+			return t, fmt.Errorf("unable to create %s: %w", t.Destination, err)
+		}
+		defer out.Close()
+		if err = copyWithChecksum(&t, out, in); err != nil {
+			return t, err
+		}
+		if err = out.Chmod(info.Mode().Perm()); err != nil {
+			return t, err
+		}
+		return t, out.Close()
+	})
+}
+
+func (e *Executor) Pull(ctx context.Context, host *herd.Host, src, dst string) *herd.Result {
+	return e.transfer(ctx, host, func(client *sftp.Client) (herd.Transfer, error) {
+		t := herd.Transfer{Source: src, Destination: dst}
+		in, err := client.Open(src)
+		if err != nil {
+			return t, fmt.Errorf("unable to open %s: %w", src, err)
+		}
+		defer in.Close()
+		if err = os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return t, err
+		}
+		out, err := os.Create(dst) // #nosec G304 -- The user explicitly asked for files to be pulled here
+		if err != nil {
+			return t, err
+		}
+		defer out.Close()
+		if err = copyWithChecksum(&t, out, in); err != nil {
+			return t, err
+		}
+		return t, out.Close()
+	})
+}
+
+func copyWithChecksum(t *herd.Transfer, out io.Writer, in io.Reader) error {
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), in)
+	t.Size = n
+	if err != nil {
+		return err
+	}
+	t.Sha256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// transfer runs a file transfer over an sftp session on the host's connection
+// and turns the outcome into a result, listing the checksum of the transferred
+// file on stdout.
+func (e *Executor) transfer(ctx context.Context, host *herd.Host, f func(*sftp.Client) (herd.Transfer, error)) *herd.Result {
+	now := time.Now()
+	r := &herd.Result{Host: host.Name, StartTime: now, EndTime: now, ElapsedTime: 0, ExitStatus: -1}
+	defer func() {
+		r.EndTime = time.Now()
+		r.ElapsedTime = r.EndTime.Sub(r.StartTime).Seconds()
+	}()
+
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+		return r
+	}
+	connection, err := e.connect(ctx, host)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	client, err := sftp.NewClient(connection)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer client.Close()
+
+	type transferResult struct {
+		transfer herd.Transfer
+		err      error
+	}
+	tc := make(chan transferResult, 1)
+	go func() {
+		t, err := f(client)
+		tc <- transferResult{transfer: t, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		r.Err = herd.ClassifiedError{Class: herd.SessionTimeout, Err: herd.TimeoutError{Message: "Timed out while transferring file"}}
+		_ = client.Close()
+	case tr := <-tc:
+		r.Err = tr.err
+		if tr.err == nil {
+			r.ExitStatus = 0
+			r.Transfers = []herd.Transfer{tr.transfer}
+			r.Stdout = fmt.Appendf(nil, "%s  %s\n", tr.transfer.Sha256, tr.transfer.Destination)
+		}
+	}
+	if e.disconnect {
+		_ = connection.Close()
+		host.Connection = nil
+	}
+	return r
+}
+
+var _ herd.FileTransferer = &Executor{}
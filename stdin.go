@@ -0,0 +1,62 @@
+package herd
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// Data up to this size is kept in memory, anything larger is spooled to disk
+var stdinMemoryLimit int64 = 16 << 20
+
+// Stdin holds data read once from a local stream, so it can be replayed to
+// the commands on all hosts. Small amounts of data are kept in memory, larger
+// amounts are spooled to a temporary file.
+type Stdin struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+func NewStdin(r io.Reader) (*Stdin, error) {
+	buf := bytes.NewBuffer([]byte{})
+	n, err := io.CopyN(buf, r, stdinMemoryLimit+1)
+	if err == io.EOF {
+		return &Stdin{data: buf.Bytes(), size: n}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "herd-stdin-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Stdin{file: file}
+	if s.size, err = io.Copy(file, io.MultiReader(buf, r)); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reader returns a new reader for the data, independent of all other readers
+func (s *Stdin) Reader() io.Reader {
+	if s.file != nil {
+		return io.NewSectionReader(s.file, 0, s.size)
+	}
+	return bytes.NewReader(s.data)
+}
+
+func (s *Stdin) Size() int64 {
+	return s.size
+}
+
+// Close removes the spool file, if any
+func (s *Stdin) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	_ = s.file.Close()
+	return os.Remove(s.file.Name())
+}
@@ -0,0 +1,39 @@
+package herd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestStdin(t *testing.T) {
+	defer func(limit int64) { stdinMemoryLimit = limit }(stdinMemoryLimit)
+	stdinMemoryLimit = 10
+	for _, data := range []string{"", "small", "larger than the memory limit"} {
+		s, err := NewStdin(bytes.NewBufferString(data))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if spooled := s.file != nil; spooled != (len(data) > 10) {
+			t.Errorf("Expected spooling to be %t for %q", !spooled, data)
+		}
+		if s.Size() != int64(len(data)) {
+			t.Errorf("Expected size %d, got %d", len(data), s.Size())
+		}
+		for range 2 {
+			got, err := io.ReadAll(s.Reader())
+			if err != nil || string(got) != data {
+				t.Errorf("Expected %q, got %q (%v)", data, got, err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("Unexpected error closing: %s", err)
+		}
+		if s.file != nil {
+			if _, err := os.Stat(s.file.Name()); !os.IsNotExist(err) {
+				t.Errorf("Spool file %s was not removed", s.file.Name())
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package herd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+var errNoTerminal = errors.New("no terminal available")
+
+// A terminal is a keyboard and screen in raw mode, showing the alternate
+// screen so we leave the scrollback alone. Full-screen views such as the host
+// picker and the dashboard draw on it.
+type terminal struct {
+	in    *os.File
+	out   *os.File
+	tty   *os.File
+	state *term.State
+}
+
+// openTerminal prefers /dev/tty, so output can still be piped elsewhere. If
+// that can't be opened, the given input and output are used, if any.
+func openTerminal(in, out *os.File) (*terminal, error) {
+	t := &terminal{in: in, out: out}
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		t.tty, t.in, t.out = tty, tty, tty
+	}
+	if t.in == nil || t.out == nil || !term.IsTerminal(t.inFd()) || !term.IsTerminal(t.outFd()) {
+		t.closeTty()
+		return nil, errNoTerminal
+	}
+	state, err := term.MakeRaw(t.inFd())
+	if err != nil {
+		t.closeTty()
+		return nil, err
+	}
+	t.state = state
+	_, _ = t.out.WriteString("\033[?1049h")
+	return t, nil
+}
+
+func (t *terminal) inFd() int {
+	return int(t.in.Fd()) // #nosec G115 -- File descriptors fit in an int
+}
+
+func (t *terminal) outFd() int {
+	return int(t.out.Fd()) // #nosec G115 -- File descriptors fit in an int
+}
+
+// size returns the size of the terminal, or the fallback size if the terminal
+// doesn't know its own size
+func (t *terminal) size(width, height int) (int, int) {
+	w, h, err := term.GetSize(t.outFd())
+	if err != nil || w <= 0 || h <= 0 {
+		return width, height
+	}
+	return w, h
+}
+
+func (t *terminal) closeTty() {
+	if t.tty != nil {
+		_ = t.tty.Close()
+	}
+}
+
+// Close switches back to the normal screen and restores the terminal mode
+func (t *terminal) Close() {
+	_, _ = t.out.WriteString("\033[?1049l")
+	_ = term.Restore(t.inFd(), t.state)
+	t.closeTty()
+}
+
+// truncate cuts a string to fit in the given number of columns, assuming
+// every rune takes up one column
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if width == 0 {
+			break
+		}
+		sb.WriteRune(r)
+		width--
+	}
+	return sb.String()
+}
+
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyToggle
+	keyToggleAll
+	keyBackspace
+	keyClear
+	keyAccept
+	keyCancel
+	keyInterrupt
+	keyUnknown
+)
+
+type keyPress struct {
+	key keyCode
+	r   rune
+}
+
+var keyEscapes = map[string]keyCode{
+	"\033[A":  keyUp,
+	"\033OA":  keyUp,
+	"\033[B":  keyDown,
+	"\033OB":  keyDown,
+	"\033[5~": keyPageUp,
+	"\033[6~": keyPageDown,
+	"\033[H":  keyHome,
+	"\033[1~": keyHome,
+	"\033OH":  keyHome,
+	"\033[F":  keyEnd,
+	"\033[4~": keyEnd,
+	"\033OF":  keyEnd,
+}
+
+// parseKeys turns terminal input into key presses. A lone escape is a cancel,
+// other escape sequences we don't know are ignored. As the terminal is in raw
+// mode, ctrl-c arrives as a key press and not as a signal.
+func parseKeys(input []byte) []keyPress {
+	keys := []keyPress{}
+	for len(input) > 0 {
+		if input[0] == '\033' {
+			if len(input) == 1 {
+				keys = append(keys, keyPress{key: keyCancel})
+				break
+			}
+			// Escape sequences end with a letter or a ~
+			end := 2
+			for end < len(input) && !(input[end-1] == '~' || (end > 2 && unicode.IsLetter(rune(input[end-1])))) {
+				end++
+			}
+			key, ok := keyEscapes[string(input[:end])]
+			if !ok {
+				key = keyUnknown
+			}
+			keys = append(keys, keyPress{key: key})
+			input = input[end:]
+			continue
+		}
+		r, size := utf8.DecodeRune(input)
+		input = input[size:]
+		switch r {
+		case '\r', '\n':
+			keys = append(keys, keyPress{key: keyAccept})
+		case '\t':
+			keys = append(keys, keyPress{key: keyToggle})
+		case 0x01: // ^A
+			keys = append(keys, keyPress{key: keyToggleAll})
+		case 0x03: // ^C
+			keys = append(keys, keyPress{key: keyInterrupt})
+		case 0x04: // ^D
+			keys = append(keys, keyPress{key: keyCancel})
+		case 0x08, 0x7f: // ^H, DEL
+			keys = append(keys, keyPress{key: keyBackspace})
+		case 0x0e: // ^N
+			keys = append(keys, keyPress{key: keyDown})
+		case 0x10: // ^P
+			keys = append(keys, keyPress{key: keyUp})
+		case 0x15: // ^U
+			keys = append(keys, keyPress{key: keyClear})
+		default:
+			if unicode.IsPrint(r) {
+				keys = append(keys, keyPress{key: keyRune, r: r})
+			} else {
+				keys = append(keys, keyPress{key: keyUnknown})
+			}
+		}
+	}
+	return keys
+}
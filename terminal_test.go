@@ -0,0 +1,49 @@
+package herd
+
+import (
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("ab\033[A\033[6~\t\x01\x7f\033[Z\r\x03\033"))
+	expected := []keyPress{
+		{key: keyRune, r: 'a'},
+		{key: keyRune, r: 'b'},
+		{key: keyUp},
+		{key: keyPageDown},
+		{key: keyToggle},
+		{key: keyToggleAll},
+		{key: keyBackspace},
+		{key: keyUnknown},
+		{key: keyAccept},
+		{key: keyInterrupt},
+		{key: keyCancel},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Errorf("Key %d: expected %v, got %v", i, expected[i], keys[i])
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in       string
+		width    int
+		expected string
+	}{
+		{"web-01", 10, "web-01"},
+		{"web-01", 3, "web"},
+		{"zürich", 2, "zü"},
+		{"web-01", 0, ""},
+		{"web-01", -1, ""},
+	}
+	for _, test := range tests {
+		if out := truncate(test.in, test.width); out != test.expected {
+			t.Errorf("truncate(%q, %d) should be %q, got %q", test.in, test.width, test.expected, out)
+		}
+	}
+}
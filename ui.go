@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
@@ -65,13 +67,33 @@ const (
 	OutputPerhost
 	OutputInline
 	OutputAll
+	OutputGrouped
+	OutputDiff
+	OutputDashboard
 )
 
 var outputModeString map[OutputMode]string = map[OutputMode]string{
-	OutputTail:    "tail",
-	OutputPerhost: "per-host",
-	OutputInline:  "inline",
-	OutputAll:     "all",
+	OutputTail:      "tail",
+	OutputPerhost:   "per-host",
+	OutputInline:    "inline",
+	OutputAll:       "all",
+	OutputGrouped:   "grouped",
+	OutputDiff:      "diff",
+	OutputDashboard: "dashboard",
+}
+
+// OutputFormat determines whether output is meant for humans or for other
+// programs
+type OutputFormat int
+
+const (
+	FormatPretty OutputFormat = iota
+	FormatJsonl
+)
+
+var outputFormatString map[OutputFormat]string = map[OutputFormat]string{
+	FormatPretty: "pretty",
+	FormatJsonl:  "jsonl",
 }
 
 type ColorConfig struct {
@@ -171,8 +193,11 @@ type SettingsFunc func() (string, map[string]any)
 type UI interface {
 	PrintHistoryItem(hi *HistoryItem)
 	PrintHostList(opts HostListOptions)
+	PickHosts(attributes []string) error
+	PrintInventoryDiff(d *InventoryDiff)
 	PrintSettings(...SettingsFunc)
 	SetOutputMode(OutputMode)
+	SetOutputFormat(OutputFormat)
 	SetOutputTimestamp(bool)
 	SetPagerEnabled(bool)
 	Sync()
@@ -209,6 +234,10 @@ type SimpleUI struct {
 	pchan           chan outputMessage
 	formatter       formatter
 	outputMode      OutputMode
+	outputFormat    OutputFormat
+	pendingOutput   chan OutputLine
+	consumers       sync.WaitGroup
+	interrupt       func()
 	outputTimestamp bool
 	pagerEnabled    bool
 	width           int
@@ -231,6 +260,8 @@ const (
 	outputMessageResult
 	outputMessageProgress
 	outputMessageHostlist
+	outputMessageHold
+	outputMessageRelease
 )
 
 type outputMessage struct {
@@ -306,6 +337,16 @@ func (ui *SimpleUI) SetOutputMode(o OutputMode) {
 	ui.outputMode = o
 }
 
+// SetOutputFormat switches between output for humans and a stream of JSON
+// objects. JSON goes to stdout, log messages and progress always go to stderr
+// so they can't get mixed up with it.
+func (ui *SimpleUI) SetOutputFormat(f OutputFormat) {
+	ui.outputFormat = f
+	if f == FormatJsonl {
+		ui.altOutput = os.Stderr
+	}
+}
+
 func (ui *SimpleUI) SetOutputTimestamp(e bool) {
 	ui.outputTimestamp = e
 }
@@ -314,37 +355,64 @@ func (ui *SimpleUI) SetPagerEnabled(e bool) {
 	ui.pagerEnabled = e
 }
 
+// OnInterrupt sets what to do when ctrl-c is pressed while the terminal is in
+// raw mode, as that doesn't send a signal
+func (ui *SimpleUI) OnInterrupt(f func()) {
+	ui.interrupt = f
+}
+
 func (ui *SimpleUI) printer() {
+	// While a full-screen view owns the terminal, messages are held back
+	// until it's done. Progress messages are useless by then, so they are
+	// dropped.
+	var held []outputMessage
+	holding := false
 	for msg := range ui.pchan {
-		if msg.messageType == outputMessageFlush {
+		switch {
+		case msg.messageType == outputMessageFlush:
 			ui.syncCond.L.Lock()
 			ui.syncCond.Broadcast()
 			ui.syncCond.L.Unlock()
-			continue
-		}
-
-		out := ui.output
-		if ui.output != ui.altOutput && (msg.messageType == outputMessageLog || msg.messageType == outputMessageProgress) {
-			out = ui.altOutput
-		}
-
-		// If we're getting a normal message in the middle of printing
-		// progress, wipe the progress message and reprint it after this
-		// message
-		if ui.lastProgress != "" && msg.messageType != outputMessageProgress && out == ui.altOutput {
-			out.WriteString(clearLine + msg.message + ui.lastProgress)
-			out.Sync()
-			continue
+		case msg.messageType == outputMessageHold:
+			holding = true
+		case msg.messageType == outputMessageRelease:
+			holding = false
+			for _, msg := range held {
+				ui.print(msg)
+			}
+			held = nil
+		case holding:
+			if msg.messageType != outputMessageProgress {
+				held = append(held, msg)
+			}
+		default:
+			ui.print(msg)
 		}
+	}
+}
 
-		if msg.messageType == outputMessageProgress {
-			out.WriteString(clearLine)
-			ui.lastProgress = msg.message
-		}
+func (ui *SimpleUI) print(msg outputMessage) {
+	out := ui.output
+	if ui.output != ui.altOutput && (msg.messageType == outputMessageLog || msg.messageType == outputMessageProgress) {
+		out = ui.altOutput
+	}
 
-		out.WriteString(msg.message)
+	// If we're getting a normal message in the middle of printing
+	// progress, wipe the progress message and reprint it after this
+	// message
+	if ui.lastProgress != "" && msg.messageType != outputMessageProgress && out == ui.altOutput {
+		out.WriteString(clearLine + msg.message + ui.lastProgress)
 		out.Sync()
+		return
 	}
+
+	if msg.messageType == outputMessageProgress {
+		out.WriteString(clearLine)
+		ui.lastProgress = msg.message
+	}
+
+	out.WriteString(msg.message)
+	out.Sync()
 }
 
 type simpleUIWriter struct {
@@ -368,6 +436,7 @@ func (ui *SimpleUI) BindLogrus() {
 }
 
 func (ui *SimpleUI) Sync() {
+	ui.consumers.Wait()
 	ui.syncCond.L.Lock()
 	ui.pchan <- outputMessage{outputMessageFlush, ""}
 	defer ui.syncCond.L.Unlock()
@@ -380,11 +449,14 @@ func (ui *SimpleUI) End() {
 }
 
 func (ui *SimpleUI) PrintHistoryItem(hi *HistoryItem) {
-	if ui.outputMode != OutputAll && ui.outputMode != OutputInline {
+	if ui.outputFormat == FormatJsonl {
+		ui.pchan <- outputMessage{outputMessageResult, jsonlSummary(hi)}
+		return
+	}
+	if ui.outputMode == OutputTail || ui.outputMode == OutputPerhost {
 		return
 	}
 	usePager := ui.pagerEnabled
-	hlen := hi.maxHostNameLength
 	linecount := 0
 	buffer := ""
 	var pgr *pager
@@ -392,13 +464,7 @@ func (ui *SimpleUI) PrintHistoryItem(hi *HistoryItem) {
 		linecount = 2
 	}
 
-	for _, result := range hi.Results {
-		var txt string
-		if ui.outputMode == OutputAll {
-			txt = ui.formatter.formatResult(result, hlen)
-		} else {
-			txt = ui.formatter.formatOutput(result, hlen)
-		}
+	for _, txt := range ui.formatHistoryItem(hi) {
 		if !usePager {
 			ui.pchan <- outputMessage{outputMessageResult, txt}
 		} else if pgr != nil {
@@ -414,7 +480,7 @@ func (ui *SimpleUI) PrintHistoryItem(hi *HistoryItem) {
 					usePager = false
 				} else {
 					pgr.WriteString(ui.formatter.formatCommand(hi.Command))
-					pgr.WriteString(ui.formatter.formatSummary(hi.Summary.Ok, hi.Summary.Fail, hi.Summary.Err))
+					pgr.WriteString(ui.formatter.formatSummary(hi.Summary.Ok, hi.Summary.Fail, hi.Summary.Err, hi.Summary.Skipped))
 					pgr.WriteString(buffer)
 				}
 				buffer = ""
@@ -433,6 +499,49 @@ func (ui *SimpleUI) PrintHistoryItem(hi *HistoryItem) {
 	}
 }
 
+// formatHistoryItem formats the results of a run, per host or per group of
+// hosts with identical results, depending on the output mode. The dashboard
+// only shows output while a command runs, so afterwards results are grouped.
+func (ui *SimpleUI) formatHistoryItem(hi *HistoryItem) []string {
+	txts := []string{}
+	switch ui.outputMode {
+	case OutputGrouped, OutputDiff, OutputDashboard:
+		groups := groupResults(hi.Results)
+		for i, g := range groups {
+			if ui.outputMode == OutputDiff && i > 0 {
+				txts = append(txts, ui.formatter.formatGroupDiff(g, groups[0]))
+			} else {
+				txts = append(txts, ui.formatter.formatGroup(g))
+			}
+		}
+	case OutputAll:
+		for _, result := range hi.Results {
+			txts = append(txts, ui.formatter.formatResult(result, hi.maxHostNameLength))
+		}
+	default:
+		for _, result := range hi.Results {
+			txts = append(txts, ui.formatter.formatOutput(result, hi.maxHostNameLength))
+		}
+	}
+	return txts
+}
+
+// PrintHistoryEntries prints an overview of runs found in the history
+// database, newest first
+func (ui *SimpleUI) PrintHistoryEntries(entries []HistoryEntry) {
+	idlen := 0
+	for _, e := range entries {
+		idlen = max(idlen, len(strconv.FormatUint(e.Id, 10)))
+	}
+	indent := strings.Repeat(" ", idlen+23)
+	for _, e := range entries {
+		txt := fmt.Sprintf("%*d  %s  ", idlen, e.Id, e.Item.StartTime.Local().Format("2006-01-02 15:04:05"))
+		txt += ui.formatter.formatCommand(e.Item.Command)
+		txt += indent + ui.formatter.formatSummary(e.Item.Summary.Ok, e.Item.Summary.Fail, e.Item.Summary.Err, e.Item.Summary.Skipped)
+		ui.pchan <- outputMessage{outputMessageResult, txt}
+	}
+}
+
 func startPager(p *pager, o *io.Writer) {
 	if p == nil {
 		return
@@ -444,6 +553,64 @@ func startPager(p *pager, o *io.Writer) {
 	}
 }
 
+// expandAttributes expands wildcards in attribute names to all matching
+// attributes of the hosts
+func expandAttributes(hosts []*Host, attributes []string) []string {
+	allAttrs := make(map[string]bool)
+	attrs := make([]string, 0, len(attributes))
+	for _, attr := range attributes {
+		if !strings.ContainsRune(attr, '*') {
+			attrs = append(attrs, attr)
+			continue
+		}
+		if len(allAttrs) == 0 {
+			for _, host := range hosts {
+				for key := range host.Attributes {
+					allAttrs[key] = true
+				}
+			}
+		}
+		myattrs := make([]string, 0)
+		for key := range allAttrs {
+			if match, _ := filepath.Match(attr, key); match {
+				myattrs = append(myattrs, key)
+			}
+		}
+		sort.Strings(myattrs)
+		attrs = append(attrs, myattrs...)
+	}
+	return attrs
+}
+
+// attributeValue formats an attribute for display, or returns an empty string
+// if the host doesn't have it
+func attributeValue(host *Host, attr string) string {
+	val, ok := host.GetAttribute(attr)
+	if !ok {
+		return ""
+	}
+	if k, ok := val.(ssh.PublicKey); ok {
+		val = fmt.Sprintf("%s %s", k.Type(), base64.StdEncoding.EncodeToString(k.Marshal()))
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// csvAttributeValue formats an attribute for csv output. Maps and lists are
+// written as JSON, so they can be parsed again.
+func csvAttributeValue(host *Host, attr string) string {
+	val, ok := host.GetAttribute(attr)
+	if !ok {
+		return ""
+	}
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		if b, err := json.Marshal(val); err == nil {
+			return string(b)
+		}
+	}
+	return attributeValue(host, attr)
+}
+
 func (ui *SimpleUI) PrintHostList(opts HostListOptions) {
 	hosts := ui.hosts.hosts
 	if len(opts.Count) == 1 && opts.Count[0] == "*" {
@@ -479,30 +646,7 @@ func (ui *SimpleUI) PrintHostList(opts HostListOptions) {
 		} else {
 			writer = newPassthrough(out)
 		}
-		allAttrs := make(map[string]bool)
-		attrs := make([]string, 0, len(opts.Attributes))
-		for _, attr := range opts.Attributes {
-			if !strings.ContainsRune(attr, '*') {
-				attrs = append(attrs, attr)
-				continue
-			}
-			if len(allAttrs) == 0 {
-				for _, host := range hosts {
-					for key := range host.Attributes {
-						allAttrs[key] = true
-					}
-				}
-			}
-			myattrs := make([]string, 0)
-			for key := range allAttrs {
-				if match, _ := filepath.Match(attr, key); match {
-					myattrs = append(myattrs, key)
-				}
-			}
-			sort.Strings(myattrs)
-			attrs = append(attrs, myattrs...)
-		}
-		opts.Attributes = attrs
+		opts.Attributes = expandAttributes(hosts, opts.Attributes)
 		if opts.Header {
 			attrline := make([]string, len(opts.Attributes)+1)
 			attrline[0] = "name"
@@ -513,15 +657,11 @@ func (ui *SimpleUI) PrintHostList(opts HostListOptions) {
 			line := make([]string, len(opts.Attributes)+1)
 			line[0] = host.Name
 			for i, attr := range opts.Attributes {
-				val, ok := host.GetAttribute(attr)
-				value := ""
-				if ok {
-					if k, ok := val.(ssh.PublicKey); ok {
-						val = fmt.Sprintf("%s %s", k.Type(), base64.StdEncoding.EncodeToString(k.Marshal()))
-					}
-					value = fmt.Sprintf("%v", val)
+				if opts.Csv {
+					line[i+1] = csvAttributeValue(host, attr)
+				} else {
+					line[i+1] = attributeValue(host, attr)
 				}
-				line[i+1] = value
 			}
 			writer.Write(line)
 		}
@@ -753,7 +893,19 @@ func (ui *SimpleUI) LoadingMessage(what string, done bool, err error) {
 	ui.pchan <- outputMessage{outputMessageProgress, fmt.Sprintf("%s/%s Loading data %s", since, ui.loadTimeout, ansi.Color(cs, ui.colors.Provider))}
 }
 
+// pendingOutputChannel creates an output channel that is picked up by the next
+// progress channel, for output modes that handle output and progress in a
+// single goroutine. Sync waits for both channels to be closed and everything
+// to be printed.
+func (ui *SimpleUI) pendingOutputChannel() chan OutputLine {
+	ui.pendingOutput = make(chan OutputLine)
+	return ui.pendingOutput
+}
+
 func (ui *SimpleUI) OutputChannel() chan OutputLine {
+	if ui.outputFormat == FormatJsonl || ui.outputMode == OutputDashboard {
+		return ui.pendingOutputChannel()
+	}
 	if ui.outputMode != OutputTail {
 		return nil
 	}
@@ -798,6 +950,18 @@ func (ui *SimpleUI) OutputChannel() chan OutputLine {
 }
 
 func (ui *SimpleUI) ProgressChannel(deadline time.Time) chan ProgressMessage {
+	if ui.outputFormat == FormatJsonl {
+		return ui.jsonlProgressChannel()
+	}
+	if ui.outputMode == OutputDashboard {
+		return ui.dashboardProgressChannel(deadline)
+	}
+	return ui.progressChannel(deadline, ui.outputMode)
+}
+
+// progressChannel shows a progress line, and results as they come in for the
+// output modes that need it
+func (ui *SimpleUI) progressChannel(deadline time.Time, mode OutputMode) chan ProgressMessage {
 	if !logrus.IsLevelEnabled(logrus.InfoLevel) {
 		return nil
 	}
@@ -811,9 +975,10 @@ func (ui *SimpleUI) ProgressChannel(deadline time.Time) chan ProgressMessage {
 		}()
 		total := len(ui.hosts.hosts)
 		queued, todo, waiting, running, done := total, total, 0, 0, 0
-		nok, nfail, nerr := 0, 0, 0
+		nok, nfail, nerr, nskip := 0, 0, 0, 0
 		hlen := ui.hosts.maxNameLength
 		show_waiting := false
+		retrying := make(map[*Host]bool)
 		for {
 			select {
 			case <-ticker.C:
@@ -827,17 +992,34 @@ func (ui *SimpleUI) ProgressChannel(deadline time.Time) chan ProgressMessage {
 					queued--
 					waiting++
 				case Running:
-					if show_waiting {
+					if retrying[msg.Host] {
+						delete(retrying, msg.Host)
+					} else if show_waiting {
 						waiting--
 					} else {
 						queued--
 					}
 					running++
-				case Finished:
+				case Retrying:
 					running--
+					retrying[msg.Host] = true
+					if mode == OutputTail {
+						ui.pchan <- outputMessage{outputMessageResult, ui.formatter.formatRetry(msg.Result, hlen)}
+					}
+				case Finished, Skipped:
+					if msg.State == Skipped {
+						queued--
+						nskip++
+					} else if retrying[msg.Host] {
+						// Cancelled while waiting to retry
+						delete(retrying, msg.Host)
+					} else {
+						running--
+					}
 					todo--
 					done++
 					switch {
+					case msg.State == Skipped:
 					case msg.Result.ExitStatus == -1:
 						nerr++
 					case msg.Result.ExitSuccess:
@@ -845,7 +1027,7 @@ func (ui *SimpleUI) ProgressChannel(deadline time.Time) chan ProgressMessage {
 					default:
 						nfail++
 					}
-					switch ui.outputMode {
+					switch mode {
 					case OutputPerhost:
 						ui.pchan <- outputMessage{outputMessageResult, ui.formatter.formatResult(msg.Result, hlen)}
 					case OutputTail:
@@ -859,7 +1041,11 @@ func (ui *SimpleUI) ProgressChannel(deadline time.Time) chan ProgressMessage {
 			}
 			since := (time.Since(start) + time.Second/2).Truncate(time.Second)
 			if todo == 0 {
-				ui.pchan <- outputMessage{outputMessageProgress, fmt.Sprintf("%d done, %d ok, %d fail, %d error in %s\n", total, nok, nfail, nerr, since)}
+				msg := fmt.Sprintf("%d done, %d ok, %d fail, %d error", total, nok, nfail, nerr)
+				if nskip > 0 {
+					msg += fmt.Sprintf(", %d skipped", nskip)
+				}
+				ui.pchan <- outputMessage{outputMessageProgress, fmt.Sprintf("%s in %s\n", msg, since)}
 			} else {
 				togo := (time.Until(deadline) + time.Second/2).Truncate(time.Second)
 				msg := fmt.Sprintf("Waiting (%s/%s)... %d/%d done", since, togo, done, total)
@@ -869,7 +1055,11 @@ func (ui *SimpleUI) ProgressChannel(deadline time.Time) chan ProgressMessage {
 				if show_waiting {
 					msg += fmt.Sprintf(", %d waiting", waiting)
 				}
-				msg += fmt.Sprintf(", %d in progress, %d ok, %d fail, %d error", running, nok, nfail, nerr)
+				msg += fmt.Sprintf(", %d in progress", running)
+				if len(retrying) > 0 {
+					msg += fmt.Sprintf(", %d retrying", len(retrying))
+				}
+				msg += fmt.Sprintf(", %d ok, %d fail, %d error", nok, nfail, nerr)
 				ui.pchan <- outputMessage{outputMessageProgress, msg}
 			}
 		}
@@ -901,6 +1091,7 @@ func (ui *SimpleUI) Settings() (string, map[string]any) {
 	return "User Interface", map[string]any{
 		"Type":      "Simple",
 		"Output":    outputModeString[ui.outputMode],
+		"Format":    outputFormatString[ui.outputFormat],
 		"Timestamp": ui.outputTimestamp,
 		"NoPager":   !ui.pagerEnabled,
 		"NoColor":   ansi.Black == "",